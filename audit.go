@@ -0,0 +1,344 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+const (
+	// auditQueueSize is how many records may wait to be written before
+	// new ones are dropped, so that a slow sink never holds up the
+	// operations it records.
+	auditQueueSize = 1024
+
+	// auditWebhookTimeout bounds each request to audit_webhook_url.
+	auditWebhookTimeout = 10 * time.Second
+
+	auditSyslogTag = "vault-plugin-database-snowflake"
+)
+
+// auditOptions configures where audit records of user operations are sent.
+type auditOptions struct {
+	file           string
+	syslog         bool
+	webhookURL     string
+	webhookHeaders map[string]string
+}
+
+func parseAuditOptions(config map[string]interface{}) (auditOptions, error) {
+	var opts auditOptions
+	var err error
+
+	if opts.file, err = strutil.GetString(config, "audit_file"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve audit_file: %w", err)
+	}
+	if opts.file != "" && !filepath.IsAbs(opts.file) {
+		return opts, fmt.Errorf("invalid audit_file %q: must be an absolute path", opts.file)
+	}
+	if opts.syslog, err = getBool(config, "audit_syslog"); err != nil {
+		return opts, err
+	}
+
+	if opts.webhookURL, err = strutil.GetString(config, "audit_webhook_url"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve audit_webhook_url: %w", err)
+	}
+	if opts.webhookURL != "" {
+		u, err := url.Parse(opts.webhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return opts, fmt.Errorf("invalid audit_webhook_url %q: must be an http or https URL", redactString(opts.webhookURL))
+		}
+	}
+	if opts.webhookHeaders, err = getStringMap(config, "audit_webhook_headers"); err != nil {
+		return opts, err
+	}
+	if len(opts.webhookHeaders) > 0 && opts.webhookURL == "" {
+		return opts, fmt.Errorf("audit_webhook_headers requires audit_webhook_url to be set")
+	}
+	return opts, nil
+}
+
+func (o auditOptions) enabled() bool {
+	return o.file != "" || o.syslog || o.webhookURL != ""
+}
+
+// auditSink writes audit records, one JSON object each.
+type auditSink interface {
+	write(record []byte) error
+	close() error
+}
+
+type fileAuditSink struct {
+	f *os.File
+}
+
+func (s fileAuditSink) write(record []byte) error {
+	_, err := s.f.Write(append(record, '\n'))
+	return err
+}
+
+func (s fileAuditSink) close() error {
+	return s.f.Close()
+}
+
+type webhookAuditSink struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func (s webhookAuditSink) write(record []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), auditWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(record))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return redactError(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s webhookAuditSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// auditLog sends audit records to its sinks in the background, in the
+// order they were emitted.
+type auditLog struct {
+	logger hclog.Logger
+	sinks  []auditSink
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+}
+
+// newAuditLog opens the sinks configured by opts, or returns nil if there
+// are none.
+func newAuditLog(opts auditOptions, logger hclog.Logger) (*auditLog, error) {
+	if !opts.enabled() {
+		return nil, nil
+	}
+
+	var sinks []auditSink
+	closeSinks := func() {
+		for _, sink := range sinks {
+			sink.close()
+		}
+	}
+	if opts.file != "" {
+		f, err := os.OpenFile(opts.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit_file: %w", err)
+		}
+		sinks = append(sinks, fileAuditSink{f: f})
+	}
+	if opts.syslog {
+		sink, err := newSyslogAuditSink(auditSyslogTag)
+		if err != nil {
+			closeSinks()
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if opts.webhookURL != "" {
+		sinks = append(sinks, webhookAuditSink{
+			client:  &http.Client{Timeout: auditWebhookTimeout},
+			url:     opts.webhookURL,
+			headers: opts.webhookHeaders,
+		})
+	}
+
+	l := &auditLog{
+		logger: logger,
+		sinks:  sinks,
+		queue:  make(chan []byte, auditQueueSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *auditLog) run() {
+	defer close(l.done)
+	for record := range l.queue {
+		for _, sink := range l.sinks {
+			if err := sink.write(record); err != nil {
+				l.logger.Error("failed to write audit record", "error", err)
+			}
+		}
+	}
+	for _, sink := range l.sinks {
+		if err := sink.close(); err != nil {
+			l.logger.Error("failed to close audit sink", "error", err)
+		}
+	}
+}
+
+func (l *auditLog) emit(record auditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		l.logger.Error("failed to encode audit record", "error", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.queue <- line:
+	default:
+		l.logger.Error("audit queue is full, dropping record", "operation", record.Operation, "username", record.Username)
+	}
+}
+
+// close stops accepting records and waits up to timeout for those queued
+// to be written.
+func (l *auditLog) close(timeout time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-l.done:
+	case <-timer.C:
+		l.logger.Warn("audit records still being written on close", "timeout", timeout)
+	}
+}
+
+// auditRecord is the JSON record written for each user operation.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Username  string    `json:"username,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	QueryIDs  []string  `json:"query_ids,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// updateOperation names the operation an UpdateUser request audits as.
+func updateOperation(req dbplugin.UpdateUserRequest) string {
+	rotate := req.Password != nil || req.PublicKey != nil
+	switch {
+	case rotate && req.Expiration != nil:
+		return "rotate_and_renew"
+	case rotate:
+		return "rotate"
+	default:
+		return "renew"
+	}
+}
+
+type auditEventKey struct{}
+
+// auditEvent collects the audit record of an operation as it runs.
+type auditEvent struct {
+	log      *auditLog
+	sanitize func(error) error
+
+	mu     sync.Mutex
+	record auditRecord
+}
+
+// startAudit returns a context in which the query IDs of the statements
+// run are added to the audit record of operation, and the event to finish
+// once the operation returns. Both are unchanged and nil if auditing is
+// off or dry_run is set.
+func (s *SnowflakeSQL) startAudit(ctx context.Context, operation, role, username string) (context.Context, *auditEvent) {
+	if s.audit == nil || s.dryRun {
+		return ctx, nil
+	}
+	e := &auditEvent{
+		log:      s.audit,
+		sanitize: s.sanitizeError,
+		record: auditRecord{
+			Time:      time.Now().UTC(),
+			Operation: operation,
+			Role:      role,
+			Username:  username,
+		},
+	}
+	return context.WithValue(ctx, auditEventKey{}, e), e
+}
+
+// setUsername records the user the operation is about, once it is known.
+func (e *auditEvent) setUsername(username string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.Username = username
+}
+
+// finish emits the record with the operation's result.
+func (e *auditEvent) finish(err error) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	record := e.record
+	record.QueryIDs = append([]string(nil), e.record.QueryIDs...)
+	e.mu.Unlock()
+
+	record.Result = "success"
+	if err != nil {
+		record.Result = "error"
+		// The record is written before the error sanitizer middleware
+		// replaces the configured credentials in the error.
+		record.Error = e.sanitize(err).Error()
+	}
+	e.log.emit(record)
+}
+
+// recordQueryID adds the Snowflake query ID of a statement run in ctx to
+// its operation's audit record.
+func recordQueryID(ctx context.Context, queryID string) {
+	e, _ := ctx.Value(auditEventKey{}).(*auditEvent)
+	if e == nil || queryID == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.QueryIDs = append(e.record.QueryIDs, queryID)
+}
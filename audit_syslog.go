@@ -0,0 +1,28 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows && !plan9
+
+package snowflake
+
+import "log/syslog"
+
+type syslogAuditSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogAuditSink(tag string) (auditSink, error) {
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogAuditSink{w: w}, nil
+}
+
+func (s syslogAuditSink) write(record []byte) error {
+	return s.w.Info(string(record))
+}
+
+func (s syslogAuditSink) close() error {
+	return s.w.Close()
+}
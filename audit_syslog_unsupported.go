@@ -0,0 +1,15 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows || plan9
+
+package snowflake
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func newSyslogAuditSink(string) (auditSink, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
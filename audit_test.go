@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuditOptions(t *testing.T) {
+	opts, err := parseAuditOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.False(t, opts.enabled())
+
+	_, err = parseAuditOptions(map[string]interface{}{"audit_file": "audit.log"})
+	require.EqualError(t, err, `invalid audit_file "audit.log": must be an absolute path`)
+
+	_, err = parseAuditOptions(map[string]interface{}{"audit_webhook_url": "ftp://example.com"})
+	require.EqualError(t, err, `invalid audit_webhook_url "ftp://example.com": must be an http or https URL`)
+
+	_, err = parseAuditOptions(map[string]interface{}{
+		"audit_webhook_headers": map[string]interface{}{"Authorization": "Bearer token"},
+	})
+	require.EqualError(t, err, "audit_webhook_headers requires audit_webhook_url to be set")
+}
+
+func readAuditRecords(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record auditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestSnowflakeSQL_AuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"audit_file": path})
+
+	req := fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}'",
+		"GRANT ROLE public TO USER {{name}}",
+	)
+	resp, err := db.NewUser(context.Background(), req)
+	require.NoError(t, err)
+
+	_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username:   resp.Username,
+		Expiration: &dbplugin.ChangeExpiration{NewExpiration: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+
+	fake.FailOn("drop user", errors.New("SQL compilation error"))
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: resp.Username})
+	require.Error(t, err)
+
+	require.NoError(t, db.Close())
+	records := readAuditRecords(t, path)
+	require.Len(t, records, 3)
+
+	require.Equal(t, "create", records[0].Operation)
+	require.Equal(t, resp.Username, records[0].Username)
+	require.Equal(t, "analyst", records[0].Role)
+	require.Equal(t, "success", records[0].Result)
+
+	require.Equal(t, "renew", records[1].Operation)
+	require.Equal(t, "success", records[1].Result)
+
+	require.Equal(t, "revoke", records[2].Operation)
+	require.Equal(t, resp.Username, records[2].Username)
+	require.Equal(t, "error", records[2].Result)
+	require.Contains(t, records[2].Error, "SQL compilation error")
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), req.Password)
+}
+
+func TestSnowflakeSQL_AuditFile_RedactsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"audit_file":     path,
+		"connection_url": "vault:s3cr3t-root@fake/db",
+	})
+
+	fake.FailOn("create user", errors.New("incorrect password s3cr3t-root"))
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	require.Error(t, err)
+
+	require.NoError(t, db.Close())
+	records := readAuditRecords(t, path)
+	require.Len(t, records, 1)
+	require.Contains(t, records[0].Error, "incorrect password [password]")
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "s3cr3t-root")
+}
+
+func TestSnowflakeSQL_AuditWebhook(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []auditRecord
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var record auditRecord
+		require.NoError(t, json.Unmarshal(body, &record))
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	db, _ := newFakeSnowflake(t, map[string]interface{}{
+		"audit_webhook_url":     server.URL,
+		"audit_webhook_headers": map[string]interface{}{"Authorization": "Bearer token"},
+	})
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, records, 1)
+	require.Equal(t, "create", records[0].Operation)
+	require.Equal(t, "success", records[0].Result)
+}
+
+func TestAuditEvent_QueryIDs(t *testing.T) {
+	s := &SnowflakeSQL{audit: &auditLog{}}
+	ctx, event := s.startAudit(context.Background(), "create", "analyst", "")
+	recordQueryID(ctx, "01b2-0001")
+	recordQueryID(ctx, "")
+	recordQueryID(context.Background(), "01b2-0002")
+
+	require.Equal(t, []string{"01b2-0001"}, event.record.QueryIDs)
+
+	s.dryRun = true
+	_, event = s.startAudit(context.Background(), "create", "analyst", "")
+	require.Nil(t, event, "dry runs are not audited")
+}
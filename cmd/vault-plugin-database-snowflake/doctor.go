@@ -0,0 +1,134 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	snowflake "github.com/hashicorp/vault-plugin-database-snowflake"
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+const doctorUsage = `Usage: vault-plugin-database-snowflake doctor [-config FILE] [-role FILE]
+
+  Checks the JSON config written to Vault's database/config endpoint, and
+  optionally the JSON written to a database/roles endpoint, without
+  connecting to Snowflake. The config is read from stdin unless -config is
+  given.
+`
+
+// doctorCommand runs the doctor subcommand.
+func doctorCommand(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), doctorUsage) }
+	configPath := flags.String("config", "-", "path to the JSON config, or - for stdin")
+	rolePath := flags.String("role", "", "path to the JSON role to check the statements of")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *configPath == "-" && *rolePath == "-" {
+		fmt.Fprintln(os.Stderr, "error: -config and -role cannot both be read from stdin")
+		return 2
+	}
+
+	config, err := readConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+
+	var role snowflake.RoleStatements
+	if *rolePath != "" {
+		if role, err = readRole(*rolePath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 2
+		}
+	}
+
+	report := snowflake.CheckConfig(context.Background(), config, role)
+	printConfigReport(os.Stdout, report)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// statementList decodes a role statement field, which Vault accepts as
+// either a string or a list of strings.
+type statementList []string
+
+func (l *statementList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != "" {
+			*l = statementList{s}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+func readRole(path string) (snowflake.RoleStatements, error) {
+	var role struct {
+		Creation       statementList `json:"creation_statements"`
+		Revocation     statementList `json:"revocation_statements"`
+		Rotation       statementList `json:"rotation_statements"`
+		Renew          statementList `json:"renew_statements"`
+		CredentialType string        `json:"credential_type"`
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return snowflake.RoleStatements{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	if err := json.NewDecoder(r).Decode(&role); err != nil {
+		return snowflake.RoleStatements{}, fmt.Errorf("failed to parse role: %w", err)
+	}
+
+	statements := snowflake.RoleStatements{
+		// Vault requires creation statements, so check them even when the
+		// role leaves them out.
+		Creation:   append([]string{}, role.Creation...),
+		Revocation: role.Revocation,
+		Rotation:   role.Rotation,
+		Renew:      role.Renew,
+	}
+	if role.CredentialType != "" {
+		credentialType, err := dbplugin.CredentialTypeString(role.CredentialType)
+		if err != nil {
+			return snowflake.RoleStatements{}, fmt.Errorf("invalid credential_type %q", role.CredentialType)
+		}
+		statements.CredentialType = credentialType
+	}
+	return statements, nil
+}
+
+func printConfigReport(w io.Writer, report snowflake.ConfigReport) {
+	if report.ConfigError != nil {
+		fmt.Fprintf(w, "Config: %s\n", report.ConfigError)
+		return
+	}
+	fmt.Fprintln(w, "Config: ok")
+
+	for _, check := range report.Statements {
+		if check.Error != nil {
+			fmt.Fprintf(w, "\nStatements (%s): %s\n", check.Kind, check.Error)
+			continue
+		}
+		fmt.Fprintf(w, "\nStatements (%s): ok\n", check.Kind)
+		for _, stmt := range check.Statements {
+			fmt.Fprintf(w, "  %s;\n", stmt)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const keygenUsage = `Usage: vault-plugin-database-snowflake keygen [-bits N] [-format FORMAT] [-out FILE] [-user NAME]
+
+  Generates an RSA keypair for the plugin's own keypair authentication.
+  Prints the ALTER USER statement that sets the public key, and the
+  PKCS #8 private key in one of these formats:
+
+    pem          PEM, for the private_key config field
+    single-line  PEM with escaped newlines, for JSON or a vault write argument
+    base64       base64 URL encoded DER, for the privateKey connection_url parameter
+
+  The private key is written to -out with mode 0600 if given, and to stdout
+  otherwise.
+`
+
+const (
+	keygenFormatPEM        = "pem"
+	keygenFormatSingleLine = "single-line"
+	keygenFormatBase64     = "base64"
+)
+
+// keygenCommand runs the keygen subcommand.
+func keygenCommand(args []string) int {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), keygenUsage) }
+	bits := flags.Int("bits", 2048, "RSA key size in bits")
+	format := flags.String("format", keygenFormatPEM, "private key format: pem, single-line, or base64")
+	out := flags.String("out", "", "file to write the private key to")
+	username := flags.String("user", "<user>", "user to name in the ALTER USER statement")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *bits < 2048 {
+		fmt.Fprintln(os.Stderr, "error: -bits must be at least 2048")
+		return 2
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, *bits)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to generate key: %s\n", err)
+		return 1
+	}
+
+	privateKey, err := formatPrivateKey(key, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to encode public key: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("Set the public key on the plugin's Snowflake user with:\n\n")
+	fmt.Printf("  ALTER USER %s SET RSA_PUBLIC_KEY = '%s';\n\n", *username, base64.StdEncoding.EncodeToString(publicKey))
+
+	if *out != "" {
+		if err := os.WriteFile(*out, []byte(privateKey), 0o600); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to write private key: %s\n", err)
+			return 1
+		}
+		fmt.Printf("Private key written to %s\n", *out)
+		return 0
+	}
+
+	fmt.Printf("Private key (%s):\n\n", *format)
+	writePrivateKey(os.Stdout, privateKey)
+	return 0
+}
+
+func formatPrivateKey(key *rsa.PrivateKey, format string) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	switch format {
+	case keygenFormatPEM:
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+	case keygenFormatSingleLine:
+		block := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		return strings.ReplaceAll(block, "\n", `\n`), nil
+	case keygenFormatBase64:
+		return base64.URLEncoding.EncodeToString(der), nil
+	default:
+		return "", fmt.Errorf("invalid format %q: must be %q, %q, or %q",
+			format, keygenFormatPEM, keygenFormatSingleLine, keygenFormatBase64)
+	}
+}
+
+func writePrivateKey(w io.Writer, privateKey string) {
+	fmt.Fprint(w, privateKey)
+	if !strings.HasSuffix(privateKey, "\n") {
+		fmt.Fprintln(w)
+	}
+}
@@ -4,14 +4,43 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-hclog"
 	snowflake "github.com/hashicorp/vault-plugin-database-snowflake"
 	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+// commands are the subcommands operators can run the plugin binary with.
+// Vault runs the plugin without arguments.
+var commands = map[string]func(args []string) int{
+	"doctor":          doctorCommand,
+	"keygen":          keygenCommand,
+	"test-connection": testConnectionCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	err := Run()
 	if err != nil {
 		log.Println(err)
@@ -19,9 +48,153 @@ func main() {
 	}
 }
 
+// statsdAddrEnv is the environment variable holding the address of a statsd
+// server to send plugin metrics to. It can be set when registering the plugin
+// with `vault plugin register -env`.
+const statsdAddrEnv = "SNOWFLAKE_PLUGIN_STATSD_ADDR"
+
+// maxConcurrentOperationsEnv is the environment variable holding the most
+// user operations the plugin runs at once across all of its database
+// configs, so that one busy mount cannot starve the others.
+const maxConcurrentOperationsEnv = "SNOWFLAKE_PLUGIN_MAX_CONCURRENT_OPERATIONS"
+
+// usernameTemplateFunctionsEnv is the environment variable holding a comma
+// separated list of the functions username templates may call, so that
+// operators of multi-tenant Vault clusters can rule out templates that
+// are not deterministic or are costly to render.
+const usernameTemplateFunctionsEnv = "SNOWFLAKE_PLUGIN_USERNAME_TEMPLATE_FUNCTIONS"
+
+// statusAddrEnv is the environment variable holding the address to serve
+// the plugin's operation counters on, as JSON, for operators debugging it.
+// It must be a loopback address, since the counters are not authenticated,
+// unless statusAllowRemoteEnv is set.
+const statusAddrEnv = "SNOWFLAKE_PLUGIN_STATUS_ADDR"
+
+// statusAllowRemoteEnv is the environment variable that, set to true, lets
+// statusAddrEnv be an address other hosts can reach.
+const statusAllowRemoteEnv = "SNOWFLAKE_PLUGIN_STATUS_ALLOW_REMOTE"
+
 // Run instantiates a SnowflakeSQL object, and runs the RPC server for the plugin
 func Run() error {
+	if addr := os.Getenv(statsdAddrEnv); addr != "" {
+		sink, err := metrics.NewStatsdSink(addr)
+		if err != nil {
+			return err
+		}
+
+		conf := metrics.DefaultConfig("vault-plugin-database-snowflake")
+		conf.EnableHostname = false
+		if _, err := metrics.NewGlobal(conf, sink); err != nil {
+			return err
+		}
+	}
+
+	if raw := os.Getenv(maxConcurrentOperationsEnv); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a positive integer, got %q", maxConcurrentOperationsEnv, raw)
+		}
+		snowflake.SetMaxConcurrentOperations(n)
+	}
+
+	if raw := os.Getenv(usernameTemplateFunctionsEnv); raw != "" {
+		var names []string
+		for _, name := range strings.Split(raw, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		snowflake.SetUsernameTemplateFunctions(names)
+	}
+
+	if addr := os.Getenv(statusAddrEnv); addr != "" {
+		defer serveStatus(addr)()
+	}
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		shutdown, err := setupTracing(context.Background())
+		if err != nil {
+			return err
+		}
+		defer shutdown(context.Background())
+	}
+
 	dbplugin.ServeMultiplex(snowflake.New)
 
 	return nil
 }
+
+// serveStatus serves the plugin status on addr until the returned func is
+// called. The status is only for debugging, so failing to serve it is
+// logged rather than keeping the plugin from serving Vault.
+func serveStatus(addr string) func() {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:       "snowflake.status",
+		Output:     os.Stderr,
+		JSONFormat: true,
+	})
+	if err := checkStatusAddr(addr); err != nil {
+		logger.Error("not serving plugin status", "error", err)
+		return func() {}
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("failed to listen for plugin status", "env", statusAddrEnv, "addr", addr, "error", err)
+		return func() {}
+	}
+
+	server := &http.Server{Handler: snowflake.StatusHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to serve plugin status", "addr", addr, "error", err)
+		}
+	}()
+	return func() { server.Close() }
+}
+
+// checkStatusAddr returns an error unless addr is a loopback address or
+// statusAllowRemoteEnv is set to true.
+func checkStatusAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", statusAddrEnv, addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	if raw := os.Getenv(statusAllowRemoteEnv); raw != "" {
+		allow, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", statusAllowRemoteEnv, raw)
+		}
+		if allow {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q: must be a loopback address, since the status is not authenticated, unless %s is set to true",
+		statusAddrEnv, addr, statusAllowRemoteEnv)
+}
+
+// setupTracing installs a tracer provider that exports spans over OTLP/HTTP.
+// The exporter is configured with the standard OTEL_EXPORTER_OTLP_*
+// environment variables.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "vault-plugin-database-snowflake"),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
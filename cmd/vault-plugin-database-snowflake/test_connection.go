@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	snowflake "github.com/hashicorp/vault-plugin-database-snowflake"
+)
+
+const testConnectionUsage = `Usage: vault-plugin-database-snowflake test-connection [-config FILE] [-timeout DURATION]
+
+  Connects to Snowflake with the same JSON config written to Vault's
+  database/config endpoint, and reports on the session it opens. The config
+  is read from stdin unless -config is given.
+`
+
+// testConnectionCommand runs the test-connection subcommand.
+func testConnectionCommand(args []string) int {
+	flags := flag.NewFlagSet("test-connection", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), testConnectionUsage) }
+	configPath := flags.String("config", "-", "path to the JSON config, or - for stdin")
+	timeout := flags.Duration("timeout", 2*time.Minute, "how long to wait for the connection")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := readConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report, err := snowflake.TestConnection(ctx, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connection failed: %s\n", err)
+		return 1
+	}
+
+	printReport(os.Stdout, report)
+	if len(report.MissingPrivileges) > 0 || report.PrivilegeError != nil {
+		return 1
+	}
+	return 0
+}
+
+func readConfig(path string) (map[string]interface{}, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var config map[string]interface{}
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return config, nil
+}
+
+func printReport(w io.Writer, report snowflake.ConnectionReport) {
+	fmt.Fprintf(w, "Connected in %s\n\n", report.ConnectTime.Round(time.Millisecond))
+	fmt.Fprintf(w, "  Account:  %s\n", report.Account)
+	fmt.Fprintf(w, "  Region:   %s\n", report.Region)
+	fmt.Fprintf(w, "  User:     %s\n", report.User)
+	fmt.Fprintf(w, "  Role:     %s\n", report.Role)
+	fmt.Fprintf(w, "  Version:  %s\n\n", report.Version)
+
+	switch {
+	case report.PrivilegeError != nil:
+		fmt.Fprintf(w, "Privileges: could not be checked: %s\n", report.PrivilegeError)
+	case len(report.MissingPrivileges) > 0:
+		fmt.Fprintf(w, "Privileges: role %s is missing %s\n", report.Role, strings.Join(report.MissingPrivileges, ", "))
+	default:
+		fmt.Fprintln(w, "Privileges: ok")
+	}
+}
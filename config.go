@@ -0,0 +1,132 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+)
+
+// getBool returns the boolean stored at key in the config, or false if the
+// key is not set.
+func getBool(config map[string]interface{}, key string) (bool, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return false, nil
+	}
+
+	b, err := parseutil.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// getDuration returns the duration stored at key in the config, or zero if
+// the key is not set. Bare numbers are interpreted as seconds.
+func getDuration(config map[string]interface{}, key string) (time.Duration, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	d, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve %s: %w", key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return d, nil
+}
+
+// getStringMap returns the map of strings stored at key in the config, which
+// may be given as a map or as a JSON object encoded in a string.
+func getStringMap(config map[string]interface{}, key string) (map[string]string, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	if str, ok := raw.(string); ok {
+		if str == "" {
+			return nil, nil
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(str), &m); err != nil {
+			return nil, fmt.Errorf("failed to retrieve %s: %w", key, err)
+		}
+		raw = m
+	}
+
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to retrieve %s: expected a map, got %T", key, raw)
+	}
+
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		value, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("failed to retrieve %s: value of %q must be a string", key, k)
+		}
+		result[k] = value
+	}
+	return result, nil
+}
+
+// getPositiveInt returns the positive integer stored at key in the config, or
+// def if the key is not set.
+func getPositiveInt(config map[string]interface{}, key string, def int) (int, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+
+	n, err := parseutil.SafeParseInt(raw)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve %s: %w", key, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s must be positive", key)
+	}
+	return n, nil
+}
+
+// getStatements returns the statements stored at key in the config, which
+// may be given as a list of statement blocks or as a single block, split
+// into individual statements.
+func getStatements(config map[string]interface{}, key string) ([]string, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	var blocks []string
+	switch v := raw.(type) {
+	case string:
+		blocks = []string{v}
+	case []string:
+		blocks = v
+	case []interface{}:
+		for _, block := range v {
+			str, ok := block.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to retrieve %s: statements must be strings", key)
+			}
+			blocks = append(blocks, str)
+		}
+	default:
+		return nil, fmt.Errorf("failed to retrieve %s: must be a string or a list of strings", key)
+	}
+
+	var stmts []string
+	for _, block := range blocks {
+		stmts = append(stmts, splitStatements(block)...)
+	}
+	return stmts, nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDuration(t *testing.T) {
+	config := map[string]interface{}{
+		"string":   "5m",
+		"seconds":  90,
+		"negative": "-1s",
+		"invalid":  "soon",
+	}
+
+	d, err := getDuration(config, "missing")
+	require.NoError(t, err)
+	require.Zero(t, d)
+
+	d, err = getDuration(config, "string")
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, d)
+
+	d, err = getDuration(config, "seconds")
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Second, d)
+
+	_, err = getDuration(config, "negative")
+	require.Error(t, err)
+
+	_, err = getDuration(config, "invalid")
+	require.Error(t, err)
+}
@@ -0,0 +1,318 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault-plugin-database-snowflake/version"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// defaultApplication is the application the driver reports to Snowflake
+// when neither the application option nor the connection URL sets one, so
+// that sessions opened by Vault can be told apart from other Go clients.
+var defaultApplication = "HashiCorp_Vault/" + version.Version
+
+// driverApplication is the application the driver reports by default.
+const driverApplication = "Go"
+
+// maxJWTExpireTimeout is the longest lifetime Snowflake accepts for the JWT
+// the driver signs for keypair authentication.
+const maxJWTExpireTimeout = time.Hour
+
+// connectionOptions are connection settings the embedded connection
+// producer does not support. They are applied by adding driver parameters
+// to the connection URL once the producer has been initialized.
+type connectionOptions struct {
+	privateKey  string
+	privateKey2 string
+	region      string
+	application string
+
+	// tmpDir is where the driver writes scratch files, passed as its
+	// tmpDirPath parameter.
+	tmpDir string
+
+	// minKeyBits is the smallest private key accepted.
+	minKeyBits int
+
+	// failoverURLs are the connection URLs of failover accounts, tried in
+	// order when the account before them is unreachable.
+	failoverURLs []string
+
+	// network overrides how the driver resolves and dials hosts.
+	network networkOptions
+
+	// passwordAuth is what to do with a connection that authenticates
+	// with a password.
+	passwordAuth passwordAuthPolicy
+
+	// jwtExpireTimeout and jwtClientTimeout are passed to the driver as
+	// its jwtTimeout and jwtClientTimeout parameters, which control how
+	// long the JWT signed for keypair authentication is valid and how long
+	// to wait for Snowflake to accept it.
+	jwtExpireTimeout time.Duration
+	jwtClientTimeout time.Duration
+
+	// sessionParams are Snowflake session parameters set on every
+	// connection, keyed by upper-case parameter name.
+	sessionParams map[string]string
+}
+
+func parseConnectionOptions(config map[string]interface{}) (connectionOptions, error) {
+	var opts connectionOptions
+	var err error
+
+	if opts.privateKey, err = strutil.GetString(config, "private_key"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve private_key: %w", err)
+	}
+	if opts.privateKey2, err = strutil.GetString(config, "private_key_2"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve private_key_2: %w", err)
+	}
+	if opts.passwordAuth, err = parsePasswordAuthPolicy(config); err != nil {
+		return opts, err
+	}
+	if opts.failoverURLs, err = parseFailoverConnectionURLs(config); err != nil {
+		return opts, err
+	}
+	if opts.network, err = parseNetworkOptions(config); err != nil {
+		return opts, err
+	}
+	if opts.minKeyBits, err = getPositiveInt(config, "min_rsa_key_bits", defaultMinRSAKeyBits); err != nil {
+		return opts, err
+	}
+	if opts.region, err = strutil.GetString(config, "region"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve region: %w", err)
+	}
+	if opts.application, err = strutil.GetString(config, "application"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve application: %w", err)
+	}
+	if opts.tmpDir, err = getTmpDir(config); err != nil {
+		return opts, err
+	}
+	if opts.jwtExpireTimeout, err = getJWTTimeout(config, "jwt_expire_timeout"); err != nil {
+		return opts, err
+	}
+	if opts.jwtExpireTimeout > maxJWTExpireTimeout {
+		return opts, fmt.Errorf("invalid jwt_expire_timeout %q: must be at most %s, the longest Snowflake accepts",
+			opts.jwtExpireTimeout, maxJWTExpireTimeout)
+	}
+	if opts.jwtClientTimeout, err = getJWTTimeout(config, "jwt_client_timeout"); err != nil {
+		return opts, err
+	}
+
+	params, err := getStringMap(config, "session_params")
+	if err != nil {
+		return opts, err
+	}
+	for name, value := range params {
+		if !unquotedIdentifier.MatchString(name) {
+			return opts, fmt.Errorf("invalid session parameter name %q", name)
+		}
+		if opts.sessionParams == nil {
+			opts.sessionParams = map[string]string{}
+		}
+		// Upper case names cannot collide with the driver's own DSN
+		// parameters, which are lower or camel case.
+		opts.sessionParams[strings.ToUpper(name)] = value
+	}
+
+	return opts, nil
+}
+
+// getJWTTimeout returns the duration at key, which the driver only accepts
+// in whole seconds.
+func getJWTTimeout(config map[string]interface{}, key string) (time.Duration, error) {
+	d, err := getDuration(config, key)
+	if err != nil {
+		return 0, err
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a whole number of seconds", key, d)
+	}
+	return d, nil
+}
+
+// getTmpDir returns the tmp_dir in the config, which the driver requires
+// to exist.
+func getTmpDir(config map[string]interface{}) (string, error) {
+	dir, err := strutil.GetString(config, "tmp_dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve tmp_dir: %w", err)
+	}
+	if dir == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("invalid tmp_dir %q: must be an absolute path", dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("invalid tmp_dir %q: must be an existing directory", dir)
+	}
+	return dir, nil
+}
+
+func (o connectionOptions) empty() bool {
+	return o.privateKey == "" && o.region == "" && o.application == "" && o.tmpDir == "" && len(o.sessionParams) == 0 &&
+		o.jwtExpireTimeout == 0 && o.jwtClientTimeout == 0
+}
+
+// connectionURL returns connectionURL with the options added.
+func (o connectionOptions) connectionURL(connectionURL, username string) (string, error) {
+	dsn := connectionURL
+
+	if o.privateKey != "" {
+		key, err := parsePrivateKey(o.privateKey)
+		if err != nil {
+			return "", err
+		}
+		if err := checkRSAKeySize("private_key", &key.PublicKey, o.minKeyBits); err != nil {
+			return "", err
+		}
+		if dsn, err = keyPairConnectionURL(dsn, username, key); err != nil {
+			return "", err
+		}
+	}
+
+	params := url.Values{}
+	if o.region != "" {
+		params.Set("region", o.region)
+	}
+	if o.application != "" {
+		params.Set("application", o.application)
+	}
+	if o.tmpDir != "" {
+		params.Set("tmpDirPath", o.tmpDir)
+	}
+	if o.jwtExpireTimeout != 0 {
+		params.Set("jwtTimeout", strconv.FormatInt(int64(o.jwtExpireTimeout/time.Second), 10))
+	}
+	if o.jwtClientTimeout != 0 {
+		params.Set("jwtClientTimeout", strconv.FormatInt(int64(o.jwtClientTimeout/time.Second), 10))
+	}
+	for name, value := range o.sessionParams {
+		params.Set(name, value)
+	}
+	dsn = appendDSNParams(dsn, params)
+
+	if _, err := gosnowflake.ParseDSN(dsn); err != nil {
+		return "", fmt.Errorf("invalid connection_url: %s", redactString(err.Error()))
+	}
+	return dsn, nil
+}
+
+// configureConnection adds the options to the connection URL, caches its
+// parsed config, and verifies the resulting connection if requested.
+func (s *SnowflakeSQL) configureConnection(ctx context.Context, opts connectionOptions, verifyConnection bool) error {
+	if opts.privateKey != "" && s.Password != "" {
+		return fmt.Errorf("password and private_key cannot both be set")
+	}
+
+	if !opts.empty() {
+		var err error
+		s.SQLConnectionProducer.Lock()
+		s.ConnectionURL, err = opts.connectionURL(s.ConnectionURL, s.Username)
+		s.SQLConnectionProducer.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	failoverDSNs, err := s.renderFailoverURLs(opts)
+	if err != nil {
+		return err
+	}
+	secondaryKey, err := opts.secondaryKey()
+	if err != nil {
+		return err
+	}
+	if err := s.cacheConnectionConfig(failoverDSNs, opts.network, secondaryKey); err != nil {
+		return err
+	}
+	if err := s.checkAuthenticator(opts.passwordAuth); err != nil {
+		return err
+	}
+
+	if verifyConnection {
+		if err := s.pingConnection(ctx); err != nil {
+			return fmt.Errorf("error verifying connection: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendDSNParams adds params to the query string of the DSN, replacing
+// any parameters of the same name already there.
+func appendDSNParams(dsn string, params url.Values) string {
+	if len(params) == 0 {
+		return dsn
+	}
+
+	base, query, hasQuery := strings.Cut(dsn, "?")
+	existing, err := url.ParseQuery(query)
+	if err != nil {
+		// Leave a query string we cannot parse for the driver to reject.
+		return dsn + "&" + params.Encode()
+	}
+	if !hasQuery {
+		existing = url.Values{}
+	}
+	for key, values := range params {
+		existing[key] = values
+	}
+	return base + "?" + existing.Encode()
+}
+
+// setDefaultApplication sets the application of a parsed config to
+// defaultApplication if the DSN did not set one.
+func setDefaultApplication(cfg *gosnowflake.Config) {
+	if cfg.Application == driverApplication {
+		cfg.Application = defaultApplication
+	}
+}
+
+// hasUserInfo reports whether the DSN starts with a user@ section.
+func hasUserInfo(dsn string) bool {
+	end := strings.IndexAny(dsn, "/?")
+	if end < 0 {
+		end = len(dsn)
+	}
+	return strings.Contains(dsn[:end], "@")
+}
+
+// stripURLScheme returns connectionURL without an https:// scheme, which the
+// driver does not accept but is what the Snowflake console shows, and
+// without a trailing slash. Other schemes are rejected. The scheme may
+// follow a user@ section.
+func stripURLScheme(name, connectionURL string) (string, error) {
+	dsn, query, hasQuery := strings.Cut(connectionURL, "?")
+	end := strings.Index(dsn, "://")
+	if end < 0 {
+		return connectionURL, nil
+	}
+	start := strings.LastIndex(dsn[:end], "@") + 1
+	scheme := dsn[start:end]
+	if !strings.EqualFold(scheme, "https") {
+		return "", fmt.Errorf("invalid %s: unsupported scheme %q, use the account host without one, such as <account>.snowflakecomputing.com", name, scheme)
+	}
+
+	dsn = strings.TrimRight(dsn[:start]+dsn[end+len("://"):], "/")
+	host, _, _ := strings.Cut(dsn[start:], "/")
+	if strings.EqualFold(host, "app.snowflake.com") {
+		return "", fmt.Errorf("invalid %s: app.snowflake.com is the address of Snowsight, use the account host, such as <account>.snowflakecomputing.com", name)
+	}
+	if hasQuery {
+		dsn += "?" + query
+	}
+	return dsn, nil
+}
@@ -0,0 +1,201 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionOptions_Region(t *testing.T) {
+	opts, err := parseConnectionOptions(map[string]interface{}{"region": "us-east-2.aws"})
+	require.NoError(t, err)
+	require.False(t, opts.empty())
+
+	dsn, err := opts.connectionURL("vault:password@xy12345/db?warehouse=wh", "")
+	require.NoError(t, err)
+
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "us-east-2.aws", cfg.Region)
+	require.Equal(t, "xy12345", cfg.Account)
+	require.Equal(t, "wh", cfg.Warehouse)
+}
+
+func TestConnectionOptions_Application(t *testing.T) {
+	opts, err := parseConnectionOptions(map[string]interface{}{"application": "HashiCorp_Vault/database-prod"})
+	require.NoError(t, err)
+	require.False(t, opts.empty())
+
+	dsn, err := opts.connectionURL("vault:password@xy12345/db?application=other", "")
+	require.NoError(t, err)
+
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "HashiCorp_Vault/database-prod", cfg.Application)
+}
+
+func TestConnectionOptions_TmpDir(t *testing.T) {
+	dir := t.TempDir()
+	opts, err := parseConnectionOptions(map[string]interface{}{"tmp_dir": dir})
+	require.NoError(t, err)
+	require.False(t, opts.empty())
+
+	dsn, err := opts.connectionURL("vault:password@xy12345/db", "")
+	require.NoError(t, err)
+
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, dir, cfg.TmpDirPath)
+
+	_, err = parseConnectionOptions(map[string]interface{}{"tmp_dir": "tmp"})
+	require.EqualError(t, err, `invalid tmp_dir "tmp": must be an absolute path`)
+
+	missing := filepath.Join(dir, "missing")
+	_, err = parseConnectionOptions(map[string]interface{}{"tmp_dir": missing})
+	require.EqualError(t, err, fmt.Sprintf("invalid tmp_dir %q: must be an existing directory", missing))
+}
+
+func TestAppendDSNParams(t *testing.T) {
+	params := url.Values{"region": {"us-west-2"}}
+
+	require.Equal(t, "account/db", appendDSNParams("account/db", nil))
+	require.Equal(t, "account/db?region=us-west-2", appendDSNParams("account/db", params))
+	require.Equal(t, "account/db?region=us-west-2&warehouse=wh",
+		appendDSNParams("account/db?warehouse=wh&region=eu-west-1", params))
+}
+
+func TestStripURLScheme(t *testing.T) {
+	tests := map[string]struct {
+		connectionURL string
+		expected      string
+		expectErr     string
+	}{
+		"no scheme": {
+			connectionURL: "{{username}}:{{password}}@myorg-myaccount/db",
+			expected:      "{{username}}:{{password}}@myorg-myaccount/db",
+		},
+		"https": {
+			connectionURL: "https://myorg-myaccount.snowflakecomputing.com/",
+			expected:      "myorg-myaccount.snowflakecomputing.com",
+		},
+		"https after user": {
+			connectionURL: "{{username}}:{{password}}@HTTPS://myorg-myaccount.snowflakecomputing.com/db?warehouse=wh",
+			expected:      "{{username}}:{{password}}@myorg-myaccount.snowflakecomputing.com/db?warehouse=wh",
+		},
+		"url in a query parameter": {
+			connectionURL: "myorg-myaccount/db?proxyHost=http://proxy",
+			expected:      "myorg-myaccount/db?proxyHost=http://proxy",
+		},
+		"other scheme": {
+			connectionURL: "snowflake://myorg-myaccount/db",
+			expectErr:     `invalid connection_url: unsupported scheme "snowflake"`,
+		},
+		"snowsight": {
+			connectionURL: "https://app.snowflake.com/us-east-1/xy12345/",
+			expectErr:     "invalid connection_url: app.snowflake.com is the address of Snowsight",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dsn, err := stripURLScheme("connection_url", test.connectionURL)
+			if test.expectErr != "" {
+				require.ErrorContains(t, err, test.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, dsn)
+		})
+	}
+}
+
+func TestConnectionOptions_SessionParams(t *testing.T) {
+	opts, err := parseConnectionOptions(map[string]interface{}{
+		"session_params": map[string]interface{}{
+			"timezone":     "UTC",
+			"QUERY_TAG":    "vault plugin",
+			"LOCK_TIMEOUT": "60",
+		},
+	})
+	require.NoError(t, err)
+
+	dsn, err := opts.connectionURL("vault:password@account/db", "")
+	require.NoError(t, err)
+
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "UTC", *cfg.Params["TIMEZONE"])
+	require.Equal(t, "vault plugin", *cfg.Params["QUERY_TAG"])
+	require.Equal(t, "60", *cfg.Params["LOCK_TIMEOUT"])
+
+	_, err = parseConnectionOptions(map[string]interface{}{
+		"session_params": map[string]interface{}{"query tag": "x"},
+	})
+	require.Error(t, err)
+}
+
+func TestConnectionOptions_JWTTimeouts(t *testing.T) {
+	opts, err := parseConnectionOptions(map[string]interface{}{
+		"jwt_expire_timeout": "5m",
+		"jwt_client_timeout": 30,
+	})
+	require.NoError(t, err)
+	require.False(t, opts.empty())
+
+	dsn, err := opts.connectionURL("vault:password@account/db", "")
+	require.NoError(t, err)
+
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, cfg.JWTExpireTimeout)
+	require.Equal(t, 30*time.Second, cfg.JWTClientTimeout)
+
+	for name, config := range map[string]map[string]interface{}{
+		"fractional seconds": {"jwt_client_timeout": "1500ms"},
+		"negative":           {"jwt_client_timeout": "-1s"},
+		"over an hour":       {"jwt_expire_timeout": "61m"},
+		"not a duration":     {"jwt_expire_timeout": "soon"},
+	} {
+		_, err := parseConnectionOptions(config)
+		require.Error(t, err, name)
+	}
+}
+
+func TestSnowflakeSQL_Initialize_EnforceKeypairAuth(t *testing.T) {
+	der, err := x509.MarshalPKCS8PrivateKey(testPrivateKey(t))
+	require.NoError(t, err)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	_, err = db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":       "vault:password@myorg-myaccount/db",
+			"enforce_keypair_auth": true,
+		},
+	})
+	require.ErrorContains(t, err, "enforce_keypair_auth is set, but the connection authenticates with a password")
+
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":       "myorg-myaccount/db",
+			"username":             "vault",
+			"private_key":          privateKey,
+			"enforce_keypair_auth": true,
+		},
+	})
+}
@@ -0,0 +1,355 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+const (
+	journalOpBegin = "begin"
+	journalOpDone  = "done"
+
+	// cleanupTimeout bounds how long best effort cleanup after a failed
+	// operation may take. Cleanup runs independently of the request context,
+	// which has often expired by the time cleanup is needed.
+	cleanupTimeout = 30 * time.Second
+
+	// errNumObjectAlreadyExists is the Snowflake error code returned when
+	// creating an object whose name is already taken.
+	errNumObjectAlreadyExists = 2002
+)
+
+// createUserStatement matches the statements that create a user, capturing
+// IF NOT EXISTS.
+var createUserStatement = regexp.MustCompile(`(?is)^create\s+(?:or\s+replace\s+)?user\s+(if\s+not\s+exists\s)?`)
+
+// userCreation is how far a creation got with its CREATE USER.
+type userCreation int
+
+const (
+	userNotCreated userCreation = iota
+
+	// userMaybeCreated is a CREATE USER whose request failed or was
+	// cancelled, which Snowflake may have applied anyway.
+	userMaybeCreated
+
+	userCreated
+)
+
+type journalEntry struct {
+	Op       string    `json:"op"`
+	Username string    `json:"username"`
+	Time     time.Time `json:"time"`
+}
+
+// creationJournal records the users NewUser has started to create but not
+// yet finished creating. Users left in the journal after a failure are
+// dropped by the plugin before they can leak. When a path is configured,
+// the journal is also written to disk so that users left behind by a crash
+// are dropped when the plugin next initializes.
+type creationJournal struct {
+	mu      sync.Mutex
+	path    string
+	pending map[string]time.Time
+}
+
+// newCreationJournal returns a journal backed by the file at path, loading
+// any entries pending in it. An empty path returns an in-memory journal.
+func newCreationJournal(path string) (*creationJournal, error) {
+	j := &creationJournal{
+		path:    path,
+		pending: map[string]time.Time{},
+	}
+	if path == "" {
+		return j, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open creation journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final write from a crash is expected; skip it.
+			continue
+		}
+		switch entry.Op {
+		case journalOpBegin:
+			j.pending[entry.Username] = entry.Time
+		case journalOpDone:
+			delete(j.pending, entry.Username)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read creation journal: %w", err)
+	}
+
+	return j, j.compact()
+}
+
+// begin records that creation of the user is about to start.
+func (j *creationJournal) begin(username string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	if err := j.append(journalEntry{Op: journalOpBegin, Username: username, Time: now}); err != nil {
+		return err
+	}
+	j.pending[username] = now
+	return nil
+}
+
+// done records that the user no longer needs to be cleaned up, either
+// because it was created successfully or because it has been dropped.
+func (j *creationJournal) done(username string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.pending, username)
+	return j.append(journalEntry{Op: journalOpDone, Username: username, Time: time.Now()})
+}
+
+// list returns the usernames pending cleanup.
+func (j *creationJournal) list() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	usernames := make([]string, 0, len(j.pending))
+	for username := range j.pending {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// adopt moves the entries pending in other into this journal, so cleanup
+// still owed by a previous configuration is not forgotten.
+func (j *creationJournal) adopt(other *creationJournal) error {
+	if other == nil || other == j {
+		return nil
+	}
+	for _, username := range other.list() {
+		if err := j.begin(username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *creationJournal) append(entry journalEntry) error {
+	if j.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open creation journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write creation journal: %w", err)
+	}
+	return f.Sync()
+}
+
+// compact rewrites the journal file so it only holds pending entries.
+func (j *creationJournal) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to compact creation journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	for username, started := range j.pending {
+		if err := enc.Encode(journalEntry{Op: journalOpBegin, Username: username, Time: started}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact creation journal: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact creation journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact creation journal: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// isCreateUserStatement reports whether query creates a user.
+func isCreateUserStatement(query string) bool {
+	return createUserStatement.MatchString(strings.TrimSpace(query))
+}
+
+// createsNewUser reports whether query creates a user that did not exist
+// before it. CREATE USER IF NOT EXISTS succeeds for a user that exists, so
+// the user it leaves may not be the request's.
+func createsNewUser(query string) bool {
+	match := createUserStatement.FindStringSubmatch(strings.TrimSpace(query))
+	return match != nil && match[1] == ""
+}
+
+// isAlreadyExistsError reports whether err is Snowflake refusing to create
+// an object because one with the same name exists.
+func isAlreadyExistsError(err error) bool {
+	var sfErr *gosnowflake.SnowflakeError
+	return errors.As(err, &sfErr) && sfErr.Number == errNumObjectAlreadyExists
+}
+
+// splitAtCreateUser splits queries so that each statement that creates a
+// user runs in a request of its own. Snowflake does not report which
+// statement of a failed request failed, so the plugin could not otherwise
+// tell whether the CREATE USER ran.
+func splitAtCreateUser(queries []string) [][]string {
+	var parts [][]string
+	start := 0
+	for i, query := range queries {
+		if isCreateUserStatement(query) {
+			if start < i {
+				parts = append(parts, queries[start:i])
+			}
+			parts = append(parts, queries[i:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(queries) {
+		parts = append(parts, queries[start:])
+	}
+	return parts
+}
+
+// cleanupPartialUser drops a user whose creation failed part way through.
+// Snowflake commits DDL immediately, so rolling back the transaction does
+// not undo a CREATE USER that succeeded before a later statement failed.
+// A user with the name is not this request's to drop unless its CREATE USER
+// ran, and one that may have run is only dropped if the user exists. Users
+// that cannot be dropped, or checked for, stay in the journal and are
+// retried when the plugin next initializes.
+func (s *SnowflakeSQL) cleanupPartialUser(username string, creation userCreation) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	if creation == userMaybeCreated {
+		exists, err := s.userExists(ctx, username)
+		if err != nil {
+			s.logger.Error("failed to check for partially created user, will retry on next initialization",
+				"username", username, "error", err)
+			return
+		}
+		if !exists {
+			creation = userNotCreated
+		}
+	}
+	if creation == userNotCreated {
+		if err := s.journal.done(username); err != nil {
+			s.logger.Error("failed to update creation journal", "username", username, "error", err)
+		}
+		return
+	}
+
+	if err := s.dropPendingUser(ctx, username); err != nil {
+		s.logger.Error("failed to clean up partially created user, will retry on next initialization",
+			"username", username, "error", err)
+	}
+}
+
+// replayCreationJournal drops every user still pending in the journal.
+func (s *SnowflakeSQL) replayCreationJournal(ctx context.Context) {
+	for _, username := range s.journal.list() {
+		if err := s.dropPendingUser(ctx, username); err != nil {
+			s.logger.Error("failed to clean up partially created user", "username", username, "error", err)
+			continue
+		}
+		s.logger.Info("cleaned up partially created user", "username", username)
+	}
+}
+
+// userExists reports whether SHOW USERS lists username.
+func (s *SnowflakeSQL) userExists(ctx context.Context, username string) (bool, error) {
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("show users like '%s'", likePattern(username)))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	exists := rows.Next()
+	return exists, rows.Err()
+}
+
+func (s *SnowflakeSQL) dropPendingUser(ctx context.Context, username string) error {
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.dropUser(ctx, db, username); err != nil {
+		return err
+	}
+	return s.journal.done(username)
+}
+
+// dropUser runs the default revocation statements for username, and drops
+// its ephemeral role and schema if there are any. The statements run in one
+// transaction, and so one session, with the pre and post statements.
+func (s *SnowflakeSQL) dropUser(ctx context.Context, db Database, username string) error {
+	m := s.ephemeralVariables(map[string]string{
+		"name":        username,
+		"username":    username,
+		"quoted_name": quoteIdentifier(username),
+	})
+	queries := append(splitStatements(defaultSnowflakeDeleteSQL), s.ephemeralDropQueries()...)
+	queries = s.statementHooks.wrap(s.usernameOptions.statements(queries...))
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		if err := execQuery(ctx, tx, m, query); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.releaseQuota(username)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreationJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := newCreationJournal(path)
+	require.NoError(t, err)
+	require.Empty(t, j.list())
+
+	require.NoError(t, j.begin("v_token_a"))
+	require.NoError(t, j.begin("v_token_b"))
+	require.NoError(t, j.done("v_token_a"))
+	require.Equal(t, []string{"v_token_b"}, j.list())
+
+	// Simulate a torn write left behind by a crash.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"begin","usern`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reloaded, err := newCreationJournal(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v_token_b"}, reloaded.list())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	inMemory, err := newCreationJournal("")
+	require.NoError(t, err)
+	require.NoError(t, inMemory.adopt(reloaded))
+	require.Equal(t, []string{"v_token_b"}, inMemory.list())
+}
+
+func TestSplitAtCreateUser(t *testing.T) {
+	require.True(t, isCreateUserStatement("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	require.True(t, isCreateUserStatement("\n create or replace user {{name}}"))
+	require.True(t, isCreateUserStatement("create user if not exists {{name}}"))
+	require.False(t, isCreateUserStatement("create role {{name}}"))
+	require.False(t, isCreateUserStatement("grant role public to user {{name}}"))
+	require.True(t, createsNewUser("create or replace user {{name}}"))
+	require.False(t, createsNewUser("CREATE USER IF NOT EXISTS {{name}}"))
+	require.False(t, createsNewUser("create role {{name}}"))
+
+	require.Equal(t, [][]string{
+		{"use role useradmin"},
+		{"create user {{name}}"},
+		{"grant role public to user {{name}}", "grant role analyst to user {{name}}"},
+	}, splitAtCreateUser([]string{"use role useradmin", "create user {{name}}", "grant role public to user {{name}}", "grant role analyst to user {{name}}"}))
+	require.Equal(t, [][]string{{"create user {{name}}"}}, splitAtCreateUser([]string{"create user {{name}}"}))
+	require.Equal(t, [][]string{{"grant role public to user {{name}}"}},
+		splitAtCreateUser([]string{"grant role public to user {{name}}"}))
+}
+
+func TestIsAlreadyExistsError(t *testing.T) {
+	require.True(t, isAlreadyExistsError(&gosnowflake.SnowflakeError{Number: errNumObjectAlreadyExists}))
+	require.False(t, isAlreadyExistsError(&gosnowflake.SnowflakeError{Number: 3003}))
+	require.False(t, isAlreadyExistsError(os.ErrNotExist))
+}
@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// createObjectStatement matches the statements that create the objects a
+// resumed creation may find already exist, capturing up to the name.
+var createObjectStatement = regexp.MustCompile(`(?is)^(create\s+(?:user|role|schema|warehouse|network\s+rule|network\s+policy)\s+)(if\s+not\s+exists\s+)?`)
+
+// recentCreations remembers the users NewUser started creating within
+// resume_creation_window. A NewUser retried after an attempt that timed out
+// on Vault's side, but was applied in Snowflake, generates the same name
+// with a username template that has no random part, and resumes the
+// creation instead of failing because the user exists.
+type recentCreations struct {
+	mu      sync.Mutex
+	started map[string]time.Time
+}
+
+// record notes that creation of username started at now, and reports
+// whether an earlier creation of it started within window.
+func (r *recentCreations) record(username string, now time.Time, window time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started == nil {
+		r.started = map[string]time.Time{}
+	}
+	for name, started := range r.started {
+		if now.Sub(started) >= window {
+			delete(r.started, name)
+		}
+	}
+
+	// The window runs from the first attempt, so a creation retried
+	// forever is not resumed forever.
+	if _, ok := r.started[username]; ok {
+		return true
+	}
+	r.started[username] = now
+	return false
+}
+
+// resumeQuery makes a statement creating an object a no-op if the object
+// exists.
+func resumeQuery(query string) string {
+	match := createObjectStatement.FindStringSubmatchIndex(query)
+	if match == nil || match[4] >= 0 {
+		return query
+	}
+	return query[:match[3]] + "if not exists " + query[match[3]:]
+}
+
+// resumeStatements returns the creation statements for a user an earlier
+// attempt may have created already. The objects are only created if they
+// do not exist, and the credential of this attempt replaces that of the
+// earlier one, which Vault never received.
+func (s *SnowflakeSQL) resumeStatements(statements []string, credentialType dbplugin.CredentialType) []string {
+	resumed := make([]string, 0, len(statements)+1)
+	for _, stmt := range statements {
+		queries := splitStatements(stmt)
+		for i, query := range queries {
+			queries[i] = resumeQuery(query)
+		}
+		resumed = append(resumed, strings.Join(queries, ";\n"))
+	}
+
+	rotate := defaultSnowflakeRotatePasswordSQL
+	if credentialType == dbplugin.CredentialTypeRSAPrivateKey {
+		rotate = defaultSnowflakeRotateRSAPublicKeySQL
+	}
+	return append(resumed, s.usernameOptions.statements(rotate)...)
+}
+
+func resumeLockKey(username string) string {
+	return "user:" + username
+}
@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentCreations(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var r recentCreations
+	require.False(t, r.record("alice", now, time.Minute))
+	require.True(t, r.record("alice", now.Add(30*time.Second), time.Minute))
+	require.False(t, r.record("bob", now.Add(30*time.Second), time.Minute))
+
+	// The window runs from the first attempt.
+	require.False(t, r.record("alice", now.Add(time.Minute), time.Minute))
+}
+
+func TestResumeQuery(t *testing.T) {
+	require.Equal(t, "create user if not exists {{name}} password = 'p'", resumeQuery("create user {{name}} password = 'p'"))
+	require.Equal(t, "CREATE\n  ROLE if not exists {{role}}", resumeQuery("CREATE\n  ROLE {{role}}"))
+	require.Equal(t, "create user IF NOT EXISTS {{name}}", resumeQuery("create user IF NOT EXISTS {{name}}"))
+	require.Equal(t, "create or replace user {{name}}", resumeQuery("create or replace user {{name}}"))
+	require.Equal(t, "grant role r to user {{name}}", resumeQuery("grant role r to user {{name}}"))
+}
+
+func TestSnowflakeSQL_ResumeCreation(t *testing.T) {
+	statements := []string{
+		"CREATE USER {{name}} PASSWORD = '{{password}}'; GRANT ROLE public TO USER {{name}}",
+	}
+	first := fakeNewUserRequest(statements...)
+	retry := fakeNewUserRequest(statements...)
+	retry.Password = "a_different_password"
+
+	// Without resume_creation_window a retry for a name that has been
+	// created fails.
+	db, _ := newFakeSnowflake(t, map[string]interface{}{
+		"username_template": "{{.DisplayName}}_{{.RoleName}}",
+	})
+	_, err := db.NewUser(context.Background(), first)
+	require.NoError(t, err)
+	_, err = db.NewUser(context.Background(), retry)
+	require.ErrorContains(t, err, "already exists")
+
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"username_template":      "{{.DisplayName}}_{{.RoleName}}",
+		"resume_creation_window": "5m",
+		"ephemeral_role":         true,
+		"password_policy":        "security.policies.vault",
+	})
+	_, err = db.NewUser(context.Background(), first)
+	require.NoError(t, err)
+
+	resp, err := db.NewUser(context.Background(), retry)
+	require.NoError(t, err)
+	require.Len(t, fake.Users(), 1)
+	user, ok := fake.User(resp.Username)
+	require.True(t, ok)
+	require.Equal(t, retry.Password, user.Properties["PASSWORD"], "the retry's credential should replace the first")
+	require.Equal(t, "SECURITY.POLICIES.VAULT", user.PasswordPolicy)
+	require.Empty(t, db.journal.list())
+}
@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Database is the connection pool the plugin runs statements on.
+// NewSQLDatabase adapts a *sql.DB to it; anything else passed to
+// NewWithDatabase, such as a test double or a pool for another transport,
+// must implement it as well.
+type Database interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+	PingContext(ctx context.Context) error
+	Close() error
+}
+
+// Tx is a transaction begun on a Database. Every statement of a user
+// operation runs in one, so that they share a Snowflake session.
+type Tx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	Commit() error
+	Rollback() error
+}
+
+// Rows is the result of a query, as *sql.Rows is.
+type Rows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// Row is the result of a query for a single row, as *sql.Row is.
+type Row interface {
+	Scan(dest ...interface{}) error
+}
+
+var (
+	_ Rows = (*sql.Rows)(nil)
+	_ Row  = (*sql.Row)(nil)
+)
+
+// sqlDatabase adapts a *sql.DB to Database. Embedding it keeps methods
+// such as SetConnMaxIdleTime and Stats available to the optional
+// interfaces below. reserveMu is held while a transaction and its
+// sessions are taken from the pool.
+type sqlDatabase struct {
+	*sql.DB
+	reserveMu sync.Mutex
+}
+
+// NewSQLDatabase returns a Database running statements on db.
+func NewSQLDatabase(db *sql.DB) Database {
+	return &sqlDatabase{DB: db}
+}
+
+func (d *sqlDatabase) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (d *sqlDatabase) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	return d.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (d *sqlDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx}, nil
+}
+
+// beginTxWithSessions begins a transaction and sets aside up to n more
+// connections for it, leaving one of the pool's connections for other
+// operations. Creations take theirs one at a time, so that concurrent ones
+// cannot each hold part of the pool while waiting for the rest of it.
+func (d *sqlDatabase) beginTxWithSessions(ctx context.Context, n int) (Tx, []*sql.Conn, error) {
+	if maxOpen := d.Stats().MaxOpenConnections; maxOpen > 0 {
+		n = min(n, maxOpen-2)
+	}
+	if n < 1 {
+		tx, err := d.BeginTx(ctx, nil)
+		return tx, nil, err
+	}
+
+	d.reserveMu.Lock()
+	defer d.reserveMu.Unlock()
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	conns := make([]*sql.Conn, 0, n)
+	for len(conns) < n {
+		conn, err := d.DB.Conn(ctx)
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			tx.Rollback()
+			return nil, nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return tx, conns, nil
+}
+
+// sqlTx adapts a *sql.Tx to Tx.
+type sqlTx struct {
+	*sql.Tx
+}
+
+func (t *sqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// execer runs a statement, within a transaction as Tx does or on any
+// connection from the pool as Database does.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// connMaxIdleTimeSetter is implemented by pools that can evict idle
+// connections, as *sql.DB can.
+type connMaxIdleTimeSetter interface {
+	SetConnMaxIdleTime(d time.Duration)
+}
+
+// lastDatabase holds the most recent pool handed out by getConnection.
+// atomic.Value requires every stored value to have the same concrete type.
+type lastDatabase struct {
+	db Database
+}
+
+// openDatabase returns the injected database if one is set, and the pool
+// shared with other instances configured the same way otherwise.
+func (s *SnowflakeSQL) openDatabase(ctx context.Context) (Database, error) {
+	if s.injectedDB != nil {
+		return s.injectedDB, nil
+	}
+	return s.sharedDatabase(ctx)
+}
+
+// swapLastConnection records db as the most recent pool and returns the
+// previous one.
+func (s *SnowflakeSQL) swapLastConnection(db Database) Database {
+	prev, _ := s.lastConnection.Swap(lastDatabase{db: db}).(lastDatabase)
+	return prev.db
+}
+
+// loadLastConnection returns the most recent pool handed out by
+// getConnection, or nil if there has not been one.
+func (s *SnowflakeSQL) loadLastConnection() Database {
+	last, _ := s.lastConnection.Load().(lastDatabase)
+	return last.db
+}
+
+// setConnMaxIdleTime applies d to db if it supports evicting idle
+// connections.
+func setConnMaxIdleTime(db Database, d time.Duration) {
+	if setter, ok := db.(connMaxIdleTimeSetter); ok {
+		setter.SetConnMaxIdleTime(d)
+	}
+}
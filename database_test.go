@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/hashicorp/vault-plugin-database-snowflake/snowflaketest"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDatabase counts the calls made to the pool it wraps. Embedding
+// the interface rather than *sql.DB hides SetConnMaxIdleTime.
+type recordingDatabase struct {
+	Database
+	pings, transactions, closes int
+}
+
+func (r *recordingDatabase) PingContext(ctx context.Context) error {
+	r.pings++
+	return r.Database.PingContext(ctx)
+}
+
+func (r *recordingDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	r.transactions++
+	return r.Database.BeginTx(ctx, opts)
+}
+
+func (r *recordingDatabase) Close() error {
+	r.closes++
+	return r.Database.Close()
+}
+
+func TestSnowflakeSQL_InjectedDatabase(t *testing.T) {
+	fake := snowflaketest.NewFake()
+	pool, err := fake.Open()
+	require.NoError(t, err)
+	injected := &recordingDatabase{Database: NewSQLDatabase(pool)}
+
+	plugin, err := NewWithDatabase(injected)
+	require.NoError(t, err)
+	db := plugin.(dbplugin.Database)
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":           "vault:password@unused.invalid/db",
+			"max_connection_idle_time": "1m",
+		},
+		VerifyConnection: true,
+	})
+	require.Equal(t, 1, injected.pings)
+
+	resp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}';"))
+	require.Equal(t, 1, injected.transactions)
+	_, ok := fake.User(resp.Username)
+	require.True(t, ok, "user should have been created through the injected database")
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: resp.Username})
+	require.Empty(t, fake.Users())
+
+	dbtesting.AssertClose(t, db)
+	require.Equal(t, 1, injected.closes)
+	require.Error(t, pool.Ping(), "Close should close the injected database")
+}
@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+const describeSessionSQL = `select current_account(), current_user(), current_role(), current_region(), current_version()`
+
+// ConnectionReport describes the session opened with a plugin
+// configuration, as reported by TestConnection.
+type ConnectionReport struct {
+	Account string
+	User    string
+	Role    string
+	Region  string
+	Version string
+
+	// ConnectTime is how long initializing and verifying the connection
+	// took.
+	ConnectTime time.Duration
+
+	// MissingPrivileges lists the privileges the role needs to manage
+	// users but does not hold. PrivilegeError is set instead if the check
+	// could not be run.
+	MissingPrivileges []string
+	PrivilegeError    error
+}
+
+// TestConnection initializes the plugin with config, the same connection
+// details given to Vault's database config endpoint, and reports on the
+// session it opens. It is meant for debugging a configuration outside of
+// Vault, and does not create, change, or drop any users.
+func TestConnection(ctx context.Context, config map[string]interface{}) (ConnectionReport, error) {
+	var report ConnectionReport
+
+	// Verify the connection now, whatever the config says, and leave out
+	// options that would change users in the account or stop Initialize
+	// before the report is complete.
+	conf := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		conf[k] = v
+	}
+	for _, key := range []string{
+		"lazy_connection",
+		"verify_connection_async",
+		"creation_journal_path",
+		"reconcile_interval",
+		"privilege_check",
+		"audit_file",
+		"audit_syslog",
+	} {
+		delete(conf, key)
+	}
+
+	s := new()
+	defer s.Close()
+
+	start := time.Now()
+	if _, err := s.Initialize(ctx, dbplugin.InitializeRequest{Config: conf, VerifyConnection: true}); err != nil {
+		return report, s.sanitizeError(err)
+	}
+	report.ConnectTime = time.Since(start)
+
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return report, s.sanitizeError(err)
+	}
+
+	err = db.QueryRowContext(ctx, describeSessionSQL).Scan(
+		&report.Account, &report.User, &report.Role, &report.Region, &report.Version)
+	if err != nil {
+		return report, s.sanitizeError(fmt.Errorf("failed to describe session: %w", err))
+	}
+
+	var missingErr *missingPrivilegesError
+	if err := checkPrivileges(ctx, db); errors.As(err, &missingErr) {
+		report.MissingPrivileges = missingErr.Missing
+	} else if err != nil {
+		report.PrivilegeError = s.sanitizeError(err)
+	}
+
+	return report, nil
+}
+
+// sanitizeError removes the configured credentials, and anything else
+// redactError would, from err's message.
+func (s *SnowflakeSQL) sanitizeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactString(err.Error())
+	for secret, replacement := range s.secretValues() {
+		msg = strings.ReplaceAll(msg, secret, replacement)
+	}
+	return errors.New(msg)
+}
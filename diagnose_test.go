@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault-plugin-database-snowflake/snowflaketest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestConnection(t *testing.T) {
+	if !runAcceptanceTests {
+		t.SkipNow()
+	}
+
+	report, err := TestConnection(context.Background(), map[string]interface{}{
+		"connection_url":  snowflaketest.ConnURL(t),
+		"lazy_connection": true,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, report.Account)
+	require.NotEmpty(t, report.User)
+	require.NotEmpty(t, report.Role)
+	require.NoError(t, report.PrivilegeError)
+}
+
+func TestTestConnection_InvalidConfig(t *testing.T) {
+	_, err := TestConnection(context.Background(), map[string]interface{}{
+		"connection_url": "vault:{{password}}@account/db?authenticator=bogus",
+		"password":       "s3cr3t-password",
+	})
+	require.ErrorContains(t, err, "invalid connection_url")
+}
+
+func TestSanitizeError(t *testing.T) {
+	s := new()
+	s.Password = "s3cr3t-password"
+
+	err := s.sanitizeError(errors.New("login failed with password s3cr3t-password"))
+	require.EqualError(t, err, "login failed with password [password]")
+	require.NoError(t, s.sanitizeError(nil))
+}
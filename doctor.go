@@ -0,0 +1,205 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// RoleStatements are the statements of a Vault database role, as written to
+// its roles endpoint.
+type RoleStatements struct {
+	Creation       []string
+	Revocation     []string
+	Rotation       []string
+	Renew          []string
+	CredentialType dbplugin.CredentialType
+}
+
+// StatementCheck is the result of checking one kind of role statement.
+type StatementCheck struct {
+	// Kind is creation, revocation, rotation, or renew.
+	Kind string
+
+	// Statements are the statements as they would run for a sample user,
+	// with the credentials redacted. Only creation and revocation
+	// statements are rendered.
+	Statements []string
+
+	// Error is set if the statements would be rejected.
+	Error error
+}
+
+// ConfigReport describes the problems CheckConfig found in a plugin
+// configuration.
+type ConfigReport struct {
+	// ConfigError is set if Initialize rejected the configuration, in which
+	// case no statements were checked.
+	ConfigError error
+
+	Statements []StatementCheck
+}
+
+// OK reports whether no problems were found.
+func (r ConfigReport) OK() bool {
+	if r.ConfigError != nil {
+		return false
+	}
+	for _, check := range r.Statements {
+		if check.Error != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckConfig initializes the plugin with config, without connecting to
+// Snowflake, and renders role's statements for a sample user. It catches
+// malformed connection URLs, private keys and options, and templates with
+// unknown variables, before they are written to Vault.
+func CheckConfig(ctx context.Context, config map[string]interface{}, role RoleStatements) ConfigReport {
+	var report ConfigReport
+
+	// Never connect, and leave out the options that only do anything once
+	// connected.
+	conf := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		conf[k] = v
+	}
+	for _, key := range []string{
+		"verify_connection_async",
+		"creation_journal_path",
+		"reconcile_interval",
+		"root_health_check_interval",
+		"pool_stats_interval",
+		"audit_file",
+		"audit_syslog",
+	} {
+		delete(conf, key)
+	}
+	conf["lazy_connection"] = true
+	conf["dry_run"] = true
+
+	s := new()
+	defer s.Close()
+	// The dry_run warning would only be noise here.
+	s.logger = hclog.NewNullLogger()
+
+	if _, err := s.Initialize(ctx, dbplugin.InitializeRequest{Config: conf}); err != nil {
+		report.ConfigError = s.sanitizeError(err)
+		return report
+	}
+
+	if role.Creation != nil {
+		report.Statements = append(report.Statements, s.checkCreation(ctx, role))
+	}
+	if role.Revocation != nil {
+		report.Statements = append(report.Statements, s.checkRevocation(ctx, role.Revocation))
+	}
+
+	credential := "password"
+	if role.CredentialType == dbplugin.CredentialTypeRSAPrivateKey {
+		credential = "public_key"
+	}
+	m := map[string]string{
+		"name":        "sample_user",
+		"username":    "sample_user",
+		"quoted_name": quoteIdentifier("sample_user"),
+	}
+	if role.Rotation != nil {
+		rotation := map[string]string{credential: ""}
+		for k, v := range m {
+			rotation[k] = v
+		}
+		report.Statements = append(report.Statements, StatementCheck{
+			Kind:  "rotation",
+			Error: checkPlaceholders(role.Rotation, rotation),
+		})
+	}
+	if role.Renew != nil {
+		m["expiration"] = ""
+		report.Statements = append(report.Statements, StatementCheck{
+			Kind:  "renew",
+			Error: checkPlaceholders(role.Renew, m),
+		})
+	}
+
+	return report
+}
+
+func (s *SnowflakeSQL) checkCreation(ctx context.Context, role RoleStatements) StatementCheck {
+	check := StatementCheck{Kind: "creation"}
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "token",
+			RoleName:    "role",
+		},
+		Statements:     dbplugin.Statements{Commands: role.Creation},
+		CredentialType: role.CredentialType,
+		Password:       "password",
+		Expiration:     time.Now().Add(24 * time.Hour),
+	}
+	if role.CredentialType == dbplugin.CredentialTypeRSAPrivateKey {
+		publicKey, err := samplePublicKey(max(2048, s.minRSAKeyBits))
+		if err != nil {
+			check.Error = err
+			return check
+		}
+		req.PublicKey = publicKey
+	}
+
+	_, err := s.NewUser(ctx, req)
+	check.Statements, check.Error = s.renderedStatements(err)
+	return check
+}
+
+func (s *SnowflakeSQL) checkRevocation(ctx context.Context, statements []string) StatementCheck {
+	_, err := s.DeleteUser(ctx, dbplugin.DeleteUserRequest{
+		Username:   "sample_user",
+		Statements: dbplugin.Statements{Commands: statements},
+	})
+	check := StatementCheck{Kind: "revocation"}
+	check.Statements, check.Error = s.renderedStatements(err)
+	return check
+}
+
+// renderedStatements returns the statements of the dryRunError a user
+// operation returned, or its other error.
+func (s *SnowflakeSQL) renderedStatements(err error) ([]string, error) {
+	var dryRunErr *dryRunError
+	if errors.As(err, &dryRunErr) {
+		return dryRunErr.Statements, nil
+	}
+	if err == nil {
+		// Unreachable with dry_run set, but never report success for
+		// statements that were not rendered.
+		return nil, fmt.Errorf("statements were not rendered")
+	}
+	return nil, s.sanitizeError(err)
+}
+
+// samplePublicKey generates a PEM encoded RSA public key to render creation
+// statements with.
+func samplePublicKey(bits int) ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfig(t *testing.T) {
+	config := map[string]interface{}{
+		"connection_url": "vault:{{password}}@account/db",
+		"password":       "s3cr3t-password",
+	}
+	report := CheckConfig(context.Background(), config, RoleStatements{
+		Creation: []string{
+			"CREATE USER {{name}} PASSWORD = '{{password}}' DAYS_TO_EXPIRY = {{expiration}}",
+			"GRANT ROLE analyst TO USER {{name}}",
+		},
+		Revocation: []string{"DROP USER {{name}}"},
+		Rotation:   []string{"ALTER USER {{name}} SET PASSWORD = '{{public_key}}'"},
+		Renew:      []string{"ALTER USER {{name}} SET DAYS_TO_EXPIRY = {{expiration}}"},
+	})
+	require.NoError(t, report.ConfigError)
+	require.False(t, report.OK())
+	require.Len(t, report.Statements, 4)
+
+	creation := report.Statements[0]
+	require.Equal(t, "creation", creation.Kind)
+	require.NoError(t, creation.Error)
+	require.Len(t, creation.Statements, 2)
+	require.Contains(t, creation.Statements[0], "PASSWORD = '[password]'")
+	require.NotContains(t, creation.Statements[0], "{{")
+
+	revocation := report.Statements[1]
+	require.NoError(t, revocation.Error)
+	require.Equal(t, []string{"DROP USER sample_user"}, revocation.Statements)
+
+	require.EqualError(t, report.Statements[2].Error, "statements contain unknown template variables: {{public_key}}")
+	require.NoError(t, report.Statements[3].Error)
+	require.Len(t, config, 2, "the config is not modified")
+
+	report = CheckConfig(context.Background(), config, RoleStatements{
+		Creation:       []string{"CREATE USER {{name}} RSA_PUBLIC_KEY = '{{public_key}}'"},
+		CredentialType: dbplugin.CredentialTypeRSAPrivateKey,
+	})
+	require.True(t, report.OK())
+	require.Contains(t, report.Statements[0].Statements[0], "RSA_PUBLIC_KEY = '[public_key]'")
+
+	report = CheckConfig(context.Background(), map[string]interface{}{
+		"connection_url": "vault:{{password}}@account/db?authenticator=bogus",
+		"password":       "s3cr3t-password",
+	}, RoleStatements{Creation: []string{"CREATE USER {{name}}"}})
+	require.ErrorContains(t, report.ConfigError, "invalid connection_url")
+	require.NotContains(t, report.ConfigError.Error(), "s3cr3t-password")
+	require.Empty(t, report.Statements)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// closeDrainTimeout is how long Close waits for user operations in flight
+// before cancelling them.
+const closeDrainTimeout = 30 * time.Second
+
+// operationDrain tracks the user operations in flight so that Close can
+// let them finish before closing the connections and statements they use.
+// The zero value is ready to use.
+type operationDrain struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+
+	// ctx is cancelled when a drain times out, which cancels the contexts
+	// of the operations still in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (d *operationDrain) initLocked() {
+	if d.ctx == nil {
+		d.ctx, d.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// begin records an operation as in flight until the returned func is
+// called. The returned context is cancelled if a drain times out first.
+func (d *operationDrain) begin(ctx context.Context) (context.Context, func()) {
+	d.mu.Lock()
+	d.initLocked()
+	d.active++
+	base := d.ctx
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(base, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.active--; d.active == 0 && d.idle != nil {
+			close(d.idle)
+			d.idle = nil
+		}
+	}
+}
+
+// drain waits up to timeout for the operations in flight to finish, and
+// cancels the contexts of those that have not. It reports whether they all
+// finished in time. Cancelled operations may still be returning when it
+// does.
+func (d *operationDrain) drain(timeout time.Duration) bool {
+	d.mu.Lock()
+	d.initLocked()
+	if d.active == 0 {
+		d.mu.Unlock()
+		return true
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancel()
+	// Operations that begin after the drain are not cancelled.
+	d.ctx = nil
+	return false
+}
@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationDrain(t *testing.T) {
+	var d operationDrain
+	require.True(t, d.drain(time.Millisecond), "nothing is in flight")
+
+	ctx, done := d.begin(context.Background())
+	finished := make(chan bool)
+	go func() { finished <- d.drain(time.Minute) }()
+	select {
+	case <-finished:
+		t.Fatal("drain returned with an operation in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	done()
+	require.True(t, <-finished)
+	require.ErrorIs(t, ctx.Err(), context.Canceled, "finished operations release their context")
+
+	ctx, done = d.begin(context.Background())
+	require.False(t, d.drain(10*time.Millisecond))
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("operations outlasting the drain should be cancelled")
+	}
+	done()
+
+	ctx, done = d.begin(context.Background())
+	defer done()
+	require.NoError(t, ctx.Err(), "operations after a drain are not cancelled")
+}
+
+func TestSnowflakeSQL_Close_WaitsForOperations(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fake.FailOnFunc("grant", func() error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	created := make(chan error)
+	go func() {
+		_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+			"CREATE USER {{name}} PASSWORD = '{{password}}'",
+			"GRANT ROLE public TO USER {{name}}",
+		))
+		created <- err
+	}()
+	<-started
+
+	closed := make(chan error)
+	go func() { closed <- db.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while NewUser was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-created)
+	require.NoError(t, <-closed)
+}
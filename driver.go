@@ -0,0 +1,215 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// cachedDriverName is the database/sql driver the plugin opens its
+// connections with. The gosnowflake driver parses the DSN, and decodes any
+// private key in it, for every connection the pool opens. This driver
+// instead reuses the config Initialize parsed for the DSN.
+const cachedDriverName = "snowflake-vault"
+
+func init() {
+	sql.Register(cachedDriverName, cachedDriver{})
+}
+
+// parsedConfigs holds the parsed config of every DSN a plugin instance is
+// configured with.
+var parsedConfigs = &configCache{entries: map[string]*cachedConfig{}}
+
+// configKey returns the key of the config cached for dsn with the given
+// options. Instances configured with the same DSN but different options,
+// as the old and new instances are while Vault replaces a config, hold
+// separate entries. The key starts with the DSN, so that a key whose entry
+// is not cached can still be parsed.
+func configKey(dsn string, failoverDSNs []string, network networkOptions, secondaryKey *rsa.PrivateKey) string {
+	key := dsn
+	for _, failoverDSN := range failoverDSNs {
+		key += "\x00failover=" + failoverDSN
+	}
+	if !network.empty() {
+		key += "\x00network=" + fmt.Sprintf("%v", network)
+	}
+	if secondaryKey != nil {
+		key += "\x00private_key_2=" + secondaryKeyFingerprint(secondaryKey)
+	}
+	return key
+}
+
+// keyDSN returns the DSN a config key was made from.
+func keyDSN(key string) string {
+	dsn, _, _ := strings.Cut(key, "\x00")
+	return dsn
+}
+
+// dataSourceName returns the name to open the config cached at key with
+// driverName. Only the cached driver understands config keys.
+func dataSourceName(driverName, key string) string {
+	if driverName == cachedDriverName {
+		return key
+	}
+	return keyDSN(key)
+}
+
+type cachedConfig struct {
+	cfg  *gosnowflake.Config
+	refs int
+
+	// connector connects to the accounts, if there are failover accounts
+	// or a secondary key. Otherwise connections are opened from cfg.
+	connector driver.Connector
+}
+
+// configCache maps config keys to their parsed configs. Entries are
+// reference counted, since instances configured the same way share one.
+type configCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedConfig
+}
+
+// acquire parses dsn, and the DSNs of its failover accounts, applies the
+// network options and secondary key, and caches the result until the key
+// it returns is released.
+func (c *configCache) acquire(dsn string, failoverDSNs []string, network networkOptions, secondaryKey *rsa.PrivateKey) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := configKey(dsn, failoverDSNs, network, secondaryKey)
+	if entry, ok := c.entries[key]; ok {
+		entry.refs++
+		return key, nil
+	}
+
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection_url: %s", redactString(err.Error()))
+	}
+	transport := network.transport()
+	cfg.Transporter = transport
+	setDefaultApplication(cfg)
+	entry := &cachedConfig{cfg: cfg, refs: 1}
+
+	if len(failoverDSNs) > 0 {
+		connectors := []driver.Connector{newConnector(cfg, secondaryKey)}
+		for i, failoverDSN := range failoverDSNs {
+			cfg, err := gosnowflake.ParseDSN(failoverDSN)
+			if err != nil {
+				return "", fmt.Errorf("invalid failover_connection_urls[%d]: %s", i, redactString(err.Error()))
+			}
+			cfg.Transporter = transport
+			setDefaultApplication(cfg)
+			connectors = append(connectors, newConnector(cfg, secondaryKey))
+		}
+		entry.connector = &failover{connectors: connectors}
+	} else if secondaryKey != nil {
+		entry.connector = newConnector(cfg, secondaryKey)
+	}
+
+	c.entries[key] = entry
+	return key, nil
+}
+
+func (c *configCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	if entry.refs--; entry.refs <= 0 {
+		delete(c.entries, key)
+	}
+}
+
+// get returns the config cached at key, or parses the DSN it was made from
+// if it is not cached.
+func (c *configCache) get(key string) (*gosnowflake.Config, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return entry.cfg, nil
+	}
+	cfg, err := gosnowflake.ParseDSN(keyDSN(key))
+	if err != nil {
+		return nil, err
+	}
+	setDefaultApplication(cfg)
+	return cfg, nil
+}
+
+type cachedDriver struct{}
+
+var _ driver.DriverContext = cachedDriver{}
+
+func (d cachedDriver) Open(key string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(key)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (cachedDriver) OpenConnector(key string) (driver.Connector, error) {
+	parsedConfigs.mu.Lock()
+	entry, ok := parsedConfigs.entries[key]
+	parsedConfigs.mu.Unlock()
+	if ok && entry.connector != nil {
+		return entry.connector, nil
+	}
+
+	cfg, err := parsedConfigs.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, *cfg), nil
+}
+
+// cacheConnectionConfig parses the connection URL and the failover DSNs
+// and caches the result, with the network options and secondary key
+// applied, for the connections the pool opens, releasing the config cached
+// for the previous connection URL.
+func (s *SnowflakeSQL) cacheConnectionConfig(failoverDSNs []string, network networkOptions, secondaryKey *rsa.PrivateKey) error {
+	s.SQLConnectionProducer.Lock()
+	dsn := s.ConnectionURL
+	s.SQLConnectionProducer.Unlock()
+
+	if configKey(dsn, failoverDSNs, network, secondaryKey) == s.cachedKey {
+		return nil
+	}
+	key, err := parsedConfigs.acquire(dsn, failoverDSNs, network, secondaryKey)
+	if err != nil {
+		return err
+	}
+	s.releaseConnectionConfig()
+	s.cachedDSN = dsn
+	s.cachedKey = key
+	s.failoverDSNs = failoverDSNs
+	s.cachedNetwork = network
+	s.cachedSecondaryKey = secondaryKey
+	return nil
+}
+
+func (s *SnowflakeSQL) releaseConnectionConfig() {
+	if s.cachedKey != "" {
+		parsedConfigs.release(s.cachedKey)
+		s.cachedDSN = ""
+		s.cachedKey = ""
+		s.failoverDSNs = nil
+		s.cachedNetwork = networkOptions{}
+		s.cachedSecondaryKey = nil
+	}
+}
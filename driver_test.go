@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"crypto/rsa"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+// mustAcquire acquires the config for dsn from cache and returns its key.
+func mustAcquire(t *testing.T, cache *configCache, dsn string, failoverDSNs []string, network networkOptions, secondaryKey *rsa.PrivateKey) string {
+	t.Helper()
+	key, err := cache.acquire(dsn, failoverDSNs, network, secondaryKey)
+	require.NoError(t, err)
+	return key
+}
+
+func TestConfigCache(t *testing.T) {
+	cache := &configCache{entries: map[string]*cachedConfig{}}
+	dsn := "vault:password@account/db"
+
+	mustAcquire(t, cache, dsn, nil, networkOptions{}, nil)
+	mustAcquire(t, cache, dsn, nil, networkOptions{}, nil)
+
+	cfg, err := cache.get(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "vault", cfg.User)
+
+	again, err := cache.get(dsn)
+	require.NoError(t, err)
+	require.Same(t, cfg, again, "cached config should be reused")
+
+	cache.release(dsn)
+	again, err = cache.get(dsn)
+	require.NoError(t, err)
+	require.Same(t, cfg, again, "config should stay cached while referenced")
+
+	cache.release(dsn)
+	require.Empty(t, cache.entries)
+
+	// Uncached DSNs are still parsed on demand.
+	again, err = cache.get(dsn)
+	require.NoError(t, err)
+	require.NotSame(t, cfg, again)
+}
+
+func TestConfigCache_Application(t *testing.T) {
+	cache := &configCache{entries: map[string]*cachedConfig{}}
+	dsn := "vault:password@account/db"
+	named := "vault:password@account/db?application=Vault_prod"
+
+	mustAcquire(t, cache, dsn, nil, networkOptions{}, nil)
+	mustAcquire(t, cache, named, nil, networkOptions{}, nil)
+	defer cache.release(dsn)
+	defer cache.release(named)
+
+	cfg, err := cache.get(dsn)
+	require.NoError(t, err)
+	require.Equal(t, defaultApplication, cfg.Application)
+
+	cfg, err = cache.get(named)
+	require.NoError(t, err)
+	require.Equal(t, "Vault_prod", cfg.Application)
+
+	cfg, err = cache.get("vault:password@uncached/db")
+	require.NoError(t, err)
+	require.Equal(t, defaultApplication, cfg.Application)
+}
+
+func TestConfigCache_InvalidDSN(t *testing.T) {
+	cache := &configCache{entries: map[string]*cachedConfig{}}
+	_, err := cache.acquire("vault:password@account/db?authenticator=SNOWFLAKE_JWT&privateKey=not-a-key", nil, networkOptions{}, nil)
+	require.ErrorContains(t, err, "invalid connection_url")
+	require.Empty(t, cache.entries)
+}
+
+func TestSnowflakeSQL_CacheConnectionConfig(t *testing.T) {
+	db := new()
+
+	req := dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":  "vault:password@unreachable.invalid/db",
+			"lazy_connection": true,
+		},
+	}
+	dbtesting.AssertInitialize(t, db, req)
+
+	cfg, err := parsedConfigs.get(db.cachedKey)
+	require.NoError(t, err)
+	require.Equal(t, "vault", cfg.User)
+
+	connector, err := cachedDriver{}.OpenConnector(db.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, gosnowflake.Connector{}, connector)
+
+	dbtesting.AssertClose(t, db)
+	require.Empty(t, db.cachedDSN)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+// dryRunError is returned by user operations when dry_run is set, in place
+// of running the statements they would have run. Vault passes only errors
+// back from a plugin, so it is how the rendered statements reach the role
+// author.
+type dryRunError struct {
+	Statements []string
+}
+
+func (e *dryRunError) Error() string {
+	return fmt.Sprintf("dry_run is set, so these %d statement(s) were not executed:\n%s",
+		len(e.Statements), strings.Join(e.Statements, ";\n"))
+}
+
+// dryRun renders queries with the template variables in m, with the
+// credentials replaced by placeholders.
+func dryRun(m map[string]string, queries []string) error {
+	redactedVars := make(map[string]string, len(m))
+	for k, v := range m {
+		redactedVars[k] = v
+	}
+	for _, k := range []string{"password", "public_key"} {
+		if _, ok := redactedVars[k]; ok {
+			redactedVars[k] = "[" + k + "]"
+		}
+	}
+
+	rendered := make([]string, 0, len(queries))
+	for _, query := range queries {
+		rendered = append(rendered, dbutil.QueryHelper(query, redactedVars))
+	}
+	return &dryRunError{Statements: rendered}
+}
+
+// creationQueries returns every query createUser runs for statements, in
+// order. It must be kept in step with createUser.
+func (s *SnowflakeSQL) creationQueries(m map[string]string, statements []string) []string {
+	queries := append([]string(nil), s.statementHooks.pre...)
+	for _, stmt := range statements {
+		queries = append(queries, splitStatements(stmt)...)
+	}
+	queries = append(queries, s.ephemeralCreateQueries()...)
+	queries = append(queries, s.userProperties.queries(m)...)
+	return append(queries, s.statementHooks.post...)
+}
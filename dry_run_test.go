@@ -0,0 +1,47 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflakeSQL_DryRun(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"dry_run":        true,
+		"ephemeral_role": true,
+		"pre_statements": "USE ROLE SECURITYADMIN",
+	})
+	before := len(fake.Statements())
+
+	req := fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}' COMMENT = '{{role_name}}'; GRANT ROLE public TO USER {{name}}",
+	)
+	req.UsernameConfig.RoleName = "analyst"
+	_, err := db.NewUser(context.Background(), req)
+	var dryRunErr *dryRunError
+	require.ErrorAs(t, err, &dryRunErr)
+	require.Len(t, dryRunErr.Statements, 5)
+	require.Equal(t, "USE ROLE SECURITYADMIN", dryRunErr.Statements[0])
+	require.Regexp(t, `^CREATE USER v_token_analyst_\w+ PASSWORD = '\[password\]' COMMENT = 'analyst'$`, dryRunErr.Statements[1])
+	require.Regexp(t, `^create role v_token_analyst_\w+_ROLE$`, dryRunErr.Statements[3])
+	require.NotContains(t, err.Error(), req.Password)
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "v_someone"})
+	require.ErrorAs(t, err, &dryRunErr)
+	require.Equal(t, []string{
+		"USE ROLE SECURITYADMIN",
+		"alter user if exists v_someone unset RSA_PUBLIC_KEY, RSA_PUBLIC_KEY_2",
+		"drop user if exists v_someone",
+		"drop role if exists v_someone_ROLE",
+	}, dryRunErr.Statements)
+	require.ErrorContains(t, err, "these 4 statement(s) were not executed")
+
+	require.Empty(t, fake.Users())
+	require.Len(t, fake.Statements(), before, "no statements should have run")
+}
@@ -0,0 +1,137 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+const (
+	defaultEphemeralNetworkPolicyNameTemplate = "{{name}}_NETWORK_POLICY"
+
+	createEphemeralNetworkPolicySQL = "create network policy {{network_policy}} allowed_network_rule_list = ('{{network_rule}}')"
+	setEphemeralNetworkPolicySQL    = "alter user {{name}} set network_policy = {{network_policy}}"
+	dropEphemeralNetworkPolicySQL   = "drop network policy if exists {{network_policy}}"
+	dropEphemeralNetworkRuleSQL     = "drop network rule if exists {{network_rule}}"
+)
+
+// ephemeralNetworkPolicyOptions configures a network policy created for,
+// and dropped with, each user, that only lets the user log in from
+// allowedCIDRs. Credentials leaked from a lease are then of no use from
+// anywhere else. The policy allows a network rule, which lives in a schema,
+// named the same as the policy.
+type ephemeralNetworkPolicyOptions struct {
+	enabled      bool
+	allowedCIDRs []string
+	ruleSchema   string
+
+	// nameTemplate renders the policy and rule names from the {{name}} of
+	// the user.
+	nameTemplate string
+}
+
+func parseEphemeralNetworkPolicyOptions(config map[string]interface{}, props userProperties) (ephemeralNetworkPolicyOptions, error) {
+	var opts ephemeralNetworkPolicyOptions
+	var err error
+
+	if opts.enabled, err = getBool(config, "ephemeral_network_policy"); err != nil {
+		return opts, err
+	}
+	if !opts.enabled {
+		return opts, nil
+	}
+	if props.networkPolicy != "" {
+		return opts, fmt.Errorf("network_policy and ephemeral_network_policy cannot both be set")
+	}
+
+	cidrs, err := parseutil.ParseCommaStringSlice(config["ephemeral_network_policy_allowed_cidrs"])
+	if err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_network_policy_allowed_cidrs: %w", err)
+	}
+	if len(cidrs) == 0 {
+		return opts, fmt.Errorf("ephemeral_network_policy_allowed_cidrs must be set when ephemeral_network_policy is enabled")
+	}
+	for _, cidr := range cidrs {
+		if !isIPv4Range(cidr) {
+			return opts, fmt.Errorf("invalid ephemeral_network_policy_allowed_cidrs entry %q: must be an IPv4 address or CIDR", cidr)
+		}
+	}
+	opts.allowedCIDRs = cidrs
+
+	if opts.ruleSchema, err = strutil.GetString(config, "ephemeral_network_rule_schema"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_network_rule_schema: %w", err)
+	}
+	if len(strings.Split(opts.ruleSchema, ".")) != 2 {
+		return opts, fmt.Errorf("invalid ephemeral_network_rule_schema %q: must be a schema qualified by its database", opts.ruleSchema)
+	}
+
+	if opts.nameTemplate, err = strutil.GetString(config, "ephemeral_network_policy_name_template"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_network_policy_name_template: %w", err)
+	}
+	if opts.nameTemplate == "" {
+		opts.nameTemplate = defaultEphemeralNetworkPolicyNameTemplate
+	}
+	if err := checkPlaceholders([]string{opts.nameTemplate}, map[string]string{"name": ""}); err != nil {
+		return opts, fmt.Errorf("invalid ephemeral_network_policy_name_template: %w", err)
+	}
+
+	return opts, nil
+}
+
+// isIPv4Range reports whether s is an IPv4 address or CIDR block, which
+// are what an IPV4 network rule holds.
+func isIPv4Range(s string) bool {
+	if ip, _, err := net.ParseCIDR(s); err == nil {
+		return ip.To4() != nil
+	}
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil
+}
+
+// policyName returns the name of the user's ephemeral network policy.
+func (o ephemeralNetworkPolicyOptions) policyName(username string) string {
+	return dbutil.QueryHelper(o.nameTemplate, map[string]string{"name": username})
+}
+
+// ruleName returns the qualified name of the network rule the user's
+// ephemeral network policy allows.
+func (o ephemeralNetworkPolicyOptions) ruleName(username string) string {
+	return qualifiedIdentifier(o.ruleSchema) + "." + o.policyName(username)
+}
+
+// createRuleSQL returns the statement that creates the network rule
+// referenced by the {{network_rule}} template variable.
+func (o ephemeralNetworkPolicyOptions) createRuleSQL() string {
+	values := make([]string, 0, len(o.allowedCIDRs))
+	for _, cidr := range o.allowedCIDRs {
+		values = append(values, quoteString(cidr))
+	}
+	return fmt.Sprintf("create network rule {{network_rule}} mode = ingress type = ipv4 value_list = (%s)", strings.Join(values, ", "))
+}
+
+// createQueries returns the queries that create the network rule and the
+// {{network_policy}} network policy allowing it, and attach the policy to
+// the user.
+func (o ephemeralNetworkPolicyOptions) createQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{o.createRuleSQL(), createEphemeralNetworkPolicySQL, setEphemeralNetworkPolicySQL}
+}
+
+// dropQueries returns the queries that drop the network policy and then the
+// rule it refers to. Snowflake refuses to drop a policy attached to a user,
+// so they must run after the user is dropped.
+func (o ephemeralNetworkPolicyOptions) dropQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{dropEphemeralNetworkPolicySQL, dropEphemeralNetworkRuleSQL}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralNetworkPolicyOptions(t *testing.T) {
+	opts, err := parseEphemeralNetworkPolicyOptions(map[string]interface{}{}, userProperties{})
+	require.NoError(t, err)
+	require.Nil(t, opts.createQueries())
+	require.Nil(t, opts.dropQueries())
+
+	opts, err = parseEphemeralNetworkPolicyOptions(map[string]interface{}{
+		"ephemeral_network_policy":               true,
+		"ephemeral_network_policy_allowed_cidrs": "10.0.0.0/8, 192.168.1.7",
+		"ephemeral_network_rule_schema":          "security.network",
+	}, userProperties{})
+	require.NoError(t, err)
+	require.Equal(t, "V_USER_NETWORK_POLICY", opts.policyName("V_USER"))
+	require.Equal(t, "security.network.V_USER_NETWORK_POLICY", opts.ruleName("V_USER"))
+	require.Equal(t, []string{
+		"create network rule {{network_rule}} mode = ingress type = ipv4 value_list = ('10.0.0.0/8', '192.168.1.7')",
+		"create network policy {{network_policy}} allowed_network_rule_list = ('{{network_rule}}')",
+		"alter user {{name}} set network_policy = {{network_policy}}",
+	}, opts.createQueries())
+	require.Equal(t, []string{
+		"drop network policy if exists {{network_policy}}",
+		"drop network rule if exists {{network_rule}}",
+	}, opts.dropQueries())
+
+	valid := func(overrides map[string]interface{}) map[string]interface{} {
+		config := map[string]interface{}{
+			"ephemeral_network_policy":               true,
+			"ephemeral_network_policy_allowed_cidrs": []interface{}{"10.0.0.0/8"},
+			"ephemeral_network_rule_schema":          "security.network",
+		}
+		for k, v := range overrides {
+			config[k] = v
+		}
+		return config
+	}
+	for name, config := range map[string]map[string]interface{}{
+		"no cidrs":         valid(map[string]interface{}{"ephemeral_network_policy_allowed_cidrs": nil}),
+		"ipv6 cidr":        valid(map[string]interface{}{"ephemeral_network_policy_allowed_cidrs": "2001:db8::/32"}),
+		"invalid cidr":     valid(map[string]interface{}{"ephemeral_network_policy_allowed_cidrs": "10.0.0.0/33"}),
+		"no schema":        valid(map[string]interface{}{"ephemeral_network_rule_schema": ""}),
+		"unqualified":      valid(map[string]interface{}{"ephemeral_network_rule_schema": "network"}),
+		"unknown variable": valid(map[string]interface{}{"ephemeral_network_policy_name_template": "{{role}}_NP"}),
+		"invalid enable":   {"ephemeral_network_policy": "maybe"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseEphemeralNetworkPolicyOptions(config, userProperties{})
+			require.Error(t, err)
+		})
+	}
+
+	_, err = parseEphemeralNetworkPolicyOptions(valid(nil), userProperties{networkPolicy: "corporate"})
+	require.EqualError(t, err, "network_policy and ephemeral_network_policy cannot both be set")
+}
+
+func TestFakeSnowflake_EphemeralNetworkPolicy(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"ephemeral_network_policy":               true,
+		"ephemeral_network_policy_allowed_cidrs": "10.0.0.0/8",
+		"ephemeral_network_rule_schema":          "security.network",
+	})
+
+	createResp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}';",
+	))
+
+	policy := strings.ToUpper(createResp.Username) + "_NETWORK_POLICY"
+	rule, ok := fake.NetworkRule("security.network." + policy)
+	require.True(t, ok)
+	require.Equal(t, "10.0.0.0/8", rule["VALUE_LIST"])
+	require.Equal(t, "INGRESS", strings.ToUpper(rule["MODE"]))
+
+	_, ok = fake.NetworkPolicy(policy)
+	require.True(t, ok)
+	user, _ := fake.User(createResp.Username)
+	require.Equal(t, createResp.Username+"_NETWORK_POLICY", user.Properties["NETWORK_POLICY"])
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: createResp.Username})
+	require.Empty(t, fake.Users())
+	require.Empty(t, fake.NetworkPolicies())
+	require.Empty(t, fake.NetworkRules())
+}
@@ -0,0 +1,90 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+const (
+	defaultEphemeralRoleNameTemplate = "{{name}}_ROLE"
+
+	createEphemeralRoleSQL = "create role {{role}}"
+	grantEphemeralRoleSQL  = "grant role {{role}} to user {{name}}"
+	dropEphemeralRoleSQL   = "drop role if exists {{role}}"
+)
+
+// ephemeralRoleOptions configures a role created for, and dropped with, each
+// user, so grants are scoped to a single lease rather than shared.
+type ephemeralRoleOptions struct {
+	enabled bool
+
+	// nameTemplate renders the role name from the {{name}} of the user. It
+	// may use no other variables, because revocation only knows the user.
+	nameTemplate string
+
+	// grants are statements that grant privileges to {{role}}.
+	grants []string
+}
+
+func parseEphemeralRoleOptions(config map[string]interface{}) (ephemeralRoleOptions, error) {
+	var opts ephemeralRoleOptions
+	var err error
+
+	if opts.enabled, err = getBool(config, "ephemeral_role"); err != nil {
+		return opts, err
+	}
+	if !opts.enabled {
+		return opts, nil
+	}
+
+	if opts.nameTemplate, err = strutil.GetString(config, "ephemeral_role_name_template"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_role_name_template: %w", err)
+	}
+	if opts.nameTemplate == "" {
+		opts.nameTemplate = defaultEphemeralRoleNameTemplate
+	}
+	if err := checkPlaceholders([]string{opts.nameTemplate}, map[string]string{"name": ""}); err != nil {
+		return opts, fmt.Errorf("invalid ephemeral_role_name_template: %w", err)
+	}
+
+	grants, err := strutil.GetString(config, "ephemeral_role_grants")
+	if err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_role_grants: %w", err)
+	}
+	opts.grants = splitStatements(grants)
+
+	return opts, nil
+}
+
+// roleName returns the name of the ephemeral role for the user.
+func (o ephemeralRoleOptions) roleName(username string) string {
+	return dbutil.QueryHelper(o.nameTemplate, map[string]string{"name": username})
+}
+
+// createQueries returns the queries that create the role referenced by the
+// {{role}} template variable, grant it privileges, and grant it to the user.
+// The setup queries run after the role is created and before the grants,
+// so the grants may refer to objects they create.
+func (o ephemeralRoleOptions) createQueries(setup ...string) []string {
+	if !o.enabled {
+		return nil
+	}
+
+	queries := []string{createEphemeralRoleSQL}
+	queries = append(queries, setup...)
+	queries = append(queries, o.grants...)
+	return append(queries, grantEphemeralRoleSQL)
+}
+
+// dropQueries returns the queries that drop the role.
+func (o ephemeralRoleOptions) dropQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{dropEphemeralRoleSQL}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralRoleOptions(t *testing.T) {
+	opts, err := parseEphemeralRoleOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Nil(t, opts.createQueries())
+	require.Nil(t, opts.dropQueries())
+
+	opts, err = parseEphemeralRoleOptions(map[string]interface{}{
+		"ephemeral_role": true,
+		"ephemeral_role_grants": `
+			grant usage on warehouse wh to role {{role}};
+			grant usage on database analytics to role {{role}};`,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "V_USER_ROLE", opts.roleName("V_USER"))
+	require.Equal(t, []string{
+		"create role {{role}}",
+		"grant usage on warehouse wh to role {{role}}",
+		"grant usage on database analytics to role {{role}}",
+		"grant role {{role}} to user {{name}}",
+	}, opts.createQueries())
+	require.Equal(t, []string{"drop role if exists {{role}}"}, opts.dropQueries())
+
+	opts, err = parseEphemeralRoleOptions(map[string]interface{}{
+		"ephemeral_role":               "true",
+		"ephemeral_role_name_template": "LEASE_{{name}}",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "LEASE_V_USER", opts.roleName("V_USER"))
+
+	_, err = parseEphemeralRoleOptions(map[string]interface{}{
+		"ephemeral_role":               true,
+		"ephemeral_role_name_template": "{{role_name}}_{{name}}",
+	})
+	require.Error(t, err)
+}
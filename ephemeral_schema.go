@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+const (
+	defaultEphemeralSchemaNameTemplate = "{{name}}"
+
+	createEphemeralSchemaSQL         = "create schema {{schema}}"
+	grantEphemeralSchemaOwnershipSQL = "grant ownership on schema {{schema}} to role {{role}}"
+	dropEphemeralSchemaSQL           = "drop schema if exists {{schema}} cascade"
+)
+
+// ephemeralSchemaOptions configures a scratch schema created for, and
+// dropped with, each user. Snowflake objects are owned by roles rather than
+// users, so the schema is owned by the user's ephemeral role.
+type ephemeralSchemaOptions struct {
+	enabled  bool
+	database string
+
+	// nameTemplate renders the schema name from the {{name}} of the user.
+	nameTemplate string
+}
+
+func parseEphemeralSchemaOptions(config map[string]interface{}, role ephemeralRoleOptions) (ephemeralSchemaOptions, error) {
+	var opts ephemeralSchemaOptions
+	var err error
+
+	if opts.enabled, err = getBool(config, "ephemeral_schema"); err != nil {
+		return opts, err
+	}
+	if !opts.enabled {
+		return opts, nil
+	}
+	if !role.enabled {
+		return opts, fmt.Errorf("ephemeral_schema requires ephemeral_role, which owns the schema")
+	}
+
+	if opts.database, err = strutil.GetString(config, "ephemeral_schema_database"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_schema_database: %w", err)
+	}
+	if opts.database == "" {
+		return opts, fmt.Errorf("ephemeral_schema_database must be set when ephemeral_schema is enabled")
+	}
+
+	if opts.nameTemplate, err = strutil.GetString(config, "ephemeral_schema_name_template"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_schema_name_template: %w", err)
+	}
+	if opts.nameTemplate == "" {
+		opts.nameTemplate = defaultEphemeralSchemaNameTemplate
+	}
+	if err := checkPlaceholders([]string{opts.nameTemplate}, map[string]string{"name": ""}); err != nil {
+		return opts, fmt.Errorf("invalid ephemeral_schema_name_template: %w", err)
+	}
+
+	return opts, nil
+}
+
+// schemaName returns the qualified name of the user's ephemeral schema.
+func (o ephemeralSchemaOptions) schemaName(username string) string {
+	return identifier(o.database) + "." + dbutil.QueryHelper(o.nameTemplate, map[string]string{"name": username})
+}
+
+// createQueries returns the queries that create the schema referenced by
+// the {{schema}} template variable and hand it to the {{role}} role.
+func (o ephemeralSchemaOptions) createQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{createEphemeralSchemaSQL, grantEphemeralSchemaOwnershipSQL}
+}
+
+// dropQueries returns the queries that drop the schema and its contents.
+func (o ephemeralSchemaOptions) dropQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{dropEphemeralSchemaSQL}
+}
+
+// ephemeralVariables adds the names of the ephemeral objects for the user
+// named in m to the template variables.
+func (s *SnowflakeSQL) ephemeralVariables(m map[string]string) map[string]string {
+	if s.ephemeralRole.enabled {
+		m["role"] = s.ephemeralRole.roleName(m["name"])
+	}
+	if s.ephemeralSchema.enabled {
+		m["schema"] = s.ephemeralSchema.schemaName(m["name"])
+	}
+	if s.ephemeralWarehouse.enabled {
+		m["warehouse"] = s.ephemeralWarehouse.warehouseName(m["name"])
+	}
+	if s.ephemeralNetwork.enabled {
+		m["network_policy"] = s.ephemeralNetwork.policyName(m["name"])
+		m["network_rule"] = s.ephemeralNetwork.ruleName(m["name"])
+	}
+	return m
+}
+
+// ephemeralCreateQueries returns the queries that create the ephemeral
+// objects of a new user.
+func (s *SnowflakeSQL) ephemeralCreateQueries() []string {
+	queries := s.ephemeralRole.createQueries(append(s.ephemeralSchema.createQueries(), s.ephemeralWarehouse.createQueries()...)...)
+	return append(queries, s.ephemeralNetwork.createQueries()...)
+}
+
+// ephemeralDropQueries returns the queries that drop the ephemeral objects
+// of a revoked user. The schema is dropped first, while its owning role
+// still exists.
+func (s *SnowflakeSQL) ephemeralDropQueries() []string {
+	queries := append(s.ephemeralSchema.dropQueries(), s.ephemeralWarehouse.dropQueries()...)
+	queries = append(queries, s.ephemeralRole.dropQueries()...)
+	return append(queries, s.ephemeralNetwork.dropQueries()...)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralSchemaOptions(t *testing.T) {
+	role := ephemeralRoleOptions{enabled: true, nameTemplate: defaultEphemeralRoleNameTemplate}
+
+	opts, err := parseEphemeralSchemaOptions(map[string]interface{}{}, role)
+	require.NoError(t, err)
+	require.Nil(t, opts.createQueries())
+
+	opts, err = parseEphemeralSchemaOptions(map[string]interface{}{
+		"ephemeral_schema":          true,
+		"ephemeral_schema_database": "sandbox",
+	}, role)
+	require.NoError(t, err)
+	require.Equal(t, "sandbox.V_USER", opts.schemaName("V_USER"))
+	require.Equal(t, []string{
+		"create schema {{schema}}",
+		"grant ownership on schema {{schema}} to role {{role}}",
+	}, opts.createQueries())
+	require.Equal(t, []string{"drop schema if exists {{schema}} cascade"}, opts.dropQueries())
+
+	// The schema is created before the role's grants run, so they can
+	// refer to it.
+	role.grants = []string{"grant usage on warehouse wh to role {{role}}"}
+	require.Equal(t, []string{
+		"create role {{role}}",
+		"create schema {{schema}}",
+		"grant ownership on schema {{schema}} to role {{role}}",
+		"grant usage on warehouse wh to role {{role}}",
+		"grant role {{role}} to user {{name}}",
+	}, role.createQueries(opts.createQueries()...))
+
+	_, err = parseEphemeralSchemaOptions(map[string]interface{}{
+		"ephemeral_schema": true,
+	}, role)
+	require.Error(t, err)
+
+	_, err = parseEphemeralSchemaOptions(map[string]interface{}{
+		"ephemeral_schema":          true,
+		"ephemeral_schema_database": "sandbox",
+	}, ephemeralRoleOptions{})
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+const (
+	defaultEphemeralWarehouseNameTemplate = "{{name}}_WH"
+	defaultEphemeralWarehouseSize         = "XSMALL"
+	defaultEphemeralWarehouseAutoSuspend  = time.Minute
+
+	grantEphemeralWarehouseUsageSQL = "grant usage on warehouse {{warehouse}} to role {{role}}"
+	setDefaultWarehouseSQL          = "alter user {{name}} set default_warehouse = {{warehouse}}"
+	dropEphemeralWarehouseSQL       = "drop warehouse if exists {{warehouse}}"
+)
+
+// warehouseSizes are the sizes a standard warehouse can be created with.
+var warehouseSizes = []string{
+	"XSMALL", "SMALL", "MEDIUM", "LARGE", "XLARGE",
+	"XXLARGE", "XXXLARGE", "X4LARGE", "X5LARGE", "X6LARGE",
+}
+
+// ephemeralWarehouseOptions configures a warehouse created for, and dropped
+// with, each user, so that the credits a lease uses are isolated and
+// attributed to it. Usage is granted to the user's ephemeral role, since
+// Snowflake grants privileges to roles rather than users.
+type ephemeralWarehouseOptions struct {
+	enabled bool
+
+	// nameTemplate renders the warehouse name from the {{name}} of the
+	// user.
+	nameTemplate string
+
+	size        string
+	autoSuspend time.Duration
+
+	// resourceMonitor, if set, is assigned to each warehouse to cap the
+	// credits it can use.
+	resourceMonitor string
+}
+
+func parseEphemeralWarehouseOptions(config map[string]interface{}, role ephemeralRoleOptions) (ephemeralWarehouseOptions, error) {
+	var opts ephemeralWarehouseOptions
+	var err error
+
+	if opts.enabled, err = getBool(config, "ephemeral_warehouse"); err != nil {
+		return opts, err
+	}
+	if !opts.enabled {
+		return opts, nil
+	}
+	if !role.enabled {
+		return opts, fmt.Errorf("ephemeral_warehouse requires ephemeral_role, which is granted usage on the warehouse")
+	}
+
+	if opts.nameTemplate, err = strutil.GetString(config, "ephemeral_warehouse_name_template"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_warehouse_name_template: %w", err)
+	}
+	if opts.nameTemplate == "" {
+		opts.nameTemplate = defaultEphemeralWarehouseNameTemplate
+	}
+	if err := checkPlaceholders([]string{opts.nameTemplate}, map[string]string{"name": ""}); err != nil {
+		return opts, fmt.Errorf("invalid ephemeral_warehouse_name_template: %w", err)
+	}
+
+	if opts.size, err = strutil.GetString(config, "ephemeral_warehouse_size"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_warehouse_size: %w", err)
+	}
+	opts.size = strings.ToUpper(strings.ReplaceAll(opts.size, "-", ""))
+	if opts.size == "" {
+		opts.size = defaultEphemeralWarehouseSize
+	}
+	if !strutil.StrListContains(warehouseSizes, opts.size) {
+		return opts, fmt.Errorf("invalid ephemeral_warehouse_size %q: must be one of %s", opts.size, strings.Join(warehouseSizes, ", "))
+	}
+
+	if _, ok := config["ephemeral_warehouse_auto_suspend"]; !ok {
+		opts.autoSuspend = defaultEphemeralWarehouseAutoSuspend
+	} else if opts.autoSuspend, err = getDuration(config, "ephemeral_warehouse_auto_suspend"); err != nil {
+		return opts, err
+	}
+	if opts.autoSuspend%time.Second != 0 {
+		return opts, fmt.Errorf("invalid ephemeral_warehouse_auto_suspend %q: must be a whole number of seconds", opts.autoSuspend)
+	}
+
+	if opts.resourceMonitor, err = strutil.GetString(config, "ephemeral_warehouse_resource_monitor"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve ephemeral_warehouse_resource_monitor: %w", err)
+	}
+
+	return opts, nil
+}
+
+// warehouseName returns the name of the user's ephemeral warehouse.
+func (o ephemeralWarehouseOptions) warehouseName(username string) string {
+	return dbutil.QueryHelper(o.nameTemplate, map[string]string{"name": username})
+}
+
+// createSQL returns the statement that creates the warehouse referenced by
+// the {{warehouse}} template variable. The warehouse starts suspended, so
+// it uses no credits until the user runs a query.
+func (o ephemeralWarehouseOptions) createSQL() string {
+	// Snowflake never suspends a warehouse with an auto_suspend of 0.
+	stmt := fmt.Sprintf("create warehouse {{warehouse}} warehouse_size = %s auto_suspend = %d auto_resume = true initially_suspended = true",
+		o.size, int(o.autoSuspend/time.Second))
+	if o.resourceMonitor != "" {
+		stmt += " resource_monitor = " + identifier(o.resourceMonitor)
+	}
+	return stmt
+}
+
+// createQueries returns the queries that create the warehouse, grant usage
+// on it to the {{role}} role, and make it the user's default.
+func (o ephemeralWarehouseOptions) createQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{o.createSQL(), grantEphemeralWarehouseUsageSQL, setDefaultWarehouseSQL}
+}
+
+// dropQueries returns the queries that drop the warehouse.
+func (o ephemeralWarehouseOptions) dropQueries() []string {
+	if !o.enabled {
+		return nil
+	}
+	return []string{dropEphemeralWarehouseSQL}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralWarehouseOptions(t *testing.T) {
+	role := ephemeralRoleOptions{enabled: true, nameTemplate: defaultEphemeralRoleNameTemplate}
+
+	opts, err := parseEphemeralWarehouseOptions(map[string]interface{}{}, role)
+	require.NoError(t, err)
+	require.Nil(t, opts.createQueries())
+	require.Nil(t, opts.dropQueries())
+
+	opts, err = parseEphemeralWarehouseOptions(map[string]interface{}{"ephemeral_warehouse": true}, role)
+	require.NoError(t, err)
+	require.Equal(t, "V_USER_WH", opts.warehouseName("V_USER"))
+	require.Equal(t, []string{
+		"create warehouse {{warehouse}} warehouse_size = XSMALL auto_suspend = 60 auto_resume = true initially_suspended = true",
+		"grant usage on warehouse {{warehouse}} to role {{role}}",
+		"alter user {{name}} set default_warehouse = {{warehouse}}",
+	}, opts.createQueries())
+	require.Equal(t, []string{"drop warehouse if exists {{warehouse}}"}, opts.dropQueries())
+
+	opts, err = parseEphemeralWarehouseOptions(map[string]interface{}{
+		"ephemeral_warehouse":                  true,
+		"ephemeral_warehouse_name_template":    "WH_{{name}}",
+		"ephemeral_warehouse_size":             "x-small",
+		"ephemeral_warehouse_auto_suspend":     "5m",
+		"ephemeral_warehouse_resource_monitor": "vault-leases",
+	}, role)
+	require.NoError(t, err)
+	require.Equal(t, "WH_V_USER", opts.warehouseName("V_USER"))
+	require.Equal(t, `create warehouse {{warehouse}} warehouse_size = XSMALL auto_suspend = 300 auto_resume = true initially_suspended = true resource_monitor = "vault-leases"`,
+		opts.createSQL())
+
+	for name, config := range map[string]map[string]interface{}{
+		"no role":           {"ephemeral_warehouse": true, "ephemeral_role": false},
+		"size":              {"ephemeral_warehouse": true, "ephemeral_warehouse_size": "huge"},
+		"partial seconds":   {"ephemeral_warehouse": true, "ephemeral_warehouse_auto_suspend": "1.5s"},
+		"negative suspend":  {"ephemeral_warehouse": true, "ephemeral_warehouse_auto_suspend": "-1s"},
+		"unknown variable":  {"ephemeral_warehouse": true, "ephemeral_warehouse_name_template": "{{role}}_WH"},
+		"invalid enable":    {"ephemeral_warehouse": "maybe"},
+		"invalid template":  {"ephemeral_warehouse": true, "ephemeral_warehouse_name_template": 42},
+		"invalid resources": {"ephemeral_warehouse": true, "ephemeral_warehouse_resource_monitor": []int{1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := role
+			if name == "no role" {
+				r = ephemeralRoleOptions{}
+			}
+			_, err := parseEphemeralWarehouseOptions(config, r)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestFakeSnowflake_EphemeralWarehouse(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"ephemeral_role":                       true,
+		"ephemeral_warehouse":                  true,
+		"ephemeral_warehouse_resource_monitor": "vault_leases",
+	})
+
+	createResp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}' DEFAULT_ROLE = {{role}};",
+	))
+
+	name := strings.ToUpper(createResp.Username)
+	warehouse, ok := fake.Warehouse(name + "_WH")
+	require.True(t, ok)
+	require.Equal(t, "XSMALL", warehouse["WAREHOUSE_SIZE"])
+	require.Equal(t, "vault_leases", warehouse["RESOURCE_MONITOR"])
+	require.Equal(t, "true", warehouse["INITIALLY_SUSPENDED"])
+	require.Contains(t, fake.Grants(), "grant usage on warehouse "+createResp.Username+"_WH to role "+createResp.Username+"_ROLE")
+
+	user, _ := fake.User(createResp.Username)
+	require.Equal(t, createResp.Username+"_WH", user.Properties["DEFAULT_WAREHOUSE"])
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: createResp.Username})
+	require.Empty(t, fake.Users())
+	require.Empty(t, fake.Warehouses())
+	require.Equal(t, []string{"PUBLIC"}, fake.Roles())
+}
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+type errorClass struct {
+	retryable bool
+	reason    string
+}
+
+// snowflakeErrorClasses maps Snowflake error numbers to whether retrying
+// the operation can succeed without someone changing the account or the
+// plugin configuration first.
+var snowflakeErrorClasses = map[int]errorClass{
+	// Sessions and statements
+	gosnowflake.ErrSessionGone: {retryable: true, reason: "session no longer exists"},
+	390112:                     {retryable: true, reason: "session expired"},
+	390114:                     {retryable: true, reason: "authentication token expired"},
+	604:                        {retryable: true, reason: "statement canceled"},
+	630:                        {retryable: true, reason: "statement timed out"},
+
+	// Driver
+	gosnowflake.ErrCodeServiceUnavailable:   {retryable: true, reason: "service unavailable"},
+	gosnowflake.ErrCodeFailedToConnect:      {retryable: true, reason: "failed to connect"},
+	gosnowflake.ErrCodePrivateKeyParseError: {reason: "invalid private key"},
+
+	// Authentication
+	390100: {reason: "incorrect username or password"},
+	390144: {reason: "invalid JWT"},
+
+	// Objects and privileges
+	gosnowflake.ErrRoleNotExist:               {reason: "role does not exist"},
+	gosnowflake.ErrObjectNotExistOrAuthorized: {reason: "object does not exist or not authorized"},
+
+	1003:  {reason: "SQL compilation error"},
+	2003:  {reason: "object does not exist or not authorized"},
+	3001:  {reason: "insufficient privileges"},
+	90073: {reason: "insufficient privileges"},
+}
+
+// classifiedError is an error from a user operation annotated with whether
+// retrying it can succeed. Vault's database plugin protocol carries only
+// the message, so the classification is part of it. Terminal errors also
+// match logical.ErrUnrecoverable with errors.Is.
+type classifiedError struct {
+	Retryable bool
+	Reason    string
+
+	err error
+}
+
+func (e *classifiedError) Error() string {
+	if e.Retryable {
+		return fmt.Sprintf("%v (retryable: %s)", e.err, e.Reason)
+	}
+	return fmt.Sprintf("%v (not retryable: %s)", e.err, e.Reason)
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return !e.Retryable && target == logical.ErrUnrecoverable
+}
+
+// classifyError wraps err in a classifiedError if it is one the plugin
+// knows to be retryable or terminal. Other errors, including a cancelled
+// request, are returned unchanged.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	class, ok := errorClassOf(err)
+	if !ok {
+		return err
+	}
+	return &classifiedError{Retryable: class.retryable, Reason: class.reason, err: err}
+}
+
+func errorClassOf(err error) (errorClass, bool) {
+	var sfErr *gosnowflake.SnowflakeError
+	if errors.As(err, &sfErr) {
+		class, ok := snowflakeErrorClasses[sfErr.Number]
+		return class, ok
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorClass{retryable: true, reason: "timed out"}, true
+	case errors.Is(err, driver.ErrBadConn):
+		return errorClass{retryable: true, reason: "connection lost"}, true
+	case errors.As(err, &netErr):
+		return errorClass{retryable: true, reason: "network error"}, true
+	}
+	return errorClass{}, false
+}
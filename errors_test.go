@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	sessionGone := &gosnowflake.SnowflakeError{Number: gosnowflake.ErrSessionGone, Message: "Session no longer exists."}
+	noPrivileges := &gosnowflake.SnowflakeError{Number: 3001, Message: "Insufficient privileges to operate on user"}
+
+	tests := map[string]struct {
+		err       error
+		retryable bool
+		reason    string
+	}{
+		"session gone":      {err: sessionGone, retryable: true, reason: "session no longer exists"},
+		"token expired":     {err: &gosnowflake.SnowflakeError{Number: 390114}, retryable: true, reason: "authentication token expired"},
+		"wrapped":           {err: fmt.Errorf("failed to execute query: %w", sessionGone), retryable: true, reason: "session no longer exists"},
+		"deadline":          {err: context.DeadlineExceeded, retryable: true, reason: "timed out"},
+		"bad connection":    {err: driver.ErrBadConn, retryable: true, reason: "connection lost"},
+		"no privileges":     {err: noPrivileges, reason: "insufficient privileges"},
+		"does not exist":    {err: &gosnowflake.SnowflakeError{Number: 2003}, reason: "object does not exist or not authorized"},
+		"bad password":      {err: &gosnowflake.SnowflakeError{Number: 390100}, reason: "incorrect username or password"},
+		"invalid statement": {err: &gosnowflake.SnowflakeError{Number: 1003}, reason: "SQL compilation error"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := classifyError(tt.err)
+
+			var classified *classifiedError
+			require.ErrorAs(t, err, &classified)
+			require.Equal(t, tt.retryable, classified.Retryable)
+			require.Equal(t, tt.reason, classified.Reason)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, !tt.retryable, errors.Is(err, logical.ErrUnrecoverable))
+			require.Same(t, err, classifyError(err), "errors should only be classified once")
+		})
+	}
+
+	for _, err := range []error{nil, context.Canceled, errors.New("unknown"), &gosnowflake.SnowflakeError{Number: 1}} {
+		require.Equal(t, err, classifyError(err))
+	}
+}
+
+func TestClassifiedError_Error(t *testing.T) {
+	err := classifyError(errors.Join(errors.New("unable to drop user"), &gosnowflake.SnowflakeError{Number: 3001}))
+	require.Contains(t, err.Error(), "unable to drop user")
+	require.True(t, strings.HasSuffix(err.Error(), " (not retryable: insufficient privileges)"), err.Error())
+
+	err = classifyError(context.DeadlineExceeded)
+	require.EqualError(t, err, "context deadline exceeded (retryable: timed out)")
+}
+
+func TestSnowflakeSQL_DeleteUser_ClassifiesErrors(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+	fake.FailOn("DROP USER", &gosnowflake.SnowflakeError{
+		Number:  3001,
+		Message: "Insufficient privileges to operate on user 'VAULT_USER'",
+	})
+
+	_, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "vault_user"})
+	require.ErrorIs(t, err, logical.ErrUnrecoverable)
+	require.Contains(t, err.Error(), "(not retryable: insufficient privileges)")
+
+	fake.ClearFailures()
+	fake.FailOn("DROP USER", &gosnowflake.SnowflakeError{Number: gosnowflake.ErrSessionGone})
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "vault_user"})
+	require.NotErrorIs(t, err, logical.ErrUnrecoverable)
+	require.Contains(t, err.Error(), "(retryable: session no longer exists)")
+}
@@ -0,0 +1,153 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// failoverRetryInterval is how long connections keep going to a failover
+// account before the primary is tried again.
+const failoverRetryInterval = time.Minute
+
+func parseFailoverConnectionURLs(config map[string]interface{}) ([]string, error) {
+	raw, ok := config["failover_connection_urls"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	urls, err := parseutil.ParseCommaStringSlice(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve failover_connection_urls: %w", err)
+	}
+	for i, u := range urls {
+		if u == "" {
+			return nil, fmt.Errorf("invalid failover_connection_urls[%d]: must not be empty", i)
+		}
+		if urls[i], err = stripURLScheme(fmt.Sprintf("failover_connection_urls[%d]", i), u); err != nil {
+			return nil, err
+		}
+	}
+	return urls, nil
+}
+
+// renderFailoverURLs returns the DSNs of the failover accounts, with the
+// credentials and the options applied as they are to the connection URL.
+func (s *SnowflakeSQL) renderFailoverURLs(opts connectionOptions) ([]string, error) {
+	if len(opts.failoverURLs) == 0 {
+		return nil, nil
+	}
+
+	dsns := make([]string, 0, len(opts.failoverURLs))
+	for i, u := range opts.failoverURLs {
+		// Substitute the credentials the way the connection producer does
+		// for the connection URL.
+		dsn := dbutil.QueryHelper(u, map[string]string{
+			"username": s.Username,
+			"password": url.PathEscape(s.Password),
+		})
+		dsn, err := opts.connectionURL(dsn, s.Username)
+		if err != nil {
+			return nil, fmt.Errorf("invalid failover_connection_urls[%d]: %w", i, err)
+		}
+		dsns = append(dsns, dsn)
+	}
+	return dsns, nil
+}
+
+// failover is a connector for a primary account and its failover accounts,
+// for accounts replicated with Snowflake's account replication. A new
+// connection goes to the first account in order that is reachable. Once a
+// failover account has been used, new connections go to it until
+// failoverRetryInterval passes, so that an unreachable primary does not
+// delay every connection.
+type failover struct {
+	connectors []driver.Connector
+
+	mu             sync.Mutex
+	active         int
+	retryPrimaryAt time.Time
+}
+
+var _ driver.Connector = (*failover)(nil)
+
+func (f *failover) Connect(ctx context.Context) (driver.Conn, error) {
+	var errs []error
+	for _, i := range f.order(time.Now()) {
+		conn, err := f.connectors[i].Connect(ctx)
+		if err == nil {
+			f.connected(i, time.Now())
+			return conn, nil
+		}
+		if ctx.Err() != nil || !isUnreachable(err) {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no account is reachable: %w", errors.Join(errs...))
+}
+
+func (f *failover) Driver() driver.Driver {
+	return gosnowflake.SnowflakeDriver{}
+}
+
+// order returns the indexes of the accounts to try at now, starting with
+// the active one.
+func (f *failover) order(now time.Time) []int {
+	f.mu.Lock()
+	start := f.active
+	if now.After(f.retryPrimaryAt) {
+		start = 0
+	}
+	f.mu.Unlock()
+
+	order := make([]int, 0, len(f.connectors))
+	for i := range f.connectors {
+		order = append(order, (start+i)%len(f.connectors))
+	}
+	return order
+}
+
+func (f *failover) connected(i int, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i == 0 {
+		f.active = 0
+		return
+	}
+	if i != f.active {
+		emitConnectionFailover()
+	}
+	if i != f.active || now.After(f.retryPrimaryAt) {
+		// The accounts before this one were just found unreachable.
+		f.retryPrimaryAt = now.Add(failoverRetryInterval)
+	}
+	f.active = i
+}
+
+// isUnreachable reports whether err from connecting means the account could
+// not be reached, rather than that it refused the login.
+func isUnreachable(err error) bool {
+	var sfErr *gosnowflake.SnowflakeError
+	if errors.As(err, &sfErr) {
+		switch sfErr.Number {
+		case gosnowflake.ErrCodeFailedToConnect, gosnowflake.ErrCodeServiceUnavailable:
+			return true
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
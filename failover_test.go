@@ -0,0 +1,169 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+// stubConnector fails with err, or connects if err is nil.
+type stubConnector struct {
+	err   error
+	calls int
+}
+
+type stubConn struct {
+	driver.Conn
+}
+
+func (c *stubConnector) Connect(context.Context) (driver.Conn, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return stubConn{}, nil
+}
+
+func (c *stubConnector) Driver() driver.Driver {
+	return gosnowflake.SnowflakeDriver{}
+}
+
+func TestFailover_Connect(t *testing.T) {
+	unreachable := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	primary, secondary := &stubConnector{err: unreachable}, &stubConnector{}
+	f := &failover{connectors: []driver.Connector{primary, secondary}}
+
+	_, err := f.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, primary.calls)
+	require.Equal(t, 1, secondary.calls)
+
+	// The primary is not retried until the interval passes.
+	_, err = f.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, primary.calls)
+	require.Equal(t, []int{1, 0}, f.order(time.Now()))
+
+	primary.err = nil
+	require.Equal(t, []int{0, 1}, f.order(time.Now().Add(failoverRetryInterval+time.Second)))
+	f.retryPrimaryAt = time.Time{}
+	_, err = f.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, primary.calls)
+	require.Equal(t, 0, f.active)
+}
+
+func TestFailover_Connect_Refused(t *testing.T) {
+	refused := &gosnowflake.SnowflakeError{Number: 390100, Message: "Incorrect username or password was specified."}
+	primary, secondary := &stubConnector{err: refused}, &stubConnector{}
+	f := &failover{connectors: []driver.Connector{primary, secondary}}
+
+	_, err := f.Connect(context.Background())
+	require.ErrorIs(t, err, refused)
+	require.Zero(t, secondary.calls, "a refused login should not fail over")
+
+	primary.err = &net.DNSError{Err: "no such host", Name: "primary.invalid"}
+	secondary.err = &gosnowflake.SnowflakeError{Number: gosnowflake.ErrCodeFailedToConnect}
+	_, err = f.Connect(context.Background())
+	require.ErrorContains(t, err, "no account is reachable")
+}
+
+func TestIsUnreachable(t *testing.T) {
+	require.True(t, isUnreachable(&net.DNSError{Err: "no such host"}))
+	require.True(t, isUnreachable(context.DeadlineExceeded))
+	require.True(t, isUnreachable(&gosnowflake.SnowflakeError{Number: gosnowflake.ErrCodeServiceUnavailable}))
+	require.False(t, isUnreachable(&gosnowflake.SnowflakeError{Number: 390100}))
+	require.False(t, isUnreachable(errors.New("unknown")))
+}
+
+func TestSnowflakeSQL_Initialize_FailoverConnectionURLs(t *testing.T) {
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":           "{{username}}:{{password}}@myorg-primary/db",
+			"failover_connection_urls": []interface{}{"{{username}}:{{password}}@myorg-secondary/db"},
+			"username":                 "vault",
+			"password":                 "s3cr/t",
+			"region":                   "us-east-2.aws",
+			"lazy_connection":          true,
+		},
+	})
+	require.Equal(t, []string{"vault:s3cr%2Ft@myorg-secondary/db?region=us-east-2.aws"}, db.failoverDSNs)
+
+	connector, err := cachedDriver{}.OpenConnector(db.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, &failover{}, connector)
+	require.Len(t, connector.(*failover).connectors, 2)
+
+	secrets := db.secretValues()
+	require.Contains(t, secrets, db.failoverDSNs[0])
+
+	// Vault starts the instance for a rewritten config before it closes the
+	// old one, so removing the failover accounts must not conflict with the
+	// config the first instance still holds.
+	other := new()
+	defer dbtesting.AssertClose(t, other)
+	dbtesting.AssertInitialize(t, other, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":  "{{username}}:{{password}}@myorg-primary/db",
+			"username":        "vault",
+			"password":        "s3cr/t",
+			"region":          "us-east-2.aws",
+			"lazy_connection": true,
+		},
+	})
+	require.NotEqual(t, db.cachedKey, other.cachedKey)
+
+	connector, err = cachedDriver{}.OpenConnector(other.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, gosnowflake.Connector{}, connector)
+
+	connector, err = cachedDriver{}.OpenConnector(db.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, &failover{}, connector, "the first instance should keep its failover accounts")
+
+	// Reinitializing without failover accounts replaces the cached entry.
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":  "{{username}}:{{password}}@myorg-primary/db",
+			"username":        "vault",
+			"password":        "s3cr/t",
+			"region":          "us-east-2.aws",
+			"lazy_connection": true,
+		},
+	})
+	require.Equal(t, other.cachedKey, db.cachedKey)
+	connector, err = cachedDriver{}.OpenConnector(db.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, gosnowflake.Connector{}, connector)
+}
+
+func TestParseFailoverConnectionURLs(t *testing.T) {
+	urls, err := parseFailoverConnectionURLs(map[string]interface{}{"failover_connection_urls": "a/db,b/db"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/db", "b/db"}, urls)
+
+	urls, err = parseFailoverConnectionURLs(map[string]interface{}{"failover_connection_urls": "https://a/db"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/db"}, urls)
+
+	_, err = parseFailoverConnectionURLs(map[string]interface{}{"failover_connection_urls": "a/db,http://b/db"})
+	require.ErrorContains(t, err, `invalid failover_connection_urls[1]: unsupported scheme "http"`)
+
+	urls, err = parseFailoverConnectionURLs(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Empty(t, urls)
+}
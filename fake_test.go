@@ -0,0 +1,258 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault-plugin-database-snowflake/snowflaketest"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeSnowflake returns a plugin initialized with config, connected to
+// a fake Snowflake account.
+func newFakeSnowflake(t *testing.T, config map[string]interface{}) (*SnowflakeSQL, *snowflaketest.Fake) {
+	t.Helper()
+
+	fake := snowflaketest.NewFake()
+	db := new()
+	db.SQLConnectionProducer.Type = fake.DriverName()
+	t.Cleanup(func() { dbtesting.AssertClose(t, db) })
+
+	conf := map[string]interface{}{
+		"connection_url": "vault:password@fake/db",
+	}
+	for k, v := range config {
+		conf[k] = v
+	}
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{
+		Config:           conf,
+		VerifyConnection: true,
+	})
+	return db, fake
+}
+
+func fakeNewUserRequest(statements ...string) dbplugin.NewUserRequest {
+	return dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "token",
+			RoleName:    "analyst",
+		},
+		Statements: dbplugin.Statements{
+			Commands: statements,
+		},
+		CredentialType: dbplugin.CredentialTypePassword,
+		Password:       "y8fva_sdVA3rasf",
+		Expiration:     time.Now().Add(48 * time.Hour),
+	}
+}
+
+func TestFakeSnowflake_PasswordUserLifecycle(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"user_type":       "legacy_service",
+		"user_tags":       map[string]interface{}{"owner": "{{role_name}}"},
+		"password_policy": "security.policies.vault",
+	})
+
+	createResp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}' DAYS_TO_EXPIRY = {{expiration}};\nGRANT ROLE public TO USER {{name}};",
+	))
+
+	user, ok := fake.User(createResp.Username)
+	require.True(t, ok, "user should have been created")
+	require.Equal(t, "y8fva_sdVA3rasf", user.Properties["PASSWORD"])
+	require.Equal(t, "1", user.Properties["DAYS_TO_EXPIRY"])
+	require.Equal(t, "LEGACY_SERVICE", user.Properties["TYPE"])
+	require.Equal(t, map[string]string{"OWNER": "analyst"}, user.Tags)
+	require.Equal(t, []string{"PUBLIC"}, user.Roles)
+	require.Equal(t, "SECURITY.POLICIES.VAULT", user.PasswordPolicy)
+
+	dbtesting.AssertUpdateUser(t, db, dbplugin.UpdateUserRequest{
+		Username: createResp.Username,
+		Password: &dbplugin.ChangePassword{NewPassword: "new_password"},
+	})
+	expiration := time.Now().Add(72 * time.Hour)
+	dbtesting.AssertUpdateUser(t, db, dbplugin.UpdateUserRequest{
+		Username:   createResp.Username,
+		Expiration: &dbplugin.ChangeExpiration{NewExpiration: expiration},
+	})
+
+	user, _ = fake.User(createResp.Username)
+	require.Equal(t, "new_password", user.Properties["PASSWORD"])
+	require.Equal(t, "2", user.Properties["DAYS_TO_EXPIRY"])
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: createResp.Username})
+	require.Empty(t, fake.Users())
+}
+
+func TestFakeSnowflake_RSAUserLifecycle(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+
+	pub, _ := snowflaketest.GenerateRSAKeyPair(t, 2048)
+	req := fakeNewUserRequest("CREATE USER {{name}} RSA_PUBLIC_KEY = '{{public_key}}';")
+	req.CredentialType = dbplugin.CredentialTypeRSAPrivateKey
+	req.PublicKey = pub
+	createResp := dbtesting.AssertNewUser(t, db, req)
+
+	fingerprint, err := publicKeyFingerprint(pub)
+	require.NoError(t, err)
+	user, ok := fake.User(createResp.Username)
+	require.True(t, ok)
+	require.Equal(t, preparePublicKey(string(pub)), user.Properties["RSA_PUBLIC_KEY"])
+
+	newPub, _ := snowflaketest.GenerateRSAKeyPair(t, 2048)
+	dbtesting.AssertUpdateUser(t, db, dbplugin.UpdateUserRequest{
+		Username:  createResp.Username,
+		PublicKey: &dbplugin.ChangePublicKey{NewPublicKey: newPub},
+	})
+	newFingerprint, err := publicKeyFingerprint(newPub)
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, newFingerprint)
+
+	user, _ = fake.User(createResp.Username)
+	require.Equal(t, preparePublicKey(string(newPub)), user.Properties["RSA_PUBLIC_KEY"])
+}
+
+func TestFakeSnowflake_PublicKeyNotSet(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+
+	// Statements that never set the key must not yield a credential that
+	// cannot log in.
+	pub, _ := snowflaketest.GenerateRSAKeyPair(t, 2048)
+	req := fakeNewUserRequest("CREATE USER {{name}} COMMENT = '{{public_key}}';")
+	req.CredentialType = dbplugin.CredentialTypeRSAPrivateKey
+	req.PublicKey = pub
+
+	_, err := db.NewUser(context.Background(), req)
+	require.ErrorContains(t, err, "fingerprint")
+	require.Empty(t, fake.Users())
+}
+
+func TestFakeSnowflake_PartialCreationCleanup(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+
+	fake.FailOn("grant role", errors.New("insufficient privileges"))
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}';",
+		"GRANT ROLE public TO USER {{name}};",
+	))
+	require.ErrorContains(t, err, "insufficient privileges")
+	require.Empty(t, fake.Users(), "partially created user should have been dropped")
+	require.Empty(t, db.journal.list())
+}
+
+func TestFakeSnowflake_FailureBeforeCreateKeepsExistingUser(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"username_template": "{{.DisplayName}}_{{.RoleName}}",
+	})
+	existing := dbtesting.AssertNewUser(t, db, fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}';"))
+
+	// The request fails before its CREATE USER runs, so the user with its
+	// name belongs to someone else.
+	fake.FailOn("use role", errors.New("insufficient privileges"))
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+		"USE ROLE useradmin;\nCREATE USER {{name}} PASSWORD = '{{password}}';\nGRANT ROLE public TO USER {{name}};",
+	))
+	require.ErrorContains(t, err, "insufficient privileges")
+	_, ok := fake.User(existing.Username)
+	require.True(t, ok, "a user the request did not create should not be dropped")
+	require.Empty(t, db.journal.list())
+
+	// Once the CREATE USER has run, a later failure in the same block drops
+	// the user.
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: existing.Username})
+	fake.ClearFailures()
+	fake.FailOn("grant role", errors.New("insufficient privileges"))
+	_, err = db.NewUser(context.Background(), fakeNewUserRequest(
+		"USE ROLE useradmin;\nCREATE USER {{name}} PASSWORD = '{{password}}';\nGRANT ROLE public TO USER {{name}};",
+	))
+	require.ErrorContains(t, err, "insufficient privileges")
+	require.Empty(t, fake.Users())
+	require.Empty(t, db.journal.list())
+}
+
+func TestFakeSnowflake_CreateUserAppliedBeforeTimeout(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"username_template": "{{.DisplayName}}_{{.RoleName}}",
+	})
+	conn, err := fake.Open()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Snowflake applies the CREATE USER, but the request times out before
+	// its result arrives.
+	var applied bool
+	fake.FailOnFunc("create user", func() error {
+		if applied {
+			return nil
+		}
+		applied = true
+		if _, err := conn.Exec("CREATE USER token_analyst PASSWORD = 'y8fva_sdVA3rasf'"); err != nil {
+			return err
+		}
+		return os.ErrDeadlineExceeded
+	})
+	_, err = db.NewUser(context.Background(), fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}';"))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.Empty(t, fake.Users(), "a user the timed out request created should have been dropped")
+	require.Empty(t, db.journal.list())
+
+	// A CREATE USER that timed out without being applied leaves nothing to
+	// drop.
+	fake.ClearFailures()
+	fake.FailOn("create user", os.ErrDeadlineExceeded)
+	_, err = db.NewUser(context.Background(), fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}';"))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.Empty(t, db.journal.list())
+}
+
+func TestFakeSnowflake_CreateUserIfNotExistsKeepsExistingUser(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"username_template": "{{.DisplayName}}_{{.RoleName}}",
+	})
+	existing := dbtesting.AssertNewUser(t, db, fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}';"))
+
+	fake.FailOn("grant role", errors.New("insufficient privileges"))
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+		"CREATE USER IF NOT EXISTS {{name}} PASSWORD = '{{password}}';\nGRANT ROLE public TO USER {{name}};",
+	))
+	require.ErrorContains(t, err, "insufficient privileges")
+	_, ok := fake.User(existing.Username)
+	require.True(t, ok, "a user that existed before CREATE USER IF NOT EXISTS should not be dropped")
+	require.Empty(t, db.journal.list())
+}
+
+func TestFakeSnowflake_EphemeralRoleAndSchema(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"ephemeral_role":            true,
+		"ephemeral_role_grants":     "grant usage on warehouse wh to role {{role}}",
+		"ephemeral_schema":          true,
+		"ephemeral_schema_database": "scratch",
+	})
+
+	createResp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}' DEFAULT_ROLE = {{role}};",
+	))
+
+	// Unquoted names are stored upper-cased.
+	name := strings.ToUpper(createResp.Username)
+	role := name + "_ROLE"
+	user, ok := fake.User(createResp.Username)
+	require.True(t, ok)
+	require.Equal(t, []string{role}, user.Roles)
+	require.Contains(t, fake.Roles(), role)
+	require.Equal(t, []string{"SCRATCH." + name}, fake.Schemas())
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: createResp.Username})
+	require.Empty(t, fake.Users())
+	require.Equal(t, []string{"PUBLIC"}, fake.Roles())
+	require.Empty(t, fake.Schemas())
+}
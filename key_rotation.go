@@ -0,0 +1,278 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	describeUserSQL = "describe user %s"
+
+	setRSAPublicKey2SQL    = `alter user {{name}} set RSA_PUBLIC_KEY_2 = '{{public_key}}'`
+	promoteRSAPublicKeySQL = `alter user {{name}} set RSA_PUBLIC_KEY = '{{public_key}}'`
+	unsetRSAPublicKey2SQL  = `alter user {{name}} unset RSA_PUBLIC_KEY_2`
+)
+
+// keyRotationOptions configures dual-key rotation of RSA public keys.
+type keyRotationOptions struct {
+	dualKey     bool
+	gracePeriod time.Duration
+}
+
+func parseKeyRotationOptions(config map[string]interface{}) (keyRotationOptions, error) {
+	var opts keyRotationOptions
+	var err error
+
+	if opts.dualKey, err = getBool(config, "dual_key_rotation"); err != nil {
+		return opts, err
+	}
+	if opts.gracePeriod, err = getDuration(config, "dual_key_rotation_grace_period"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// userKeys are the RSA public keys set on a user, as shown by DESCRIBE USER.
+type userKeys struct {
+	keyFP  string
+	key2   string
+	key2FP string
+}
+
+func describeUserKeys(ctx context.Context, tx Tx, username string) (userKeys, error) {
+	var keys userKeys
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(describeUserSQL, username))
+	if err != nil {
+		return keys, fmt.Errorf("failed to describe user: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return keys, err
+	}
+	propertyIdx, valueIdx := -1, -1
+	for i, column := range columns {
+		switch strings.ToLower(column) {
+		case "property":
+			propertyIdx = i
+		case "value":
+			valueIdx = i
+		}
+	}
+	if propertyIdx < 0 || valueIdx < 0 {
+		return keys, fmt.Errorf("unexpected columns describing user: %v", columns)
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return keys, err
+		}
+
+		value := values[valueIdx].String
+		if value == "null" {
+			value = ""
+		}
+		switch values[propertyIdx].String {
+		case "RSA_PUBLIC_KEY_FP":
+			keys.keyFP = value
+		case "RSA_PUBLIC_KEY_2":
+			keys.key2 = value
+		case "RSA_PUBLIC_KEY_2_FP":
+			keys.key2FP = value
+		}
+	}
+
+	return keys, rows.Err()
+}
+
+// verifyPublicKey checks that Snowflake reports fingerprint for one of the
+// user's RSA public keys, so a key that was silently not set fails the
+// request rather than a later login. username is as the plugin's
+// statements refer to it, quoted if usernames are.
+func verifyPublicKey(ctx context.Context, tx Tx, username, fingerprint string) error {
+	keys, err := describeUserKeys(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	if keys.keyFP != fingerprint && keys.key2FP != fingerprint {
+		return fmt.Errorf("public key fingerprint %q does not match any RSA public key Snowflake reports for the user", fingerprint)
+	}
+	return nil
+}
+
+// publicKeyFingerprint returns the fingerprint Snowflake reports for a PEM
+// encoded public key.
+func publicKeyFingerprint(publicKey []byte) (string, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return "", fmt.Errorf("public key is not PEM encoded")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// keyPromotions tracks the pending promotions of RSA_PUBLIC_KEY_2 into
+// RSA_PUBLIC_KEY, keyed by username.
+type keyPromotions struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func (p *keyPromotions) schedule(username string, after time.Duration, promote func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timers == nil {
+		p.timers = map[string]*time.Timer{}
+	}
+	if t, ok := p.timers[username]; ok {
+		t.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(after, func() {
+		p.mu.Lock()
+		if p.timers[username] == t {
+			delete(p.timers, username)
+		}
+		p.mu.Unlock()
+		promote()
+	})
+	p.timers[username] = t
+}
+
+func (p *keyPromotions) cancel(username string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.timers[username]; ok {
+		t.Stop()
+		delete(p.timers, username)
+	}
+}
+
+// stop cancels every pending promotion. Users keep both keys until their
+// next rotation, which promotes the pending key first.
+func (p *keyPromotions) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for username, t := range p.timers {
+		t.Stop()
+		delete(p.timers, username)
+	}
+}
+
+// rotatePublicKeyDual replaces a user's RSA public key without a moment
+// where neither the old nor the new key works. The new key is set as
+// RSA_PUBLIC_KEY_2 and checked against the fingerprint Snowflake reports,
+// then moved into RSA_PUBLIC_KEY, replacing the old key, once the grace
+// period has passed.
+func (s *SnowflakeSQL) rotatePublicKeyDual(ctx context.Context, tx Tx, username string, publicKey []byte) error {
+	fingerprint, err := publicKeyFingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+
+	// Finish a rotation whose promotion never ran, so its key is kept
+	// rather than overwritten.
+	s.keyPromotions.cancel(username)
+	user := s.usernameOptions.identifier(username)
+	keys, err := describeUserKeys(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	if keys.key2 != "" {
+		if err := promotePublicKey(ctx, tx, user, keys.key2); err != nil {
+			return err
+		}
+	}
+
+	m := map[string]string{
+		"name":       user,
+		"public_key": preparePublicKey(string(publicKey)),
+	}
+	if err := execQuery(ctx, tx, m, setRSAPublicKey2SQL); err != nil {
+		return fmt.Errorf("failed to set RSA_PUBLIC_KEY_2: %w", err)
+	}
+
+	keys, err = describeUserKeys(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	if keys.key2FP != fingerprint {
+		if err := execQuery(ctx, tx, m, unsetRSAPublicKey2SQL); err != nil {
+			s.logger.Error("failed to unset unverified RSA_PUBLIC_KEY_2", "username", username, "error", err)
+		}
+		return fmt.Errorf("new public key fingerprint %q does not match %q reported by Snowflake", fingerprint, keys.key2FP)
+	}
+
+	if s.keyRotation.gracePeriod == 0 {
+		return promotePublicKey(ctx, tx, user, m["public_key"])
+	}
+
+	s.keyPromotions.schedule(username, s.keyRotation.gracePeriod, func() {
+		s.runKeyPromotion(username, m["public_key"])
+	})
+	return nil
+}
+
+func (s *SnowflakeSQL) runKeyPromotion(username, publicKey string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	err := func() error {
+		db, err := s.getConnection(ctx)
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := promotePublicKey(ctx, tx, s.usernameOptions.identifier(username), publicKey); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		s.logger.Error("failed to retire previous RSA public key, both keys remain valid until the next rotation",
+			"username", username, "error", err)
+	}
+}
+
+// promotePublicKey moves publicKey, the user's RSA_PUBLIC_KEY_2, into
+// RSA_PUBLIC_KEY and clears RSA_PUBLIC_KEY_2. username is as for
+// verifyPublicKey.
+func promotePublicKey(ctx context.Context, tx Tx, username, publicKey string) error {
+	m := map[string]string{
+		"name":       username,
+		"public_key": publicKey,
+	}
+	if err := execQuery(ctx, tx, m, promoteRSAPublicKeySQL); err != nil {
+		return fmt.Errorf("failed to replace RSA_PUBLIC_KEY: %w", err)
+	}
+	if err := execQuery(ctx, tx, m, unsetRSAPublicKey2SQL); err != nil {
+		return fmt.Errorf("failed to unset RSA_PUBLIC_KEY_2: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault-plugin-database-snowflake/snowflaketest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicKeyFingerprint(t *testing.T) {
+	key := testPrivateKey(t)
+	pub, _ := snowflaketest.GenerateRSAKeyPair(t, 2048)
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	sum := sha256.Sum256(der)
+
+	fp, err := publicKeyFingerprint(pemPublicKey(t, der))
+	require.NoError(t, err)
+	require.Equal(t, "SHA256:"+base64.StdEncoding.EncodeToString(sum[:]), fp)
+
+	other, err := publicKeyFingerprint(pub)
+	require.NoError(t, err)
+	require.NotEqual(t, fp, other)
+
+	_, err = publicKeyFingerprint([]byte("not a key"))
+	require.Error(t, err)
+}
+
+func TestKeyPromotions(t *testing.T) {
+	var p keyPromotions
+	var promoted atomic.Int32
+
+	p.schedule("cancelled", 10*time.Millisecond, func() { promoted.Add(100) })
+	p.cancel("cancelled")
+
+	p.schedule("replaced", time.Hour, func() { promoted.Add(100) })
+	p.schedule("replaced", 10*time.Millisecond, func() { promoted.Add(1) })
+
+	require.Eventually(t, func() bool { return promoted.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, int32(1), promoted.Load())
+
+	p.schedule("stopped", 10*time.Millisecond, func() { promoted.Add(100) })
+	p.stop()
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, int32(1), promoted.Load())
+}
+
+func TestParseKeyRotationOptions(t *testing.T) {
+	opts, err := parseKeyRotationOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Equal(t, keyRotationOptions{}, opts)
+
+	opts, err = parseKeyRotationOptions(map[string]interface{}{
+		"dual_key_rotation":              true,
+		"dual_key_rotation_grace_period": "15m",
+	})
+	require.NoError(t, err)
+	require.Equal(t, keyRotationOptions{dualKey: true, gracePeriod: 15 * time.Minute}, opts)
+}
+
+func pemPublicKey(t *testing.T, der []byte) []byte {
+	t.Helper()
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
@@ -0,0 +1,206 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// defaultMinRSAKeyBits is the smallest RSA key accepted unless
+// min_rsa_key_bits says otherwise.
+const defaultMinRSAKeyBits = 2048
+
+// checkRSAKeySize returns an error if key is smaller than minBits. A
+// minBits of zero accepts any size.
+func checkRSAKeySize(name string, key *rsa.PublicKey, minBits int) error {
+	if bits := key.N.BitLen(); bits < minBits {
+		return fmt.Errorf("%s is a %d bit RSA key, must be at least %d bits", name, bits, minBits)
+	}
+	return nil
+}
+
+// checkPublicKeySize parses a PEM encoded RSA public key, as supplied by
+// Vault for keypair credentials, and checks its size.
+func checkPublicKeySize(publicKey []byte, minBits int) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return fmt.Errorf("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key must be an RSA key, got %T", key)
+	}
+	return checkRSAKeySize("public key", rsaKey, minBits)
+}
+
+// parsePrivateKey parses a PEM encoded, unencrypted RSA private key in
+// PKCS #8 or PKCS #1 form. The PEM may itself be base64 encoded, as it is
+// when pasted from CI secrets. An RSA JSON Web Key is accepted too.
+func parsePrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	if strings.HasPrefix(strings.TrimSpace(privateKey), "{") {
+		return parseJWKPrivateKey(privateKey)
+	}
+
+	block, _ := pem.Decode(privateKeyPEM(privateKey))
+	if block == nil {
+		return nil, fmt.Errorf("private_key is not PEM encoded, or base64 encoded PEM")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private_key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private_key must be an RSA key, got %T", key)
+		}
+		return rsaKey, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private_key: %w", err)
+		}
+		return key, nil
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, fmt.Errorf("encrypted private keys are not supported")
+	default:
+		return nil, fmt.Errorf("unexpected PEM block type %q in private_key", block.Type)
+	}
+}
+
+// jwk holds the members of an RSA private JSON Web Key (RFC 7518, section
+// 6.3). The CRT parameters are recomputed rather than read.
+type jwk struct {
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+	P   string `json:"p"`
+	Q   string `json:"q"`
+}
+
+// parseJWKPrivateKey parses an RSA private key given as a JSON Web Key.
+func parseJWKPrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	var k jwk
+	if err := json.Unmarshal([]byte(privateKey), &k); err != nil {
+		return nil, fmt.Errorf("failed to parse private_key as a JSON Web Key: %w", err)
+	}
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("private_key must be an RSA key, got JSON Web Key type %q", k.Kty)
+	}
+
+	params := map[string]*big.Int{}
+	for _, member := range []struct{ name, value string }{
+		{"n", k.N}, {"e", k.E}, {"d", k.D}, {"p", k.P}, {"q", k.Q},
+	} {
+		if member.value == "" {
+			return nil, fmt.Errorf("private_key JSON Web Key is missing %q", member.name)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(member.value, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private_key JSON Web Key %q: %w", member.name, err)
+		}
+		params[member.name] = big.NewInt(0).SetBytes(b)
+	}
+	if !params["e"].IsInt64() || params["e"].Int64() > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid private_key JSON Web Key \"e\": exponent too large")
+	}
+
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: params["n"], E: int(params["e"].Int64())},
+		D:         params["d"],
+		Primes:    []*big.Int{params["p"], params["q"]},
+	}
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid private_key JSON Web Key: %w", err)
+	}
+	key.Precompute()
+	return key, nil
+}
+
+// privateKeyPEM returns privateKey, decoded from base64 if it is base64
+// encoded PEM rather than PEM.
+func privateKeyPEM(privateKey string) []byte {
+	if block, _ := pem.Decode([]byte(privateKey)); block != nil {
+		return []byte(privateKey)
+	}
+	compact := strings.Join(strings.Fields(privateKey), "")
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(compact); err == nil {
+			if block, _ := pem.Decode(decoded); block != nil {
+				return decoded
+			}
+		}
+	}
+	return []byte(privateKey)
+}
+
+// privateKeyFingerprint returns the fingerprint Snowflake reports, as
+// RSA_PUBLIC_KEY_FP, for the public half of key.
+func privateKeyFingerprint(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// encodePrivateKey returns the key as the driver expects it in the
+// privateKey DSN parameter.
+func encodePrivateKey(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(der), nil
+}
+
+// keyPairConnectionURL returns connectionURL with the parameters that make
+// the driver authenticate as username with a JWT signed by key. The user is
+// added to the URL if it is not already there. The URL may name just the
+// account, because users are managed at the account level and do not need
+// a database.
+func keyPairConnectionURL(connectionURL, username string, key *rsa.PrivateKey) (string, error) {
+	encodedKey, err := encodePrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode private_key: %w", err)
+	}
+
+	dsn := connectionURL
+	if !hasUserInfo(dsn) {
+		if username == "" {
+			return "", fmt.Errorf("username must be set when connection_url does not include one")
+		}
+		dsn = url.PathEscape(username) + "@" + dsn
+	}
+
+	params := url.Values{}
+	params.Set("authenticator", gosnowflake.AuthTypeJwt.String())
+	params.Set("privateKey", encodedKey)
+	dsn = appendDSNParams(dsn, params)
+
+	if _, err := gosnowflake.ParseDSN(dsn); err != nil {
+		return "", fmt.Errorf("invalid connection_url: %s", redactString(err.Error()))
+	}
+	return dsn, nil
+}
@@ -0,0 +1,244 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func testPrivateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := testPrivateKey(t)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	parsed, err := parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})))
+	require.NoError(t, err)
+	require.True(t, key.Equal(parsed))
+
+	pkcs1 := x509.MarshalPKCS1PrivateKey(key)
+	parsed, err = parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1})))
+	require.NoError(t, err)
+	require.True(t, key.Equal(parsed))
+
+	_, err = parsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: pkcs8})))
+	require.Error(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	parsed, err = parsePrivateKey(encoded)
+	require.NoError(t, err)
+	require.True(t, key.Equal(parsed))
+
+	// Wrapped across lines, as base64 tools print it.
+	parsed, err = parsePrivateKey(encoded[:64] + "\n" + encoded[64:] + "\n")
+	require.NoError(t, err)
+	require.True(t, key.Equal(parsed))
+
+	_, err = parsePrivateKey(base64.StdEncoding.EncodeToString(pkcs8))
+	require.Error(t, err)
+
+	_, err = parsePrivateKey("not a key")
+	require.Error(t, err)
+}
+
+func TestParsePrivateKey_JWK(t *testing.T) {
+	key := testPrivateKey(t)
+	member := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+	jwk := map[string]string{
+		"kty": "RSA",
+		"n":   member(key.N),
+		"e":   member(big.NewInt(int64(key.E))),
+		"d":   member(key.D),
+		"p":   member(key.Primes[0]),
+		"q":   member(key.Primes[1]),
+	}
+	encode := func(jwk map[string]string) string {
+		b, err := json.Marshal(jwk)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	parsed, err := parsePrivateKey(encode(jwk))
+	require.NoError(t, err)
+	require.True(t, key.Equal(parsed))
+
+	for name, override := range map[string][2]string{
+		"not rsa":       {"kty", "EC"},
+		"missing prime": {"q", ""},
+		"wrong prime":   {"p", member(key.Primes[1])},
+		"invalid":       {"d", "!"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bad := map[string]string{}
+			for k, v := range jwk {
+				bad[k] = v
+			}
+			bad[override[0]] = override[1]
+			_, err := parsePrivateKey(encode(bad))
+			require.Error(t, err)
+		})
+	}
+
+	_, err = parsePrivateKey("{not json")
+	require.Error(t, err)
+}
+
+func TestKeyPairConnectionURL(t *testing.T) {
+	key := testPrivateKey(t)
+
+	tests := map[string]struct {
+		connectionURL     string
+		username          string
+		expectedUser      string
+		expectedAccount   string
+		expectedDatabase  string
+		expectedWarehouse string
+		expectedRole      string
+		expectErr         bool
+	}{
+		"account only": {
+			connectionURL:   "myorg-myaccount",
+			username:        "vault",
+			expectedUser:    "vault",
+			expectedAccount: "myorg-myaccount",
+		},
+		"account host without database": {
+			connectionURL:     "myorg-myaccount.snowflakecomputing.com?warehouse=wh",
+			username:          "vault",
+			expectedUser:      "vault",
+			expectedAccount:   "myorg-myaccount",
+			expectedWarehouse: "wh",
+		},
+		"account host with database and query parameters": {
+			connectionURL:     "myorg-myaccount.snowflakecomputing.com/db?warehouse=WH&role=VAULT_ADMIN",
+			username:          "vault",
+			expectedUser:      "vault",
+			expectedAccount:   "myorg-myaccount",
+			expectedDatabase:  "db",
+			expectedWarehouse: "WH",
+			expectedRole:      "VAULT_ADMIN",
+		},
+		"query parameters overriding authentication": {
+			connectionURL:     "myorg-myaccount/db?authenticator=snowflake&warehouse=WH",
+			username:          "vault",
+			expectedUser:      "vault",
+			expectedAccount:   "myorg-myaccount",
+			expectedDatabase:  "db",
+			expectedWarehouse: "WH",
+		},
+		"china host": {
+			connectionURL:    "myorg-myaccount.snowflakecomputing.cn/db",
+			username:         "vault",
+			expectedUser:     "vault",
+			expectedAccount:  "myorg-myaccount",
+			expectedDatabase: "db",
+		},
+		"government host": {
+			connectionURL:   "myorg-myaccount.snowflakecomputing.mil:443",
+			username:        "vault",
+			expectedUser:    "vault",
+			expectedAccount: "myorg-myaccount",
+		},
+		"privatelink host": {
+			connectionURL:   "xy12345.us-gov-west-1.privatelink.snowflakecomputing.com",
+			username:        "vault",
+			expectedUser:    "vault",
+			expectedAccount: "xy12345",
+		},
+		"account with database": {
+			connectionURL:    "myorg-myaccount/db",
+			username:         "vault",
+			expectedUser:     "vault",
+			expectedAccount:  "myorg-myaccount",
+			expectedDatabase: "db",
+		},
+		"user in connection url": {
+			connectionURL:   "admin@myorg-myaccount",
+			expectedUser:    "admin",
+			expectedAccount: "myorg-myaccount",
+		},
+		"no user": {
+			connectionURL: "myorg-myaccount",
+			expectErr:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dsn, err := keyPairConnectionURL(test.connectionURL, test.username, key)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			cfg, err := gosnowflake.ParseDSN(dsn)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedUser, cfg.User)
+			require.Equal(t, test.expectedAccount, cfg.Account)
+			require.Equal(t, test.expectedDatabase, cfg.Database)
+			require.Equal(t, test.expectedWarehouse, cfg.Warehouse)
+			require.Equal(t, test.expectedRole, cfg.Role)
+			require.Equal(t, gosnowflake.AuthTypeJwt, cfg.Authenticator)
+			require.True(t, key.Equal(cfg.PrivateKey))
+		})
+	}
+}
+
+func TestCheckPublicKeySize(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	strong := testPrivateKey(t)
+
+	encode := func(key *rsa.PrivateKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	require.NoError(t, checkPublicKeySize(encode(strong), defaultMinRSAKeyBits))
+	require.ErrorContains(t, checkPublicKeySize(encode(weak), defaultMinRSAKeyBits), "1024 bit RSA key")
+	require.NoError(t, checkPublicKeySize(encode(weak), 1024))
+	require.Error(t, checkPublicKeySize([]byte("not a key"), defaultMinRSAKeyBits))
+}
+
+func TestConnectionOptions_MinKeyBits(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(weak)
+	require.NoError(t, err)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	opts, err := parseConnectionOptions(map[string]interface{}{"private_key": privateKey})
+	require.NoError(t, err)
+	require.Equal(t, defaultMinRSAKeyBits, opts.minKeyBits)
+	_, err = opts.connectionURL("myorg-myaccount", "vault")
+	require.ErrorContains(t, err, "private_key is a 1024 bit RSA key")
+
+	opts, err = parseConnectionOptions(map[string]interface{}{
+		"private_key":      privateKey,
+		"min_rsa_key_bits": 1024,
+	})
+	require.NoError(t, err)
+	_, err = opts.connectionURL("myorg-myaccount", "vault")
+	require.NoError(t, err)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// globalOperations limits the user operations in flight across every
+// instance served by the process, which ServeMultiplex shares between all
+// the database configs of a Vault cluster.
+var globalOperations concurrencyLimit
+
+// SetMaxConcurrentOperations limits the user operations in flight across
+// every instance in the process to n, or removes the limit if n is zero.
+// Each instance is further limited by its max_concurrent_operations.
+func SetMaxConcurrentOperations(n int) {
+	globalOperations.setLimit(n)
+}
+
+// concurrencyLimit bounds the number of operations that run at once. The
+// zero value is unlimited; setLimit can change the limit while operations
+// are running or waiting.
+type concurrencyLimit struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	changed chan struct{}
+}
+
+func (l *concurrencyLimit) setLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = n
+	l.notifyLocked()
+}
+
+func (l *concurrencyLimit) notifyLocked() {
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// acquire waits until fewer than the limit of operations are running or
+// ctx is done, and returns the function that ends the operation.
+func (l *concurrencyLimit) acquire(ctx context.Context) (func(), error) {
+	for {
+		l.mu.Lock()
+		if l.limit == 0 || l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return l.release, nil
+		}
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *concurrencyLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.notifyLocked()
+}
+
+// acquireOperationSlot waits for the operation to be allowed to run under
+// both max_concurrent_operations and the process-wide limit. The returned
+// function must be called when the operation is done.
+func (s *SnowflakeSQL) acquireOperationSlot(ctx context.Context) (func(), error) {
+	// Take the instance's own slot first, so that operations queued behind
+	// a busy instance do not hold slots the others could use.
+	release, err := s.operationLimit.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("too many concurrent operations: %w", err)
+	}
+	releaseGlobal, err := globalOperations.acquire(ctx)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("too many concurrent operations across plugin instances: %w", err)
+	}
+	return func() {
+		releaseGlobal()
+		release()
+	}, nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	var l concurrencyLimit
+	for i := 0; i < 10; i++ {
+		_, err := l.acquire(context.Background())
+		require.NoError(t, err, "the zero value is unlimited")
+	}
+
+	l = concurrencyLimit{}
+	l.setLimit(1)
+	release, err := l.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan func())
+	go func() {
+		release, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired past the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	(<-acquired)()
+
+	// Raising the limit lets waiting operations through.
+	release, err = l.acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+	go func() {
+		release, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		acquired <- release
+	}()
+	l.setLimit(2)
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("raising the limit did not release the waiting operation")
+	}
+}
+
+func TestSnowflakeSQL_MaxConcurrentOperations(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"max_concurrent_operations": 1,
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fake.FailOnFunc("grant", func() error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	created := make(chan error)
+	go func() {
+		_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+			"CREATE USER {{name}} PASSWORD = '{{password}}'",
+			"GRANT ROLE public TO USER {{name}}",
+		))
+		created <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := db.NewUser(ctx, fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	require.ErrorContains(t, err, "too many concurrent operations")
+
+	close(release)
+	require.NoError(t, <-created)
+
+	_, err = new().Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":            "user:password@account/db",
+			"max_concurrent_operations": 0,
+		},
+	})
+	require.ErrorContains(t, err, "max_concurrent_operations must be positive")
+}
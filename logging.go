@@ -0,0 +1,110 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// defaultDriverLogLevel keeps gosnowflake's chatty info-level logging out of
+// the Vault logs unless an operator asks for it.
+const defaultDriverLogLevel = hclog.Warn
+
+var (
+	bridgeDriverLogsOnce sync.Once
+
+	// driverLogger receives the gosnowflake driver's log output. The driver
+	// logger is global to the process, so this logger and its level are
+	// shared by every database configuration served by the plugin.
+	driverLogger = hclog.New(&hclog.LoggerOptions{
+		Name:       snowflakeSQLTypeName + ".driver",
+		Output:     os.Stderr,
+		JSONFormat: true,
+		Level:      defaultDriverLogLevel,
+	})
+
+	logfmtField = regexp.MustCompile(`(\w+)=("(?:[^"\\]|\\.)*"|\S+)`)
+)
+
+// parseLogLevel parses a log level name from the config, returning def if the
+// key is not set.
+func parseLogLevel(config map[string]interface{}, key string, def hclog.Level) (hclog.Level, error) {
+	raw, ok := config[key].(string)
+	if !ok || raw == "" {
+		return def, nil
+	}
+
+	level := hclog.LevelFromString(raw)
+	if level == hclog.NoLevel {
+		return hclog.NoLevel, fmt.Errorf("invalid %s %q", key, raw)
+	}
+	return level, nil
+}
+
+// bridgeDriverLogs routes the gosnowflake driver's logs into driverLogger and
+// sets the level both loggers filter at.
+func bridgeDriverLogs(level hclog.Level) error {
+	bridgeDriverLogsOnce.Do(func() {
+		gosnowflake.GetLogger().SetOutput(driverLogWriter{logger: driverLogger})
+	})
+
+	driverLogger.SetLevel(level)
+	return gosnowflake.GetLogger().SetLogLevel(level.String())
+}
+
+// driverLogWriter parses the logfmt lines written by the driver's logrus
+// logger and re-emits them through an hclog logger at the same level. The
+// driver masks secrets in messages while formatting them, so the lines are
+// taken after formatting rather than through a logrus hook, and are then
+// passed through redactString to catch DSNs and JWTs the driver misses.
+type driverLogWriter struct {
+	logger hclog.Logger
+}
+
+func (w driverLogWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimSpace(p), []byte("\n")) {
+		w.writeLine(redactString(string(line)))
+	}
+	return len(p), nil
+}
+
+func (w driverLogWriter) writeLine(line string) {
+	level := hclog.Info
+	msg := line
+	var args []interface{}
+
+	for _, field := range logfmtField.FindAllStringSubmatch(line, -1) {
+		key, value := field[1], field[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+
+		switch key {
+		case "time":
+		case "level":
+			switch value {
+			case "panic", "fatal", "error":
+				level = hclog.Error
+			case "warning":
+				level = hclog.Warn
+			default:
+				level = hclog.LevelFromString(value)
+			}
+		case "msg":
+			msg = value
+		default:
+			args = append(args, key, value)
+		}
+	}
+
+	w.logger.Log(level, msg, args...)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{
+		Output:     &buf,
+		JSONFormat: true,
+		Level:      hclog.Trace,
+	})
+	w := driverLogWriter{logger: logger}
+
+	line := `time="2024-09-04T10:00:00Z" level=warning msg="authentication \"slow\"" func="gosnowflake.authenticate" file="auth.go:42"` + "\n"
+	n, err := w.Write([]byte(line))
+	require.NoError(t, err)
+	require.Equal(t, len(line), n)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "warn", entry["@level"])
+	require.Equal(t, `authentication "slow"`, entry["@message"])
+	require.Equal(t, "gosnowflake.authenticate", entry["func"])
+	require.Equal(t, "auth.go:42", entry["file"])
+	require.NotContains(t, entry, "time")
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := parseLogLevel(map[string]interface{}{}, "log_level", hclog.Info)
+	require.NoError(t, err)
+	require.Equal(t, hclog.Info, level)
+
+	level, err = parseLogLevel(map[string]interface{}{"log_level": "debug"}, "log_level", hclog.Info)
+	require.NoError(t, err)
+	require.Equal(t, hclog.Debug, level)
+
+	_, err = parseLogLevel(map[string]interface{}{"log_level": "loud"}, "log_level", hclog.Info)
+	require.Error(t, err)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	_ dbplugin.Database       = metricsMiddleware{}
+	_ logical.PluginVersioner = metricsMiddleware{}
+)
+
+// metricsMiddleware wraps a Database and emits a counter, an error counter,
+// and a latency measurement for each user management operation.
+type metricsMiddleware struct {
+	next dbplugin.Database
+}
+
+func (mw metricsMiddleware) Initialize(ctx context.Context, req dbplugin.InitializeRequest) (resp dbplugin.InitializeResponse, err error) {
+	defer emitMetrics("initialize", time.Now(), &err)()
+	return mw.next.Initialize(ctx, req)
+}
+
+func (mw metricsMiddleware) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (resp dbplugin.NewUserResponse, err error) {
+	defer emitMetrics("new_user", time.Now(), &err)()
+	return mw.next.NewUser(ctx, req)
+}
+
+func (mw metricsMiddleware) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (resp dbplugin.UpdateUserResponse, err error) {
+	if req.Password != nil || req.PublicKey != nil {
+		defer emitMetrics("rotate_credential", time.Now(), &err)()
+	}
+	if req.Expiration != nil {
+		defer emitMetrics("renew_user", time.Now(), &err)()
+	}
+	return mw.next.UpdateUser(ctx, req)
+}
+
+func (mw metricsMiddleware) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (resp dbplugin.DeleteUserResponse, err error) {
+	defer emitMetrics("delete_user", time.Now(), &err)()
+	return mw.next.DeleteUser(ctx, req)
+}
+
+func (mw metricsMiddleware) Type() (string, error) {
+	return mw.next.Type()
+}
+
+func (mw metricsMiddleware) Close() error {
+	return mw.next.Close()
+}
+
+func (mw metricsMiddleware) PluginVersion() logical.PluginVersion {
+	return pluginVersion(mw.next)
+}
+
+// emitMetrics returns a function that records the outcome of an operation
+// started at the given time. err is read when the returned function runs, so
+// it should point at the operation's named error return value.
+func emitMetrics(operation string, start time.Time, err *error) func() {
+	return func() {
+		metrics.MeasureSince([]string{snowflakeSQLTypeName, operation}, start)
+		metrics.IncrCounter([]string{snowflakeSQLTypeName, operation}, 1)
+		if *err != nil {
+			metrics.IncrCounter([]string{snowflakeSQLTypeName, operation, "error"}, 1)
+		}
+		operationStats.record(operation, *err, time.Now())
+	}
+}
+
+// emitConnectionReopened records that the connection pool had to be
+// reestablished because the previous one failed a health check.
+func emitConnectionReopened() {
+	metrics.IncrCounter([]string{snowflakeSQLTypeName, "connection", "reopened"}, 1)
+	operationStats.reconnects.Add(1)
+}
+
+// emitConnectionFailover counts connections opened to a failover account
+// because the accounts before it were unreachable.
+func emitConnectionFailover() {
+	metrics.IncrCounter([]string{snowflakeSQLTypeName, "connection", "failover"}, 1)
+	operationStats.failovers.Add(1)
+}
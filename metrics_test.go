@@ -0,0 +1,59 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type stubDatabase struct {
+	dbplugin.Database
+	err error
+}
+
+func (s stubDatabase) NewUser(context.Context, dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
+	return dbplugin.NewUserResponse{}, s.err
+}
+
+func (s stubDatabase) UpdateUser(context.Context, dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+	return dbplugin.UpdateUserResponse{}, s.err
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	conf := metrics.DefaultConfig("test")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	_, err := metrics.NewGlobal(conf, sink)
+	require.NoError(t, err)
+
+	ok := metricsMiddleware{next: stubDatabase{}}
+	failing := metricsMiddleware{next: stubDatabase{err: errors.New("boom")}}
+
+	_, err = ok.NewUser(context.Background(), dbplugin.NewUserRequest{})
+	require.NoError(t, err)
+	_, err = failing.NewUser(context.Background(), dbplugin.NewUserRequest{})
+	require.Error(t, err)
+	_, err = ok.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Password: &dbplugin.ChangePassword{NewPassword: "secret"},
+	})
+	require.NoError(t, err)
+
+	intervals := sink.Data()
+	require.NotEmpty(t, intervals)
+	counters := intervals[0].Counters
+
+	require.Equal(t, 2, counters["test.snowflake.new_user"].Count)
+	require.Equal(t, 1, counters["test.snowflake.new_user.error"].Count)
+	require.Equal(t, 1, counters["test.snowflake.rotate_credential"].Count)
+	require.NotContains(t, counters, "test.snowflake.renew_user")
+	require.Contains(t, intervals[0].Samples, "test.snowflake.new_user")
+}
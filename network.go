@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+const defaultDNSPort = "53"
+
+// networkOptions override how connections to Snowflake find and reach its
+// hosts, for networks where the default resolution points at an endpoint
+// that cannot be reached, such as split-horizon DNS.
+type networkOptions struct {
+	// hostOverrides maps lower case host names to the address, with or
+	// without a port, to dial instead.
+	hostOverrides map[string]string
+
+	// dnsServer is the host:port of the DNS server to resolve hosts with
+	// instead of the system resolver.
+	dnsServer string
+
+	// preferIPv4 dials the IPv4 addresses of a host before its IPv6 ones.
+	preferIPv4 bool
+}
+
+func parseNetworkOptions(config map[string]interface{}) (networkOptions, error) {
+	var opts networkOptions
+
+	overrides, err := getStringMap(config, "host_overrides")
+	if err != nil {
+		return opts, err
+	}
+	for host, addr := range overrides {
+		if host == "" || addr == "" {
+			return opts, fmt.Errorf("invalid host_overrides entry %q: host and address must not be empty", host)
+		}
+		if opts.hostOverrides == nil {
+			opts.hostOverrides = map[string]string{}
+		}
+		opts.hostOverrides[strings.ToLower(host)] = addr
+	}
+
+	if opts.dnsServer, err = strutil.GetString(config, "dns_server"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve dns_server: %w", err)
+	}
+	if opts.dnsServer != "" {
+		if _, _, err := net.SplitHostPort(opts.dnsServer); err != nil {
+			opts.dnsServer = net.JoinHostPort(opts.dnsServer, defaultDNSPort)
+		}
+		if _, _, err := net.SplitHostPort(opts.dnsServer); err != nil {
+			return opts, fmt.Errorf("invalid dns_server %q: %w", opts.dnsServer, err)
+		}
+	}
+
+	if opts.preferIPv4, err = getBool(config, "prefer_ipv4"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+func (o networkOptions) empty() bool {
+	return len(o.hostOverrides) == 0 && o.dnsServer == "" && !o.preferIPv4
+}
+
+func (o networkOptions) equal(other networkOptions) bool {
+	return maps.Equal(o.hostOverrides, other.hostOverrides) &&
+		o.dnsServer == other.dnsServer && o.preferIPv4 == other.preferIPv4
+}
+
+// transport returns the HTTP transport for the driver to connect with, or
+// nil to use its default. It is the driver's default transport, which
+// checks certificate revocation with OCSP, with the dialer replaced. TLS
+// still verifies the certificate against the host in the URL, not the
+// address dialed.
+func (o networkOptions) transport() http.RoundTripper {
+	if o.empty() {
+		return nil
+	}
+
+	d := &dialer{
+		opts: o,
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		resolver: net.DefaultResolver,
+	}
+	if o.dnsServer != "" {
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.dialer.DialContext(ctx, network, o.dnsServer)
+			},
+		}
+	}
+
+	t := gosnowflake.SnowflakeTransport.Clone()
+	t.DialContext = d.DialContext
+	return t
+}
+
+type dialer struct {
+	opts     networkOptions
+	dialer   *net.Dialer
+	resolver *net.Resolver
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if override, ok := d.opts.hostOverrides[strings.ToLower(host)]; ok {
+		if h, p, err := net.SplitHostPort(override); err == nil {
+			host, port = h, p
+		} else {
+			host = override
+		}
+	}
+
+	if net.ParseIP(host) != nil || (d.opts.dnsServer == "" && !d.opts.preferIPv4) {
+		return d.dialer.DialContext(ctx, network, net.JoinHostPort(host, port))
+	}
+
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if d.opts.preferIPv4 {
+		sortIPv4First(addrs)
+	}
+
+	var errs []error
+	for _, ip := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to connect to %s: %w", host, errors.Join(errs...))
+}
+
+// sortIPv4First moves the IPv4 addresses ahead of the IPv6 ones, keeping
+// the resolver's order within each.
+func sortIPv4First(addrs []net.IPAddr) {
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return addrs[i].IP.To4() != nil && addrs[j].IP.To4() == nil
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworkOptions(t *testing.T) {
+	opts, err := parseNetworkOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.True(t, opts.empty())
+	require.Nil(t, opts.transport())
+
+	opts, err = parseNetworkOptions(map[string]interface{}{
+		"host_overrides": `{"Account.Snowflakecomputing.com": "10.0.0.5"}`,
+		"dns_server":     "10.0.0.2",
+		"prefer_ipv4":    true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"account.snowflakecomputing.com": "10.0.0.5"}, opts.hostOverrides)
+	require.Equal(t, "10.0.0.2:53", opts.dnsServer)
+	require.True(t, opts.preferIPv4)
+	require.False(t, opts.equal(networkOptions{}))
+
+	transport, ok := opts.transport().(*http.Transport)
+	require.True(t, ok)
+	require.NotNil(t, transport.TLSClientConfig.VerifyPeerCertificate, "OCSP checks should be kept")
+	require.NotSame(t, gosnowflake.SnowflakeTransport, transport)
+
+	opts, err = parseNetworkOptions(map[string]interface{}{"dns_server": "[::1]:5353"})
+	require.NoError(t, err)
+	require.Equal(t, "[::1]:5353", opts.dnsServer)
+
+	_, err = parseNetworkOptions(map[string]interface{}{"host_overrides": map[string]interface{}{"host": ""}})
+	require.Error(t, err)
+	_, err = parseNetworkOptions(map[string]interface{}{"dns_server": "[::1"})
+	require.Error(t, err)
+	_, err = parseNetworkOptions(map[string]interface{}{"prefer_ipv4": "maybe"})
+	require.Error(t, err)
+}
+
+func TestDialer_HostOverrides(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	d := &dialer{
+		opts:     networkOptions{hostOverrides: map[string]string{"account.snowflakecomputing.com": l.Addr().String()}},
+		dialer:   &net.Dialer{},
+		resolver: net.DefaultResolver,
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "ACCOUNT.snowflakecomputing.com:443")
+	require.NoError(t, err)
+	require.Equal(t, l.Addr().String(), conn.RemoteAddr().String())
+	conn.Close()
+
+	// An override without a port keeps the port of the URL.
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	d.opts.hostOverrides["account.snowflakecomputing.com"] = "127.0.0.1"
+	d.opts.preferIPv4 = true
+	conn, err = d.DialContext(context.Background(), "tcp", net.JoinHostPort("account.snowflakecomputing.com", port))
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestSortIPv4First(t *testing.T) {
+	addrs := []net.IPAddr{
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("10.0.0.1")},
+		{IP: net.ParseIP("2001:db8::2")},
+		{IP: net.ParseIP("10.0.0.2")},
+	}
+	sortIPv4First(addrs)
+	var got []string
+	for _, addr := range addrs {
+		got = append(got, addr.IP.String())
+	}
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2", "2001:db8::1", "2001:db8::2"}, got)
+}
+
+func TestConfigCache_NetworkOptions(t *testing.T) {
+	cache := &configCache{entries: map[string]*cachedConfig{}}
+	dsn := "vault:password@account/db"
+	network := networkOptions{preferIPv4: true}
+
+	key := mustAcquire(t, cache, dsn, nil, network, nil)
+	cfg, err := cache.get(key)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Transporter)
+
+	// The same DSN with other network options, as a verification user
+	// shared by mounts with different options is, gets its own entry.
+	plainKey := mustAcquire(t, cache, dsn, nil, networkOptions{}, nil)
+	require.NotEqual(t, key, plainKey)
+	cfg, err = cache.get(plainKey)
+	require.NoError(t, err)
+	require.Nil(t, cfg.Transporter)
+
+	require.Equal(t, key, mustAcquire(t, cache, dsn, nil, networkOptions{preferIPv4: true}, nil))
+	require.Equal(t, 2, cache.entries[key].refs)
+}
+
+func TestSnowflakeSQL_Initialize_NetworkOptions(t *testing.T) {
+	config := func(preferIPv4 bool) map[string]interface{} {
+		return map[string]interface{}{
+			"connection_url":  "{{username}}:{{password}}@myorg/db",
+			"username":        "vault",
+			"password":        "password",
+			"prefer_ipv4":     preferIPv4,
+			"lazy_connection": true,
+		}
+	}
+
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{Config: config(true)})
+
+	// Vault starts the instance for a rewritten config before it closes
+	// the old one.
+	other := new()
+	defer dbtesting.AssertClose(t, other)
+	dbtesting.AssertInitialize(t, other, dbplugin.InitializeRequest{Config: config(false)})
+	require.NotEqual(t, db.cachedKey, other.cachedKey)
+
+	cfg, err := parsedConfigs.get(db.cachedKey)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Transporter)
+	cfg, err = parsedConfigs.get(other.cachedKey)
+	require.NoError(t, err)
+	require.Nil(t, cfg.Transporter)
+}
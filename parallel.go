@@ -0,0 +1,210 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// isIndependentStatement reports whether query can run concurrently with
+// its neighbours. Grants to the user or its role only depend on the
+// statements before them, and not on each other.
+func isIndependentStatement(query string) bool {
+	fields := strings.Fields(query)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "grant")
+}
+
+// batchCreationStatements splits each creation statement block into its
+// queries. A block of nothing but grants, as roles that list one grant per
+// statement have, is added to the batch before it if that ends in a grant,
+// so that consecutive grants share a round trip.
+func batchCreationStatements(statements []string) [][]string {
+	var batches [][]string
+	for _, stmt := range statements {
+		queries := splitStatements(stmt)
+		if len(queries) == 0 {
+			continue
+		}
+		if n := len(batches); n > 0 && independentRun(queries) == len(queries) {
+			last := batches[n-1]
+			if isIndependentStatement(last[len(last)-1]) {
+				batches[n-1] = append(last, queries...)
+				continue
+			}
+		}
+		batches = append(batches, queries)
+	}
+	return batches
+}
+
+// executeCreationQueries runs a block of creation statements. With
+// sessions set aside for it, each run of two or more consecutive
+// independent statements is executed concurrently on them, and the rest
+// within the transaction as executeQueries does.
+func (s *SnowflakeSQL) executeCreationQueries(ctx context.Context, sessions *parallelSessions, tx execer, m map[string]string, queries []string) error {
+	if sessions == nil {
+		return executeQueries(ctx, tx, m, queries)
+	}
+
+	for len(queries) > 0 {
+		if n := independentRun(queries); n >= 2 {
+			if err := sessions.execute(ctx, m, queries[:n]); err != nil {
+				return err
+			}
+			queries = queries[n:]
+			continue
+		}
+
+		// Run everything up to the next run of independent statements in
+		// one round trip.
+		n := 1
+		for n < len(queries) && independentRun(queries[n:]) < 2 {
+			n++
+		}
+		if err := executeQueries(ctx, tx, m, queries[:n]); err != nil {
+			return err
+		}
+		sessions.recordSetup(queries[:n])
+		queries = queries[n:]
+	}
+	return nil
+}
+
+// independentRun returns the number of independent statements queries
+// starts with.
+func independentRun(queries []string) int {
+	n := 0
+	for n < len(queries) && isIndependentStatement(queries[n]) {
+		n++
+	}
+	return n
+}
+
+// longestIndependentRun returns the length of the longest run of
+// independent statements in a creation's statement blocks.
+func longestIndependentRun(statements []string) int {
+	longest := 0
+	for _, queries := range batchCreationStatements(statements) {
+		for i := range queries {
+			longest = max(longest, independentRun(queries[i:]))
+		}
+	}
+	return longest
+}
+
+// isSessionStatement reports whether query changes the state of the
+// session it runs in, such as its role or warehouse, rather than objects
+// in Snowflake.
+func isSessionStatement(query string) bool {
+	fields := strings.Fields(query)
+	switch {
+	case len(fields) == 0:
+		return false
+	case strings.EqualFold(fields[0], "use"):
+		return true
+	default:
+		return len(fields) > 1 && strings.EqualFold(fields[0], "alter") && strings.EqualFold(fields[1], "session")
+	}
+}
+
+// sessionReserver is implemented by pools that can set connections aside
+// for a transaction's statements to run on concurrently, as the *sql.DB
+// adapter can.
+type sessionReserver interface {
+	beginTxWithSessions(ctx context.Context, n int) (Tx, []*sql.Conn, error)
+}
+
+// beginCreationTx begins the transaction a user is created in. With
+// parallel_statements set, and statements with independent statements to
+// run concurrently, it also sets aside the sessions to run them on. The
+// statements run in the transaction if the pool cannot spare any.
+func (s *SnowflakeSQL) beginCreationTx(ctx context.Context, db Database, statements []string) (Tx, *parallelSessions, error) {
+	n := min(s.parallelStatements, longestIndependentRun(statements))
+	reserver, ok := db.(sessionReserver)
+	if n < 2 || !ok {
+		tx, err := db.BeginTx(ctx, nil)
+		return tx, nil, err
+	}
+
+	tx, conns, err := reserver.beginTxWithSessions(ctx, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conns) == 0 {
+		return tx, nil, nil
+	}
+	return tx, &parallelSessions{conns: conns, setup: slices.Clip(s.statementHooks.pre)}, nil
+}
+
+// parallelSessions are the connections set aside for a creation's
+// independent statements, and the statements that set up the session of
+// its transaction, which are replayed before each of them so that they
+// run with the same role and warehouse.
+type parallelSessions struct {
+	conns []*sql.Conn
+	setup []string
+}
+
+// recordSetup adds the session statements among queries, run within the
+// transaction, to those replayed before each independent statement.
+func (p *parallelSessions) recordSetup(queries []string) {
+	for _, query := range queries {
+		if isSessionStatement(query) {
+			p.setup = append(p.setup, query)
+		}
+	}
+	p.setup = slices.Clip(p.setup)
+}
+
+// execute runs queries on the sessions, one at a time on each, and returns
+// the errors of all that failed.
+func (p *parallelSessions) execute(ctx context.Context, m map[string]string, queries []string) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	pending := make(chan string, len(queries))
+	for _, query := range queries {
+		pending <- query
+	}
+	close(pending)
+
+	for _, conn := range p.conns[:min(len(p.conns), len(queries))] {
+		wg.Add(1)
+		go func(conn *sql.Conn) {
+			defer wg.Done()
+			for query := range pending {
+				if err := executeQueries(ctx, conn, m, append(p.setup, query)); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d statements failed: %w", len(errs), len(queries), errors.Join(errs...))
+	}
+	return nil
+}
+
+// close returns the sessions to the pool.
+func (p *parallelSessions) close() {
+	if p == nil {
+		return
+	}
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflakeSQL_ParallelStatements(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"parallel_statements": 2,
+		"pre_statements":      "USE ROLE SECURITYADMIN",
+	})
+
+	var running, maxRunning atomic.Int32
+	fake.FailOnFunc("grant", func() error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	resp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+		`CREATE USER {{name}} PASSWORD = '{{password}}';
+GRANT ROLE public TO USER {{name}};
+GRANT USAGE ON WAREHOUSE wh TO ROLE public;
+GRANT USAGE ON DATABASE analytics TO ROLE public;`,
+	))
+	_, ok := fake.User(resp.Username)
+	require.True(t, ok)
+	require.Len(t, fake.Grants(), 2)
+	require.EqualValues(t, 2, maxRunning.Load(), "grants should run two at a time")
+
+	var uses int
+	for _, stmt := range fake.Statements() {
+		if stmt == "USE ROLE SECURITYADMIN" {
+			uses++
+		}
+	}
+	require.Equal(t, 4, uses, "pre_statements should run in every session")
+}
+
+func TestSnowflakeSQL_ParallelStatements_ReplaysSession(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"parallel_statements": 2})
+
+	dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}'",
+		"USE ROLE SECURITYADMIN; USE WAREHOUSE wh; GRANT ROLE public TO USER {{name}}; GRANT USAGE ON WAREHOUSE wh TO ROLE public",
+	))
+
+	var uses int
+	for _, stmt := range fake.Statements() {
+		if stmt == "USE WAREHOUSE wh" {
+			uses++
+		}
+	}
+	require.Equal(t, 3, uses, "session statements should be replayed before every independent statement")
+}
+
+func TestSnowflakeSQL_ParallelStatements_SingleConnection(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"parallel_statements":  4,
+		"max_open_connections": 1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := db.NewUser(ctx, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}'",
+		"GRANT ROLE public TO USER {{name}}; GRANT USAGE ON WAREHOUSE wh TO ROLE public",
+	))
+	require.NoError(t, err, "statements should run in the transaction when the pool cannot spare a session")
+	_, ok := fake.User(resp.Username)
+	require.True(t, ok)
+}
+
+func TestSnowflakeSQL_ParallelStatements_ConcurrentCreations(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"parallel_statements":  4,
+		"max_open_connections": 4,
+	})
+	fake.FailOnFunc("grant", func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		req := fakeNewUserRequest(
+			"CREATE USER {{name}} PASSWORD = '{{password}}'",
+			"GRANT ROLE public TO USER {{name}}; GRANT USAGE ON WAREHOUSE wh TO ROLE public; GRANT USAGE ON DATABASE analytics TO ROLE public",
+		)
+		req.UsernameConfig.DisplayName = fmt.Sprintf("token%d", i)
+		go func() {
+			_, err := db.NewUser(ctx, req)
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+	require.Len(t, fake.Users(), 4)
+}
+
+func TestSnowflakeSQL_ParallelStatements_Errors(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"parallel_statements": 4})
+
+	fake.FailOn("on warehouse", errors.New("warehouse does not exist"))
+	fake.FailOn("on database", errors.New("database does not exist"))
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}'",
+		"GRANT USAGE ON WAREHOUSE wh TO ROLE public; GRANT USAGE ON DATABASE analytics TO ROLE public; GRANT ROLE public TO USER {{name}}",
+	))
+	require.ErrorContains(t, err, "2 of 3 statements failed")
+	require.ErrorContains(t, err, "warehouse does not exist")
+	require.ErrorContains(t, err, "database does not exist")
+	require.Empty(t, fake.Users(), "partially created user should have been dropped")
+}
+
+func TestSnowflakeSQL_ParallelStatements_Invalid(t *testing.T) {
+	db := new()
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":      "user:password@account/db",
+			"parallel_statements": 0,
+		},
+	})
+	require.ErrorContains(t, err, "parallel_statements must be positive")
+}
+
+func TestExecuteCreationQueries_Grouping(t *testing.T) {
+	require.Equal(t, 2, independentRun([]string{"GRANT a", "grant b", "create c", "grant d"}))
+	require.Equal(t, 0, independentRun([]string{"create c", "grant d"}))
+	require.False(t, isIndependentStatement("-- grant\ncreate user a"))
+}
+
+func TestBatchCreationStatements(t *testing.T) {
+	require.Equal(t, [][]string{
+		{"CREATE USER {{name}}"},
+		{"GRANT ROLE a TO USER {{name}}", "GRANT ROLE b TO USER {{name}}", "grant role c to user {{name}}"},
+		{"ALTER USER {{name}} SET COMMENT = 'x'"},
+		{"GRANT ROLE d TO USER {{name}}"},
+		{"CREATE ROLE r", "GRANT ROLE r TO USER {{name}}", "GRANT ROLE e TO USER {{name}}"},
+		{"ALTER USER {{name}} SET DEFAULT_ROLE = r", "GRANT ROLE f TO USER {{name}}"},
+	}, batchCreationStatements([]string{
+		"CREATE USER {{name}};",
+		"GRANT ROLE a TO USER {{name}}",
+		"GRANT ROLE b TO USER {{name}}; grant role c to user {{name}};",
+		"",
+		"ALTER USER {{name}} SET COMMENT = 'x'",
+		"GRANT ROLE d TO USER {{name}}",
+		"CREATE ROLE r; GRANT ROLE r TO USER {{name}}",
+		"GRANT ROLE e TO USER {{name}}",
+		"ALTER USER {{name}} SET DEFAULT_ROLE = r; GRANT ROLE f TO USER {{name}}",
+	}))
+}
@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+const (
+	passwordAuthWarn = "warn"
+	passwordAuthDeny = "deny"
+)
+
+// passwordAuthPolicy is what Initialize does with a connection that
+// authenticates with a password, which Snowflake is deprecating for service
+// users: log a warning, or fail. Setting a date lets every mount sharing a
+// configuration template warn until the date and fail after it.
+type passwordAuthPolicy struct {
+	// setting names the option that denies password authentication, if
+	// one does regardless of the date.
+	setting string
+
+	// denyAfter is when password authentication starts to be denied.
+	denyAfter time.Time
+}
+
+func parsePasswordAuthPolicy(config map[string]interface{}) (passwordAuthPolicy, error) {
+	var policy passwordAuthPolicy
+
+	enforceKeypair, err := getBool(config, "enforce_keypair_auth")
+	if err != nil {
+		return policy, err
+	}
+
+	mode, err := strutil.GetString(config, "password_auth_deprecated")
+	if err != nil {
+		return policy, fmt.Errorf("failed to retrieve password_auth_deprecated: %w", err)
+	}
+	switch mode {
+	case "", passwordAuthWarn, passwordAuthDeny:
+	default:
+		return policy, fmt.Errorf("invalid password_auth_deprecated %q: must be %q or %q",
+			mode, passwordAuthWarn, passwordAuthDeny)
+	}
+	if enforceKeypair && mode == passwordAuthWarn {
+		return policy, fmt.Errorf("enforce_keypair_auth and password_auth_deprecated=warn cannot both be set")
+	}
+
+	switch {
+	case enforceKeypair:
+		policy.setting = "enforce_keypair_auth is set"
+	case mode == passwordAuthDeny:
+		policy.setting = "password_auth_deprecated is deny"
+	}
+
+	denyAfter, err := strutil.GetString(config, "password_auth_deny_after")
+	if err != nil {
+		return policy, fmt.Errorf("failed to retrieve password_auth_deny_after: %w", err)
+	}
+	if denyAfter != "" {
+		if policy.denyAfter, err = parseDate(denyAfter); err != nil {
+			return policy, fmt.Errorf("invalid password_auth_deny_after %q: must be a date such as 2006-01-02 or an RFC 3339 timestamp", denyAfter)
+		}
+	}
+
+	return policy, nil
+}
+
+// parseDate parses an RFC 3339 timestamp, or a date taken as midnight UTC.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// denial returns why password authentication is denied at now, or "" if it
+// is only warned about.
+func (p passwordAuthPolicy) denial(now time.Time) string {
+	if p.setting != "" {
+		return p.setting
+	}
+	if !p.denyAfter.IsZero() && !now.Before(p.denyAfter) {
+		return fmt.Sprintf("password_auth_deny_after %s has passed", p.denyAfter.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// checkAuthenticator warns about, or as the policy requires rejects, a
+// connection that authenticates with a password.
+func (s *SnowflakeSQL) checkAuthenticator(policy passwordAuthPolicy) error {
+	cfg, err := parsedConfigs.get(s.cachedKey)
+	if err != nil {
+		return fmt.Errorf("invalid connection_url: %s", redactString(err.Error()))
+	}
+
+	switch cfg.Authenticator {
+	case gosnowflake.AuthTypeSnowflake, gosnowflake.AuthTypeUsernamePasswordMFA:
+	default:
+		return nil
+	}
+
+	if reason := policy.denial(time.Now()); reason != "" {
+		return fmt.Errorf("%s, but the connection authenticates with a password: set private_key instead", reason)
+	}
+
+	const msg = "the connection authenticates with a password, which Snowflake is deprecating; set private_key to use keypair authentication"
+	if !policy.denyAfter.IsZero() {
+		s.logger.Warn(msg, "denied_after", policy.denyAfter.Format(time.RFC3339))
+		return nil
+	}
+	s.logger.Warn(msg)
+	return nil
+}
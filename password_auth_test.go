@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePasswordAuthPolicy(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		config map[string]interface{}
+		denial string
+		err    string
+	}{
+		"default": {
+			config: map[string]interface{}{},
+		},
+		"warn": {
+			config: map[string]interface{}{"password_auth_deprecated": "warn"},
+		},
+		"deny": {
+			config: map[string]interface{}{"password_auth_deprecated": "deny"},
+			denial: "password_auth_deprecated is deny",
+		},
+		"enforce keypair": {
+			config: map[string]interface{}{"enforce_keypair_auth": true, "password_auth_deprecated": "deny"},
+			denial: "enforce_keypair_auth is set",
+		},
+		"date not reached": {
+			config: map[string]interface{}{"password_auth_deny_after": "2026-03-02"},
+		},
+		"date passed": {
+			config: map[string]interface{}{"password_auth_deny_after": "2026-03-01"},
+			denial: "password_auth_deny_after 2026-03-01T00:00:00Z has passed",
+		},
+		"timestamp passed": {
+			config: map[string]interface{}{"password_auth_deny_after": "2026-03-01T11:00:00Z"},
+			denial: "password_auth_deny_after 2026-03-01T11:00:00Z has passed",
+		},
+		"invalid mode": {
+			config: map[string]interface{}{"password_auth_deprecated": "allow"},
+			err:    `invalid password_auth_deprecated "allow": must be "warn" or "deny"`,
+		},
+		"invalid date": {
+			config: map[string]interface{}{"password_auth_deny_after": "March 1st"},
+			err:    `invalid password_auth_deny_after "March 1st"`,
+		},
+		"conflicting": {
+			config: map[string]interface{}{"enforce_keypair_auth": true, "password_auth_deprecated": "warn"},
+			err:    "enforce_keypair_auth and password_auth_deprecated=warn cannot both be set",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			policy, err := parsePasswordAuthPolicy(tt.config)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.denial, policy.denial(now))
+		})
+	}
+}
+
+func TestSnowflakeSQL_Initialize_PasswordAuthDenyAfter(t *testing.T) {
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	config := map[string]interface{}{
+		"connection_url":           "vault:password@myorg-myaccount/db",
+		"password_auth_deny_after": time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+	}
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{Config: config})
+
+	config["password_auth_deny_after"] = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config})
+	require.ErrorContains(t, err, "has passed, but the connection authenticates with a password")
+}
@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	passwordPolicyCheckWarn = "warn"
+	passwordPolicyCheckDeny = "deny"
+
+	accountPasswordPolicySQL = `
+select POLICY_DB, POLICY_SCHEMA, POLICY_NAME
+from table(INFORMATION_SCHEMA.POLICY_REFERENCES(REF_ENTITY_DOMAIN => 'ACCOUNT', REF_ENTITY_NAME => CURRENT_ACCOUNT()))
+where POLICY_KIND = 'PASSWORD_POLICY'
+`
+	describePasswordPolicySQL = `describe password policy %s`
+)
+
+// passwordPolicy holds the subset of a Snowflake password policy that can be
+// checked against a password before it is sent to Snowflake.
+type passwordPolicy struct {
+	name       string
+	minLength  int
+	maxLength  int
+	minUpper   int
+	minLower   int
+	minNumeric int
+	minSpecial int
+}
+
+// defaultPasswordPolicy is the policy Snowflake enforces when no password
+// policy is attached to the account.
+// See https://docs.snowflake.com/en/user-guide/password-authentication
+var defaultPasswordPolicy = passwordPolicy{
+	name:       "default",
+	minLength:  8,
+	maxLength:  256,
+	minUpper:   1,
+	minLower:   1,
+	minNumeric: 1,
+}
+
+// check returns an error describing every requirement of the policy that the
+// password does not meet.
+func (p passwordPolicy) check(password string) error {
+	var upper, lower, numeric, special int
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsDigit(r):
+			numeric++
+		default:
+			special++
+		}
+	}
+
+	var errs *multierror.Error
+	length := len([]rune(password))
+	if length < p.minLength {
+		errs = multierror.Append(errs, fmt.Errorf("must be at least %d characters long", p.minLength))
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		errs = multierror.Append(errs, fmt.Errorf("must be at most %d characters long", p.maxLength))
+	}
+	if upper < p.minUpper {
+		errs = multierror.Append(errs, fmt.Errorf("must contain at least %d upper case characters", p.minUpper))
+	}
+	if lower < p.minLower {
+		errs = multierror.Append(errs, fmt.Errorf("must contain at least %d lower case characters", p.minLower))
+	}
+	if numeric < p.minNumeric {
+		errs = multierror.Append(errs, fmt.Errorf("must contain at least %d numeric characters", p.minNumeric))
+	}
+	if special < p.minSpecial {
+		errs = multierror.Append(errs, fmt.Errorf("must contain at least %d special characters", p.minSpecial))
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return fmt.Errorf("password does not satisfy Snowflake password policy %q: %w", p.name, err)
+	}
+	return nil
+}
+
+// fetchPasswordPolicy returns the password policy named userPolicy, which
+// the plugin attaches to the users it creates and so takes precedence, or
+// if that is empty the one attached to the account, or the Snowflake
+// default policy if there is none.
+func fetchPasswordPolicy(ctx context.Context, db Database, userPolicy string) (passwordPolicy, error) {
+	// The policy is named in the statement as it is when it is attached to
+	// the users.
+	qualifiedName, policyIdentifier := userPolicy, qualifiedIdentifier(userPolicy)
+	if qualifiedName == "" {
+		var database, schema, name string
+		err := db.QueryRowContext(ctx, accountPasswordPolicySQL).Scan(&database, &schema, &name)
+		if err == sql.ErrNoRows {
+			return defaultPasswordPolicy, nil
+		}
+		if err != nil {
+			return passwordPolicy{}, fmt.Errorf("failed to look up account password policy: %w", err)
+		}
+		// The parts are the names as Snowflake stores them, so they are
+		// quoted to be matched exactly.
+		qualifiedName = strings.Join([]string{database, schema, name}, ".")
+		policyIdentifier = strings.Join([]string{quoteIdentifier(database), quoteIdentifier(schema), quoteIdentifier(name)}, ".")
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(describePasswordPolicySQL, policyIdentifier))
+	if err != nil {
+		return passwordPolicy{}, fmt.Errorf("failed to describe password policy %q: %w", qualifiedName, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return passwordPolicy{}, err
+	}
+	propertyIdx, valueIdx := -1, -1
+	for i, column := range columns {
+		switch strings.ToLower(column) {
+		case "property":
+			propertyIdx = i
+		case "value":
+			valueIdx = i
+		}
+	}
+	if propertyIdx < 0 || valueIdx < 0 {
+		return passwordPolicy{}, fmt.Errorf("unexpected columns describing password policy %q: %v", qualifiedName, columns)
+	}
+
+	policy := defaultPasswordPolicy
+	policy.name = qualifiedName
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return passwordPolicy{}, err
+		}
+
+		var field *int
+		switch values[propertyIdx].String {
+		case "PASSWORD_MIN_LENGTH":
+			field = &policy.minLength
+		case "PASSWORD_MAX_LENGTH":
+			field = &policy.maxLength
+		case "PASSWORD_MIN_UPPER_CASE_CHARS":
+			field = &policy.minUpper
+		case "PASSWORD_MIN_LOWER_CASE_CHARS":
+			field = &policy.minLower
+		case "PASSWORD_MIN_NUMERIC_CHARS":
+			field = &policy.minNumeric
+		case "PASSWORD_MIN_SPECIAL_CHARS":
+			field = &policy.minSpecial
+		default:
+			continue
+		}
+
+		n, err := strconv.Atoi(values[valueIdx].String)
+		if err != nil {
+			return passwordPolicy{}, fmt.Errorf("invalid value %q for %s in password policy %q",
+				values[valueIdx].String, values[propertyIdx].String, qualifiedName)
+		}
+		*field = n
+	}
+
+	return policy, rows.Err()
+}
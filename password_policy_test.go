@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	strict := passwordPolicy{
+		name:       "strict",
+		minLength:  12,
+		maxLength:  16,
+		minUpper:   2,
+		minLower:   2,
+		minNumeric: 2,
+		minSpecial: 1,
+	}
+
+	tests := map[string]struct {
+		policy    passwordPolicy
+		password  string
+		expectErr bool
+	}{
+		"default policy satisfied": {
+			policy:   defaultPasswordPolicy,
+			password: "y8fva_sdVA3rasf",
+		},
+		"default policy without upper case": {
+			policy:    defaultPasswordPolicy,
+			password:  "y8fva_sdva3rasf",
+			expectErr: true,
+		},
+		"default policy too short": {
+			policy:    defaultPasswordPolicy,
+			password:  "aB3",
+			expectErr: true,
+		},
+		"strict policy satisfied": {
+			policy:   strict,
+			password: "AbCd12-efgh34",
+		},
+		"strict policy without special characters": {
+			policy:    strict,
+			password:  "AbCd12efgh34",
+			expectErr: true,
+		},
+		"strict policy too long": {
+			policy:    strict,
+			password:  "AbCd12-efgh34ijklmn",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.policy.check(test.password)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
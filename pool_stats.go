@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+// statser is implemented by pools that report their statistics, as *sql.DB
+// does.
+type statser interface {
+	Stats() sql.DBStats
+}
+
+// poolStatsReporter runs reportPoolStats on an interval until stopped.
+type poolStatsReporter struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *poolStatsReporter) stop() {
+	if r == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// startPoolStatsReporter replaces any running pool stats reporter with one
+// reporting every interval.
+func (s *SnowflakeSQL) startPoolStatsReporter(interval time.Duration) {
+	s.stopPoolStatsReporter()
+	if interval == 0 {
+		return
+	}
+
+	// Gauges from every database config the process serves are told apart
+	// by the account and user they connect as.
+	labels := []metrics.Label{{Name: "user", Value: s.Username}}
+	if cfg, err := parsedConfigs.get(s.cachedKey); err == nil {
+		labels = append(labels, metrics.Label{Name: "account", Value: cfg.Account})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &poolStatsReporter{cancel: cancel, done: make(chan struct{})}
+	s.poolStats = r
+
+	go func() {
+		defer close(r.done)
+
+		// The wait count and duration are totals, so each report logs how
+		// much they grew since the last.
+		var last sql.DBStats
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if stats, ok := s.poolStatistics(); ok {
+					s.reportPoolStats(stats, last, labels)
+					last = stats
+				}
+			}
+		}
+	}()
+}
+
+func (s *SnowflakeSQL) stopPoolStatsReporter() {
+	s.poolStats.stop()
+	s.poolStats = nil
+}
+
+// poolStatistics returns the statistics of the pool getConnection last
+// handed out. It does not open a pool if there is none yet.
+func (s *SnowflakeSQL) poolStatistics() (sql.DBStats, bool) {
+	db, ok := s.loadLastConnection().(statser)
+	if !ok {
+		return sql.DBStats{}, false
+	}
+	return db.Stats(), true
+}
+
+// reportPoolStats logs stats, with the waits since last, and sets them as
+// gauges so that max_open_connections can be sized from them.
+func (s *SnowflakeSQL) reportPoolStats(stats, last sql.DBStats, labels []metrics.Label) {
+	waits := stats.WaitCount - last.WaitCount
+	waited := stats.WaitDuration - last.WaitDuration
+	if waits < 0 {
+		// The pool was reopened, and its totals started over.
+		waits, waited = stats.WaitCount, stats.WaitDuration
+	}
+
+	s.logger.Info("connection pool stats",
+		"max_open", stats.MaxOpenConnections,
+		"open", stats.OpenConnections,
+		"in_use", stats.InUse,
+		"idle", stats.Idle,
+		"waits", waits,
+		"wait_duration", waited,
+	)
+
+	gauge := func(name string, value float32) {
+		metrics.SetGaugeWithLabels([]string{snowflakeSQLTypeName, "pool", name}, value, labels)
+	}
+	gauge("max_open", float32(stats.MaxOpenConnections))
+	gauge("open", float32(stats.OpenConnections))
+	gauge("in_use", float32(stats.InUse))
+	gauge("idle", float32(stats.Idle))
+	gauge("waits", float32(waits))
+	gauge("wait_seconds", float32(waited.Seconds()))
+}
@@ -0,0 +1,80 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflakeSQL_ReportPoolStats(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	conf := metrics.DefaultConfig("test")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	_, err := metrics.NewGlobal(conf, sink)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	s := &SnowflakeSQL{logger: hclog.New(&hclog.LoggerOptions{
+		Output:     &buf,
+		JSONFormat: true,
+	})}
+
+	last := sql.DBStats{WaitCount: 3, WaitDuration: time.Second}
+	stats := sql.DBStats{
+		MaxOpenConnections: 4,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDuration:       3 * time.Second,
+	}
+	s.reportPoolStats(stats, last, []metrics.Label{{Name: "user", Value: "vault"}})
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "connection pool stats", entry["@message"])
+	require.EqualValues(t, 3, entry["in_use"])
+	require.EqualValues(t, 2, entry["waits"], "waits are reported since the last report")
+
+	gauges := sink.Data()[0].Gauges
+	require.Equal(t, float32(3), gauges["test.snowflake.pool.in_use;user=vault"].Value)
+	require.Equal(t, float32(2), gauges["test.snowflake.pool.wait_seconds;user=vault"].Value)
+
+	// A reopened pool starts its totals over.
+	buf.Reset()
+	s.reportPoolStats(sql.DBStats{WaitCount: 1, WaitDuration: time.Second}, stats, nil)
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.EqualValues(t, 1, entry["waits"])
+}
+
+func TestSnowflakeSQL_PoolStatistics(t *testing.T) {
+	db, _ := newFakeSnowflake(t, map[string]interface{}{
+		"pool_stats_interval": "1h",
+		"lazy_connection":     true,
+	})
+	require.NotNil(t, db.poolStats)
+
+	_, ok := db.poolStatistics()
+	require.False(t, ok, "no pool is opened to report on")
+
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}'",
+	))
+	require.NoError(t, err)
+
+	stats, ok := db.poolStatistics()
+	require.True(t, ok)
+	require.Equal(t, 4, stats.MaxOpenConnections)
+	require.Equal(t, 1, stats.OpenConnections)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+)
+
+// The fingerprint of the private_key and when it was first seen are kept in
+// the plugin config, which Vault stores with the response to Initialize.
+const (
+	privateKeyFingerprintField = "private_key_fingerprint"
+	privateKeySetAtField       = "private_key_set_at"
+)
+
+// privateKeyAgeOptions configures warnings about a private_key that has
+// not been rotated.
+type privateKeyAgeOptions struct {
+	maxAge  time.Duration
+	enforce bool
+}
+
+func parsePrivateKeyAgeOptions(config map[string]interface{}) (privateKeyAgeOptions, error) {
+	var opts privateKeyAgeOptions
+	var err error
+
+	if opts.maxAge, err = getDuration(config, "private_key_max_age"); err != nil {
+		return opts, err
+	}
+	if opts.enforce, err = getBool(config, "enforce_private_key_max_age"); err != nil {
+		return opts, err
+	}
+	if opts.enforce && opts.maxAge == 0 {
+		return opts, fmt.Errorf("enforce_private_key_max_age requires private_key_max_age to be set")
+	}
+	return opts, nil
+}
+
+// trackPrivateKey returns when privateKey was first configured, and records
+// it in config. A key with a new fingerprint is taken to have been set now,
+// unless private_key_set_at is given without a fingerprint, as it is when
+// an operator backdates a key that was already in use.
+func trackPrivateKey(config map[string]interface{}, privateKey string, now time.Time) (time.Time, error) {
+	if privateKey == "" {
+		delete(config, privateKeyFingerprintField)
+		delete(config, privateKeySetAtField)
+		return time.Time{}, nil
+	}
+
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fingerprint, err := privateKeyFingerprint(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	storedFingerprint, err := strutil.GetString(config, privateKeyFingerprintField)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to retrieve %s: %w", privateKeyFingerprintField, err)
+	}
+	storedSetAt, err := strutil.GetString(config, privateKeySetAtField)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to retrieve %s: %w", privateKeySetAtField, err)
+	}
+
+	setAt := now
+	if storedSetAt != "" && (storedFingerprint == fingerprint || storedFingerprint == "") {
+		if setAt, err = parseDate(storedSetAt); err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s %q: must be a date or an RFC 3339 timestamp", privateKeySetAtField, storedSetAt)
+		}
+	}
+
+	config[privateKeyFingerprintField] = fingerprint
+	config[privateKeySetAtField] = setAt.UTC().Format(time.RFC3339)
+	return setAt, nil
+}
+
+// checkPrivateKeyAge logs a message about the age of the private_key that
+// grows more severe the longer it goes unrotated: once it is three quarters
+// of private_key_max_age, once it is past it, and once it is past twice it.
+// With enforce_private_key_max_age, a key past its maximum age is an error.
+func (s *SnowflakeSQL) checkPrivateKeyAge(now time.Time) error {
+	if s.privateKeySetAt.IsZero() {
+		return nil
+	}
+	age := now.Sub(s.privateKeySetAt)
+	metrics.SetGauge([]string{snowflakeSQLTypeName, "root", "private_key_age_seconds"}, float32(age.Seconds()))
+
+	maxAge := s.privateKeyAge.maxAge
+	if maxAge == 0 {
+		return nil
+	}
+	setAt := s.privateKeySetAt.UTC().Format(time.RFC3339)
+	switch {
+	case age >= 2*maxAge:
+		s.logger.Error("private_key is more than twice private_key_max_age old, rotate it", "set_at", setAt, "max_age", maxAge)
+	case age >= maxAge:
+		s.logger.Warn("private_key is older than private_key_max_age, rotate it", "set_at", setAt, "max_age", maxAge)
+	case age >= maxAge/4*3:
+		s.logger.Info("private_key is nearing private_key_max_age", "set_at", setAt, "max_age", maxAge)
+	}
+
+	if s.privateKeyAge.enforce && age >= maxAge {
+		return fmt.Errorf("private_key was set at %s, more than private_key_max_age (%s) ago", setAt, maxAge)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func pemPrivateKey(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(testPrivateKey(t))
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestParsePrivateKeyAgeOptions(t *testing.T) {
+	opts, err := parsePrivateKeyAgeOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Zero(t, opts)
+
+	opts, err = parsePrivateKeyAgeOptions(map[string]interface{}{
+		"private_key_max_age":         "2160h",
+		"enforce_private_key_max_age": true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, privateKeyAgeOptions{maxAge: 2160 * time.Hour, enforce: true}, opts)
+
+	_, err = parsePrivateKeyAgeOptions(map[string]interface{}{"enforce_private_key_max_age": true})
+	require.EqualError(t, err, "enforce_private_key_max_age requires private_key_max_age to be set")
+}
+
+func TestTrackPrivateKey(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	key := pemPrivateKey(t)
+
+	config := map[string]interface{}{}
+	setAt, err := trackPrivateKey(config, key, now)
+	require.NoError(t, err)
+	require.Equal(t, now, setAt)
+	require.Equal(t, "2026-03-01T00:00:00Z", config[privateKeySetAtField])
+	fingerprint := config[privateKeyFingerprintField]
+	require.Contains(t, fingerprint, "SHA256:")
+
+	// The same key keeps the time it was first seen.
+	setAt, err = trackPrivateKey(config, key, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, now, setAt)
+	require.Equal(t, fingerprint, config[privateKeyFingerprintField])
+
+	// A new key resets it.
+	setAt, err = trackPrivateKey(config, pemPrivateKey(t), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), setAt)
+	require.NotEqual(t, fingerprint, config[privateKeyFingerprintField])
+
+	// A key can be backdated by giving private_key_set_at alone.
+	config = map[string]interface{}{privateKeySetAtField: "2025-12-01"}
+	setAt, err = trackPrivateKey(config, key, now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), setAt)
+	require.Equal(t, fingerprint, config[privateKeyFingerprintField])
+
+	_, err = trackPrivateKey(map[string]interface{}{privateKeySetAtField: "last week"}, key, now)
+	require.Error(t, err)
+
+	config = map[string]interface{}{
+		privateKeyFingerprintField: fingerprint,
+		privateKeySetAtField:       "2026-03-01T00:00:00Z",
+	}
+	setAt, err = trackPrivateKey(config, "", now)
+	require.NoError(t, err)
+	require.Zero(t, setAt)
+	require.Empty(t, config)
+}
+
+func TestSnowflakeSQL_CheckPrivateKeyAge(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	s := &SnowflakeSQL{
+		logger: hclog.New(&hclog.LoggerOptions{
+			Output:     &buf,
+			JSONFormat: true,
+			Level:      hclog.Info,
+		}),
+		privateKeyAge: privateKeyAgeOptions{maxAge: 40 * 24 * time.Hour},
+	}
+
+	level := func(age time.Duration) string {
+		t.Helper()
+		buf.Reset()
+		s.privateKeySetAt = now.Add(-age)
+		require.NoError(t, s.checkPrivateKeyAge(now))
+		if buf.Len() == 0 {
+			return ""
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		return entry["@level"].(string)
+	}
+	day := 24 * time.Hour
+	require.Empty(t, level(29*day))
+	require.Equal(t, "info", level(30*day))
+	require.Equal(t, "warn", level(40*day))
+	require.Equal(t, "error", level(80*day))
+
+	s.privateKeyAge.enforce = true
+	s.privateKeySetAt = now.Add(-39 * day)
+	require.NoError(t, s.checkPrivateKeyAge(now))
+	s.privateKeySetAt = now.Add(-40 * day)
+	require.Error(t, s.checkPrivateKeyAge(now))
+
+	s.privateKeySetAt = time.Time{}
+	require.NoError(t, s.checkPrivateKeyAge(now))
+}
@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	privilegeCheckWarn = "warn"
+	privilegeCheckDeny = "deny"
+
+	currentRoleSQL      = "select current_role()"
+	showGrantsToRoleSQL = "show grants to role %s"
+
+	// maxRoleHierarchySize bounds how many roles are inspected while walking
+	// the role hierarchy of the configured role.
+	maxRoleHierarchySize = 100
+)
+
+type grant struct {
+	privilege string
+	grantedOn string
+	name      string
+}
+
+// requiredPrivilege is an operation the plugin performs and the grants, any
+// one of which allows it.
+type requiredPrivilege struct {
+	operation string
+	satisfied func(grants []grant) bool
+}
+
+var requiredPrivileges = []requiredPrivilege{
+	{
+		operation: "CREATE USER",
+		satisfied: hasAccountPrivilege("CREATE USER"),
+	},
+	{
+		// Granting a role requires MANAGE GRANTS, or ownership of the role.
+		operation: "GRANT ROLE",
+		satisfied: func(grants []grant) bool {
+			if hasAccountPrivilege("MANAGE GRANTS")(grants) {
+				return true
+			}
+			for _, g := range grants {
+				if g.privilege == "OWNERSHIP" && g.grantedOn == "ROLE" {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		// The role that creates a user owns it, and owners can drop it.
+		operation: "DROP USER",
+		satisfied: hasAccountPrivilege("CREATE USER"),
+	},
+}
+
+func hasAccountPrivilege(privilege string) func([]grant) bool {
+	return func(grants []grant) bool {
+		for _, g := range grants {
+			if g.grantedOn == "ACCOUNT" && (g.privilege == privilege || g.privilege == "OWNERSHIP") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// missingPrivilegesError lists the operations the configured role does not
+// appear to have the privileges for.
+type missingPrivilegesError struct {
+	Role    string
+	Missing []string
+}
+
+func (e *missingPrivilegesError) Error() string {
+	return fmt.Sprintf("role %q is missing privileges for: %s", e.Role, strings.Join(e.Missing, ", "))
+}
+
+// missingPrivileges returns the required operations not allowed by grants.
+func missingPrivileges(grants []grant) []string {
+	var missing []string
+	for _, p := range requiredPrivileges {
+		if !p.satisfied(grants) {
+			missing = append(missing, p.operation)
+		}
+	}
+	return missing
+}
+
+// checkPrivileges verifies that the connection's current role, including
+// the roles granted to it, can create, grant roles to, and drop users.
+func checkPrivileges(ctx context.Context, db Database) error {
+	var role string
+	if err := db.QueryRowContext(ctx, currentRoleSQL).Scan(&role); err != nil {
+		return fmt.Errorf("failed to look up current role: %w", err)
+	}
+
+	grants, err := roleHierarchyGrants(ctx, db, role)
+	if err != nil {
+		return err
+	}
+
+	if missing := missingPrivileges(grants); len(missing) > 0 {
+		return &missingPrivilegesError{Role: role, Missing: missing}
+	}
+	return nil
+}
+
+// roleHierarchyGrants returns the grants to role and to every role it
+// inherits from.
+func roleHierarchyGrants(ctx context.Context, db Database, role string) ([]grant, error) {
+	var all []grant
+	seen := map[string]bool{role: true}
+	queue := []string{role}
+
+	for len(queue) > 0 && len(seen) <= maxRoleHierarchySize {
+		current := queue[0]
+		queue = queue[1:]
+
+		grants, err := grantsToRole(ctx, db, current)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range grants {
+			if g.privilege == "USAGE" && g.grantedOn == "ROLE" && !seen[g.name] {
+				seen[g.name] = true
+				queue = append(queue, g.name)
+			}
+		}
+		all = append(all, grants...)
+	}
+
+	return all, nil
+}
+
+func grantsToRole(ctx context.Context, db Database, role string) ([]grant, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(showGrantsToRoleSQL, quoteIdentifier(role)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to show grants to role %q: %w", role, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var grants []grant
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		var g grant
+		for i, column := range columns {
+			switch strings.ToLower(column) {
+			case "privilege":
+				g.privilege = strings.ToUpper(values[i].String)
+			case "granted_on":
+				g.grantedOn = strings.ToUpper(values[i].String)
+			case "name":
+				g.name = values[i].String
+			}
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, rows.Err()
+}
@@ -0,0 +1,57 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingPrivileges(t *testing.T) {
+	tests := map[string]struct {
+		grants   []grant
+		expected []string
+	}{
+		"no grants": {
+			expected: []string{"CREATE USER", "GRANT ROLE", "DROP USER"},
+		},
+		"create user only": {
+			grants: []grant{
+				{privilege: "CREATE USER", grantedOn: "ACCOUNT"},
+			},
+			expected: []string{"GRANT ROLE"},
+		},
+		"create user and manage grants": {
+			grants: []grant{
+				{privilege: "CREATE USER", grantedOn: "ACCOUNT"},
+				{privilege: "MANAGE GRANTS", grantedOn: "ACCOUNT"},
+			},
+		},
+		"create user and role ownership": {
+			grants: []grant{
+				{privilege: "CREATE USER", grantedOn: "ACCOUNT"},
+				{privilege: "OWNERSHIP", grantedOn: "ROLE", name: "ANALYST"},
+			},
+		},
+		"privileges on other objects": {
+			grants: []grant{
+				{privilege: "USAGE", grantedOn: "WAREHOUSE", name: "WH"},
+				{privilege: "MANAGE GRANTS", grantedOn: "DATABASE", name: "DB"},
+			},
+			expected: []string{"CREATE USER", "GRANT ROLE", "DROP USER"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, missingPrivileges(test.grants))
+		})
+	}
+}
+
+func TestMissingPrivilegesError(t *testing.T) {
+	err := &missingPrivilegesError{Role: "VAULT", Missing: []string{"CREATE USER", "DROP USER"}}
+	require.EqualError(t, err, `role "VAULT" is missing privileges for: CREATE USER, DROP USER`)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"golang.org/x/time/rate"
+)
+
+// parseRateLimit returns the limit and burst configured for user management
+// operations. Operations are unlimited unless rate_limit is set, and the
+// burst defaults to the limit rounded up.
+func parseRateLimit(config map[string]interface{}) (rate.Limit, int, error) {
+	raw, ok := config["rate_limit"]
+	if !ok || raw == nil || raw == "" {
+		return rate.Inf, 0, nil
+	}
+
+	limit, err := parseFloat(raw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to retrieve rate_limit: %w", err)
+	}
+	if limit <= 0 {
+		return 0, 0, fmt.Errorf("rate_limit must be positive")
+	}
+
+	burst := int(limit)
+	if float64(burst) < limit {
+		burst++
+	}
+	if burst, err = getPositiveInt(config, "rate_limit_burst", burst); err != nil {
+		return 0, 0, err
+	}
+
+	return rate.Limit(limit), burst, nil
+}
+
+func parseFloat(raw interface{}) (float64, error) {
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	}
+
+	str, err := parseutil.ParseString(raw)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+// waitForRateLimit blocks until the next operation is allowed to start.
+func (s *SnowflakeSQL) waitForRateLimit(ctx context.Context) error {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit exceeded: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	type testCase struct {
+		config        map[string]interface{}
+		expectedLimit rate.Limit
+		expectedBurst int
+		expectErr     bool
+	}
+
+	tests := map[string]testCase{
+		"unset": {
+			config:        map[string]interface{}{},
+			expectedLimit: rate.Inf,
+		},
+		"whole limit": {
+			config:        map[string]interface{}{"rate_limit": 10},
+			expectedLimit: 10,
+			expectedBurst: 10,
+		},
+		"fractional limit": {
+			config:        map[string]interface{}{"rate_limit": "2.5"},
+			expectedLimit: 2.5,
+			expectedBurst: 3,
+		},
+		"json number": {
+			config:        map[string]interface{}{"rate_limit": json.Number("0.5")},
+			expectedLimit: 0.5,
+			expectedBurst: 1,
+		},
+		"explicit burst": {
+			config:        map[string]interface{}{"rate_limit": 5.0, "rate_limit_burst": "20"},
+			expectedLimit: 5,
+			expectedBurst: 20,
+		},
+		"negative limit": {
+			config:    map[string]interface{}{"rate_limit": -1},
+			expectErr: true,
+		},
+		"invalid limit": {
+			config:    map[string]interface{}{"rate_limit": "fast"},
+			expectErr: true,
+		},
+		"invalid burst": {
+			config:    map[string]interface{}{"rate_limit": 5, "rate_limit_burst": 0},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			limit, burst, err := parseRateLimit(test.config)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedLimit, limit)
+			require.Equal(t, test.expectedBurst, burst)
+		})
+	}
+}
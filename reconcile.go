@@ -0,0 +1,241 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+)
+
+const (
+	reconcileModeReport = "report"
+	reconcileModeDrop   = "drop"
+
+	// defaultReconcileGracePeriod gives Vault time to revoke expired leases
+	// itself before a user is considered orphaned.
+	defaultReconcileGracePeriod = time.Hour
+
+	// daysToExpiryRounding is how long a lease may outlive its user's
+	// expires_at_time. The plugin sets DAYS_TO_EXPIRY to the whole days the
+	// lease has left, rounded down.
+	daysToExpiryRounding = 24 * time.Hour
+)
+
+// reconcileOptions configures the background job that finds dynamic users
+// left behind by failed revocations.
+type reconcileOptions struct {
+	interval    time.Duration
+	prefix      string
+	mode        string
+	gracePeriod time.Duration
+}
+
+func parseReconcileOptions(config map[string]interface{}, uopts usernameOptions) (reconcileOptions, error) {
+	var opts reconcileOptions
+	var err error
+
+	if opts.interval, err = getDuration(config, "reconcile_interval"); err != nil {
+		return opts, err
+	}
+	if opts.interval == 0 {
+		return opts, nil
+	}
+
+	if opts.gracePeriod, err = getDuration(config, "reconcile_grace_period"); err != nil {
+		return opts, err
+	}
+	if _, ok := config["reconcile_grace_period"]; !ok {
+		opts.gracePeriod = defaultReconcileGracePeriod
+	}
+
+	if opts.mode, err = strutil.GetString(config, "reconcile_mode"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve reconcile_mode: %w", err)
+	}
+	switch opts.mode {
+	case "":
+		opts.mode = reconcileModeReport
+	case reconcileModeReport, reconcileModeDrop:
+	default:
+		return opts, fmt.Errorf("invalid reconcile_mode %q: must be %q or %q",
+			opts.mode, reconcileModeReport, reconcileModeDrop)
+	}
+
+	if opts.prefix, err = strutil.GetString(config, "reconcile_username_prefix"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve reconcile_username_prefix: %w", err)
+	}
+	// Every mount on the account may share a template's prefix, so the
+	// users this mount owns must be named explicitly.
+	if opts.prefix == "" {
+		return opts, fmt.Errorf("reconcile_interval requires reconcile_username_prefix to be set")
+	}
+	if uopts.uppercase {
+		opts.prefix = strings.ToUpper(opts.prefix)
+	}
+
+	return opts, nil
+}
+
+type snowflakeUser struct {
+	name      string
+	expiresAt time.Time
+}
+
+// orphanedUsers returns the users whose lease must have expired more than
+// the grace period ago. Vault revokes a lease when it expires and renewals
+// move the expiration forward, so an expired user that still exists is one
+// Vault failed to revoke. The lease may end up to daysToExpiryRounding
+// after the user's expires_at_time, so that is added to the grace period.
+// Users without an expiration are never reported.
+func orphanedUsers(users []snowflakeUser, now time.Time, gracePeriod time.Duration) []string {
+	var orphans []string
+	for _, user := range users {
+		if user.expiresAt.IsZero() {
+			continue
+		}
+		if now.Sub(user.expiresAt) > daysToExpiryRounding+gracePeriod {
+			orphans = append(orphans, user.name)
+		}
+	}
+	return orphans
+}
+
+// reconciler runs reconcile on an interval until stopped.
+type reconciler struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *reconciler) stop() {
+	if r == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// startReconciler replaces any running reconciler with one using opts.
+func (s *SnowflakeSQL) startReconciler(opts reconcileOptions) {
+	s.stopReconciler()
+	if opts.interval == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &reconciler{cancel: cancel, done: make(chan struct{})}
+	s.reconciler = r
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(opts.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.reconcile(ctx, opts); err != nil {
+					s.logger.Error("failed to reconcile orphaned users", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *SnowflakeSQL) stopReconciler() {
+	s.reconciler.stop()
+	s.reconciler = nil
+}
+
+// reconcile finds users matching the username prefix that Vault should
+// already have revoked, and reports or drops them.
+func (s *SnowflakeSQL) reconcile(ctx context.Context, opts reconcileOptions) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	users, err := listUsers(ctx, db, opts.prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	orphans := orphanedUsers(users, time.Now(), opts.gracePeriod)
+	metrics.SetGauge([]string{snowflakeSQLTypeName, "reconcile", "orphans"}, float32(len(orphans)))
+
+	for _, username := range orphans {
+		if strings.EqualFold(username, s.Username) {
+			continue
+		}
+		if opts.mode != reconcileModeDrop {
+			s.logger.Warn("found orphaned user", "username", username)
+			continue
+		}
+		if err := s.dropUser(ctx, db, username); err != nil {
+			s.logger.Error("failed to drop orphaned user", "username", username, "error", err)
+			continue
+		}
+		metrics.IncrCounter([]string{snowflakeSQLTypeName, "reconcile", "dropped"}, 1)
+		s.logger.Info("dropped orphaned user", "username", username)
+	}
+
+	return nil
+}
+
+// listUsers returns the users whose names start with prefix.
+func listUsers(ctx context.Context, db Database, prefix string) ([]snowflakeUser, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("show users like '%s%%'", likePattern(prefix)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []snowflakeUser
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		var user snowflakeUser
+		for i, col := range cols {
+			switch strings.ToLower(col) {
+			case "name":
+				user.name, _ = values[i].(string)
+			case "expires_at_time":
+				user.expiresAt, _ = values[i].(time.Time)
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// likePattern escapes s for use inside a single-quoted LIKE pattern.
+func likePattern(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\\\`,
+		`'`, `''`,
+		`_`, `\\_`,
+		`%`, `\\%`,
+	).Replace(s)
+}
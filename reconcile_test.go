@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReconcileOptions(t *testing.T) {
+	tests := map[string]struct {
+		config    map[string]interface{}
+		uopts     usernameOptions
+		expected  reconcileOptions
+		expectErr bool
+	}{
+		"disabled": {
+			config: map[string]interface{}{},
+		},
+		"defaults": {
+			config: map[string]interface{}{
+				"reconcile_interval":        "10m",
+				"reconcile_username_prefix": "v_analytics_",
+			},
+			expected: reconcileOptions{
+				interval:    10 * time.Minute,
+				prefix:      "v_analytics_",
+				mode:        reconcileModeReport,
+				gracePeriod: defaultReconcileGracePeriod,
+			},
+		},
+		"prefix uppercased": {
+			config: map[string]interface{}{
+				"reconcile_interval":        600,
+				"reconcile_mode":            "drop",
+				"reconcile_grace_period":    "0s",
+				"reconcile_username_prefix": "vault_",
+			},
+			uopts: usernameOptions{uppercase: true},
+			expected: reconcileOptions{
+				interval: 10 * time.Minute,
+				prefix:   "VAULT_",
+				mode:     reconcileModeDrop,
+			},
+		},
+		"explicit prefix": {
+			config: map[string]interface{}{
+				"reconcile_interval":        "1h",
+				"reconcile_username_prefix": "app_",
+			},
+			expected: reconcileOptions{
+				interval:    time.Hour,
+				prefix:      "app_",
+				mode:        reconcileModeReport,
+				gracePeriod: defaultReconcileGracePeriod,
+			},
+		},
+		"no prefix": {
+			config:    map[string]interface{}{"reconcile_interval": "1h"},
+			expectErr: true,
+		},
+		"invalid mode": {
+			config: map[string]interface{}{
+				"reconcile_interval":        "1h",
+				"reconcile_mode":            "delete",
+				"reconcile_username_prefix": "v_analytics_",
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts, err := parseReconcileOptions(test.config, test.uopts)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, opts)
+		})
+	}
+}
+
+func TestOrphanedUsers(t *testing.T) {
+	now := time.Date(2024, 9, 4, 12, 0, 0, 0, time.UTC)
+	users := []snowflakeUser{
+		{name: "V_ACTIVE", expiresAt: now.Add(time.Hour)},
+		// DAYS_TO_EXPIRY rounds down, so the lease may still be live.
+		{name: "V_LEASE_MAY_BE_LIVE", expiresAt: now.Add(-23 * time.Hour)},
+		{name: "V_IN_GRACE", expiresAt: now.Add(-24*time.Hour - 30*time.Minute)},
+		{name: "V_ORPHANED", expiresAt: now.Add(-26 * time.Hour)},
+		{name: "V_NO_EXPIRY"},
+	}
+
+	require.Equal(t, []string{"V_ORPHANED"}, orphanedUsers(users, now, time.Hour))
+}
+
+func TestLikePattern(t *testing.T) {
+	require.Equal(t, `v\\_o''brien\\%`, likePattern(`v_o'brien%`))
+}
@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+const redacted = "[redacted]"
+
+var (
+	// sensitiveDSNParam matches DSN query parameters that carry credentials.
+	sensitiveDSNParam = regexp.MustCompile(`(?i)\b(password|passcode|privateKey|token|oauthClientSecret)=[^&\s"']*`)
+
+	// dsnUserInfo matches the user:password@ prefix of a DSN.
+	dsnUserInfo = regexp.MustCompile(`^([^:@/?]*):[^?]*@`)
+
+	// jwt matches a serialized JSON Web Token, such as the one the driver
+	// signs for keypair authentication.
+	jwt = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+)
+
+// redactDSN returns the DSN with its password and any credential-bearing
+// query parameters replaced, so it is safe to log.
+func redactDSN(dsn string) string {
+	dsn = dsnUserInfo.ReplaceAllString(dsn, "${1}:"+redacted+"@")
+	return redactString(dsn)
+}
+
+// redactString replaces credential-bearing DSN parameters and JWTs found
+// anywhere in s.
+func redactString(s string) string {
+	s = sensitiveDSNParam.ReplaceAllString(s, "${1}="+redacted)
+	return jwt.ReplaceAllString(s, redacted)
+}
+
+func (s *SnowflakeSQL) secretValues() map[string]string {
+	secrets := map[string]string{}
+	addPassword := func(password string) {
+		if password == "" {
+			return
+		}
+		secrets[password] = "[password]"
+		secrets[url.PathEscape(password)] = "[password]"
+		secrets[url.QueryEscape(password)] = "[password]"
+	}
+
+	addPrivateKey := func(privateKey string) {
+		if privateKey == "" {
+			return
+		}
+		secrets[privateKey] = redacted
+		secrets[string(privateKeyPEM(privateKey))] = redacted
+		if key, err := parsePrivateKey(privateKey); err == nil {
+			if encoded, err := encodePrivateKey(key); err == nil {
+				secrets[encoded] = redacted
+			}
+		}
+	}
+
+	addPassword(s.Password)
+	addPrivateKey(s.privateKey)
+	addPrivateKey(s.privateKey2)
+	addPassword(s.verification.password)
+	addPrivateKey(s.verification.privateKey)
+	for _, dsn := range append([]string{s.ConnectionURL}, s.failoverDSNs...) {
+		if dsn == "" {
+			continue
+		}
+		secrets[dsn] = redactDSN(dsn)
+		if cfg, err := gosnowflake.ParseDSN(dsn); err == nil {
+			addPassword(cfg.Password)
+			addPassword(cfg.Passcode)
+			if cfg.Token != "" {
+				secrets[cfg.Token] = redacted
+			}
+		}
+	}
+
+	return secrets
+}
+
+var (
+	_ dbplugin.Database       = redactionMiddleware{}
+	_ logical.PluginVersioner = redactionMiddleware{}
+)
+
+// redactionMiddleware wraps a Database and scrubs credential-bearing DSN
+// parameters and JWTs from returned errors. It complements the SDK's error
+// sanitizer, which can only replace exact known secret values.
+type redactionMiddleware struct {
+	next dbplugin.Database
+}
+
+func (mw redactionMiddleware) Initialize(ctx context.Context, req dbplugin.InitializeRequest) (dbplugin.InitializeResponse, error) {
+	resp, err := mw.next.Initialize(ctx, req)
+	return resp, redactError(err)
+}
+
+func (mw redactionMiddleware) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
+	resp, err := mw.next.NewUser(ctx, req)
+	return resp, redactError(err)
+}
+
+func (mw redactionMiddleware) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+	resp, err := mw.next.UpdateUser(ctx, req)
+	return resp, redactError(err)
+}
+
+func (mw redactionMiddleware) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (dbplugin.DeleteUserResponse, error) {
+	resp, err := mw.next.DeleteUser(ctx, req)
+	return resp, redactError(err)
+}
+
+func (mw redactionMiddleware) Type() (string, error) {
+	return mw.next.Type()
+}
+
+func (mw redactionMiddleware) Close() error {
+	return redactError(mw.next.Close())
+}
+
+func (mw redactionMiddleware) PluginVersion() logical.PluginVersion {
+	return pluginVersion(mw.next)
+}
+
+// redactError returns err unchanged unless its message contains something
+// that needs redacting, in which case a new error with the redacted message
+// is returned.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if scrubbed := redactString(msg); scrubbed != msg {
+		return errors.New(scrubbed)
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRevocationBatchSize        = 50
+	defaultRevocationBatchConcurrency = 4
+)
+
+// revocationQueueOptions configures batching of revocations. Batching is
+// disabled unless a window is set.
+type revocationQueueOptions struct {
+	window      time.Duration
+	size        int
+	concurrency int
+}
+
+func parseRevocationQueueOptions(config map[string]interface{}) (revocationQueueOptions, error) {
+	var opts revocationQueueOptions
+	var err error
+
+	if opts.window, err = getDuration(config, "revocation_batch_window"); err != nil {
+		return opts, err
+	}
+	if opts.size, err = getPositiveInt(config, "revocation_batch_size", defaultRevocationBatchSize); err != nil {
+		return opts, err
+	}
+	if opts.concurrency, err = getPositiveInt(config, "revocation_batch_concurrency", defaultRevocationBatchConcurrency); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+type revocation struct {
+	queries []string
+	done    chan error
+}
+
+// revocationQueue coalesces revocations that arrive within a window of each
+// other into batches executed in a single round trip, with a bounded number
+// of batches in flight. It is only used for revocations with the default
+// statements, which are idempotent, so that when a batch fails each of its
+// revocations can be retried on its own to find which one failed.
+type revocationQueue struct {
+	opts revocationQueueOptions
+
+	// exec runs already rendered queries in one round trip.
+	exec func(ctx context.Context, queries []string) error
+
+	sem chan struct{}
+
+	mu      sync.Mutex
+	pending []*revocation
+	timer   *time.Timer
+}
+
+func newRevocationQueue(opts revocationQueueOptions, exec func(context.Context, []string) error) *revocationQueue {
+	return &revocationQueue{
+		opts: opts,
+		exec: exec,
+		sem:  make(chan struct{}, opts.concurrency),
+	}
+}
+
+// submit queues the rendered queries of a revocation and waits for the
+// batch they are executed in.
+func (q *revocationQueue) submit(ctx context.Context, queries []string) error {
+	r := &revocation{queries: queries, done: make(chan error, 1)}
+
+	q.mu.Lock()
+	q.pending = append(q.pending, r)
+	if len(q.pending) >= q.opts.size {
+		go q.flush(q.takeLocked())
+	} else if q.timer == nil {
+		q.timer = time.AfterFunc(q.opts.window, func() {
+			q.mu.Lock()
+			batch := q.takeLocked()
+			q.mu.Unlock()
+			q.flush(batch)
+		})
+	}
+	q.mu.Unlock()
+
+	select {
+	case err := <-r.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *revocationQueue) takeLocked() []*revocation {
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	batch := q.pending
+	q.pending = nil
+	return batch
+}
+
+func (q *revocationQueue) flush(batch []*revocation) {
+	if len(batch) == 0 {
+		return
+	}
+
+	q.sem <- struct{}{}
+	defer func() { <-q.sem }()
+
+	// The batch outlives any one request, so it runs on its own context.
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	var queries []string
+	for _, r := range batch {
+		queries = append(queries, r.queries...)
+	}
+	if err := q.exec(ctx, queries); err == nil {
+		for _, r := range batch {
+			r.done <- nil
+		}
+		return
+	}
+
+	for _, r := range batch {
+		if err := q.exec(ctx, r.queries); err != nil {
+			r.done <- fmt.Errorf("failed to revoke user: %w", err)
+			continue
+		}
+		r.done <- nil
+	}
+}
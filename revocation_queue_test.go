@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExec struct {
+	mu    sync.Mutex
+	calls [][]string
+	fail  string
+}
+
+func (e *recordingExec) exec(_ context.Context, queries []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls = append(e.calls, queries)
+	for _, query := range queries {
+		if query == e.fail {
+			return errors.New("drop failed")
+		}
+	}
+	return nil
+}
+
+func submitAll(q *revocationQueue, queries ...string) []error {
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			errs[i] = q.submit(context.Background(), []string{query})
+		}(i, query)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestRevocationQueue_Batches(t *testing.T) {
+	e := &recordingExec{}
+	q := newRevocationQueue(revocationQueueOptions{window: 50 * time.Millisecond, size: 10, concurrency: 1}, e.exec)
+
+	errs := submitAll(q, "drop user a", "drop user b", "drop user c")
+	require.Equal(t, []error{nil, nil, nil}, errs)
+
+	require.Len(t, e.calls, 1)
+	sort.Strings(e.calls[0])
+	require.Equal(t, []string{"drop user a", "drop user b", "drop user c"}, e.calls[0])
+}
+
+func TestRevocationQueue_FlushesFullBatch(t *testing.T) {
+	e := &recordingExec{}
+	q := newRevocationQueue(revocationQueueOptions{window: time.Hour, size: 2, concurrency: 1}, e.exec)
+
+	errs := submitAll(q, "drop user a", "drop user b")
+	require.Equal(t, []error{nil, nil}, errs)
+	require.Len(t, e.calls, 1)
+}
+
+func TestRevocationQueue_RetriesFailedBatchIndividually(t *testing.T) {
+	e := &recordingExec{fail: "drop user b"}
+	q := newRevocationQueue(revocationQueueOptions{window: 50 * time.Millisecond, size: 10, concurrency: 1}, e.exec)
+
+	errs := submitAll(q, "drop user a", "drop user b", "drop user c")
+	require.NoError(t, errs[0])
+	require.Error(t, errs[1])
+	require.NoError(t, errs[2])
+	require.Len(t, e.calls, 4)
+}
+
+func TestParseRevocationQueueOptions(t *testing.T) {
+	opts, err := parseRevocationQueueOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Equal(t, revocationQueueOptions{
+		size:        defaultRevocationBatchSize,
+		concurrency: defaultRevocationBatchConcurrency,
+	}, opts)
+
+	_, err = parseRevocationQueueOptions(map[string]interface{}{"revocation_batch_size": 0})
+	require.Error(t, err)
+}
@@ -0,0 +1,237 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+)
+
+const (
+	quotaOpAdd    = "add"
+	quotaOpRemove = "remove"
+)
+
+type quotaEntry struct {
+	Op       string `json:"op"`
+	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+}
+
+// roleQuota counts the active dynamic users of each Vault role, and refuses
+// to create more than max_users_per_role of them, so that a runaway client
+// cannot use up the account's users. When role_quota_path is configured,
+// the users are also written to disk, in the format of the creation
+// journal, so that they are still counted after the plugin restarts.
+type roleQuota struct {
+	mu    sync.Mutex
+	path  string
+	max   int
+	users map[string]string
+}
+
+// newRoleQuota returns the quota configured by max_users_per_role and
+// role_quota_path, loading the users recorded at the path. With no limit
+// configured, users are not counted and nil is returned.
+func newRoleQuota(config map[string]interface{}) (*roleQuota, error) {
+	limit, err := getPositiveInt(config, "max_users_per_role", 0)
+	if err != nil {
+		return nil, err
+	}
+	path, err := strutil.GetString(config, "role_quota_path")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve role_quota_path: %w", err)
+	}
+	if limit == 0 {
+		if path != "" {
+			return nil, fmt.Errorf("role_quota_path requires max_users_per_role to be set")
+		}
+		return nil, nil
+	}
+
+	q := &roleQuota{path: path, max: limit, users: map[string]string{}}
+	if path == "" {
+		return q, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open role quota file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry quotaEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final write from a crash is expected; skip it.
+			continue
+		}
+		switch entry.Op {
+		case quotaOpAdd:
+			q.users[entry.Username] = entry.Role
+		case quotaOpRemove:
+			delete(q.users, entry.Username)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read role quota file: %w", err)
+	}
+
+	return q, q.compact()
+}
+
+// reserve counts username as an active user of role, unless role already
+// has as many as the quota allows. A username already counted, as it is
+// when its creation is being resumed, is not counted twice.
+func (q *roleQuota) reserve(role, username string) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.users[username]; ok {
+		return nil
+	}
+	var active int
+	for _, r := range q.users {
+		if r == role {
+			active++
+		}
+	}
+	if active >= q.max {
+		metrics.IncrCounter([]string{snowflakeSQLTypeName, "role_quota", "rejected"}, 1)
+		return fmt.Errorf("max_users_per_role of %d reached for role %q", q.max, role)
+	}
+
+	if err := q.append(quotaEntry{Op: quotaOpAdd, Username: username, Role: role}); err != nil {
+		return err
+	}
+	q.users[username] = role
+	return nil
+}
+
+// release stops counting username, once it has been dropped or its
+// creation has failed.
+func (q *roleQuota) release(username string) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.users[username]; !ok {
+		return nil
+	}
+	delete(q.users, username)
+	return q.append(quotaEntry{Op: quotaOpRemove, Username: username})
+}
+
+// list returns the counted usernames and their roles.
+func (q *roleQuota) list() map[string]string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	users := make(map[string]string, len(q.users))
+	for username, role := range q.users {
+		users[username] = role
+	}
+	return users
+}
+
+// adopt counts the users other counts, so that the users created under a
+// previous configuration are not forgotten.
+func (q *roleQuota) adopt(other *roleQuota) error {
+	if q == nil || other == nil || other == q {
+		return nil
+	}
+	users := other.list()
+	usernames := make([]string, 0, len(users))
+	for username := range users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, username := range usernames {
+		if _, ok := q.users[username]; ok {
+			continue
+		}
+		if err := q.append(quotaEntry{Op: quotaOpAdd, Username: username, Role: users[username]}); err != nil {
+			return err
+		}
+		q.users[username] = users[username]
+	}
+	return nil
+}
+
+func (q *roleQuota) append(entry quotaEntry) error {
+	if q.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open role quota file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write role quota file: %w", err)
+	}
+	return f.Sync()
+}
+
+// compact rewrites the quota file so it only holds the counted users.
+func (q *roleQuota) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to compact role quota file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	for username, role := range q.users {
+		if err := enc.Encode(quotaEntry{Op: quotaOpAdd, Username: username, Role: role}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact role quota file: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact role quota file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact role quota file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), q.path)
+}
+
+// releaseQuota stops counting a user that has been dropped. The user is
+// gone either way, so a failure to record it is only logged.
+func (s *SnowflakeSQL) releaseQuota(username string) {
+	if err := s.roleQuota.release(username); err != nil {
+		s.logger.Error("failed to update role quota file", "username", username, "error", err)
+	}
+}
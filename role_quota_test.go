@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleQuota(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota")
+	config := map[string]interface{}{"max_users_per_role": 2, "role_quota_path": path}
+
+	q, err := newRoleQuota(config)
+	require.NoError(t, err)
+	require.NoError(t, q.reserve("analyst", "v_analyst_a"))
+	require.NoError(t, q.reserve("analyst", "v_analyst_b"))
+	require.NoError(t, q.reserve("analyst", "v_analyst_b"), "a resumed creation should not be counted twice")
+	require.EqualError(t, q.reserve("analyst", "v_analyst_c"), `max_users_per_role of 2 reached for role "analyst"`)
+	require.NoError(t, q.reserve("admin", "v_admin_a"))
+
+	require.NoError(t, q.release("v_analyst_a"))
+	require.NoError(t, q.release("v_unknown"))
+
+	// Simulate a torn write left behind by a crash.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"add","usern`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reloaded, err := newRoleQuota(config)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"v_analyst_b": "analyst", "v_admin_a": "admin"}, reloaded.list())
+	require.NoError(t, reloaded.reserve("analyst", "v_analyst_c"))
+	require.Error(t, reloaded.reserve("analyst", "v_analyst_d"))
+
+	inMemory, err := newRoleQuota(map[string]interface{}{"max_users_per_role": 1})
+	require.NoError(t, err)
+	require.NoError(t, inMemory.adopt(reloaded))
+	require.Len(t, inMemory.list(), 3)
+
+	q, err = newRoleQuota(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Nil(t, q)
+	require.NoError(t, q.reserve("analyst", "v_analyst_a"))
+
+	_, err = newRoleQuota(map[string]interface{}{"role_quota_path": path})
+	require.EqualError(t, err, "role_quota_path requires max_users_per_role to be set")
+	_, err = newRoleQuota(map[string]interface{}{"max_users_per_role": 0})
+	require.EqualError(t, err, "max_users_per_role must be positive")
+}
+
+func TestFakeSnowflake_RoleQuota(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"max_users_per_role": 1})
+	statement := "CREATE USER {{name}} PASSWORD = '{{password}}';"
+
+	createResp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(statement))
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest(statement))
+	require.ErrorContains(t, err, `max_users_per_role of 1 reached for role "analyst"`)
+	require.Len(t, fake.Users(), 1)
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: createResp.Username})
+	dbtesting.AssertNewUser(t, db, fakeNewUserRequest(statement))
+
+	// A failed creation does not use up the quota.
+	fake.FailOn("CREATE USER", os.ErrDeadlineExceeded)
+	other := fakeNewUserRequest(statement)
+	other.UsernameConfig.RoleName = "reporting"
+	_, err = db.NewUser(context.Background(), other)
+	require.Error(t, err)
+	fake.ClearFailures()
+	dbtesting.AssertNewUser(t, db, other)
+}
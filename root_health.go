@@ -0,0 +1,219 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+// defaultRootExpiryWarning is how long before the root user expires the
+// health check starts warning about it.
+const defaultRootExpiryWarning = 7 * 24 * time.Hour
+
+// rootHealthOptions configures the background job that checks whether the
+// user the plugin connects as can still log in.
+type rootHealthOptions struct {
+	interval      time.Duration
+	expiryWarning time.Duration
+}
+
+func parseRootHealthOptions(config map[string]interface{}) (rootHealthOptions, error) {
+	var opts rootHealthOptions
+	var err error
+
+	if opts.interval, err = getDuration(config, "root_health_check_interval"); err != nil {
+		return opts, err
+	}
+	if opts.interval == 0 {
+		return opts, nil
+	}
+
+	if opts.expiryWarning, err = getDuration(config, "root_expiry_warning"); err != nil {
+		return opts, err
+	}
+	if _, ok := config["root_expiry_warning"]; !ok {
+		opts.expiryWarning = defaultRootExpiryWarning
+	}
+	return opts, nil
+}
+
+// rootUserStatus is what SHOW USERS reports about the root user.
+type rootUserStatus struct {
+	found              bool
+	disabled           bool
+	mustChangePassword bool
+	lockedUntil        time.Time
+	expiresAt          time.Time
+}
+
+// problems returns why the root user cannot log in at now, or will not be
+// able to within warning.
+func (u rootUserStatus) problems(now time.Time, warning time.Duration) []string {
+	if !u.found {
+		return []string{"user not visible to SHOW USERS"}
+	}
+
+	var problems []string
+	if u.disabled {
+		problems = append(problems, "disabled")
+	}
+	if u.lockedUntil.After(now) {
+		problems = append(problems, "locked until "+u.lockedUntil.UTC().Format(time.RFC3339))
+	}
+	if u.mustChangePassword {
+		problems = append(problems, "must change password")
+	}
+	switch {
+	case u.expiresAt.IsZero():
+	case !u.expiresAt.After(now):
+		problems = append(problems, "expired at "+u.expiresAt.UTC().Format(time.RFC3339))
+	case u.expiresAt.Sub(now) <= warning:
+		problems = append(problems, "expires at "+u.expiresAt.UTC().Format(time.RFC3339))
+	}
+	return problems
+}
+
+// rootHealthChecker runs checkRootHealth on an interval until stopped.
+type rootHealthChecker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (c *rootHealthChecker) stop() {
+	if c == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+}
+
+// startRootHealthChecker replaces any running root health checker with one
+// using opts.
+func (s *SnowflakeSQL) startRootHealthChecker(opts rootHealthOptions) {
+	s.stopRootHealthChecker()
+	if opts.interval == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &rootHealthChecker{cancel: cancel, done: make(chan struct{})}
+	s.rootHealth = c
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(opts.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.checkRootHealth(ctx, opts); err != nil {
+					s.logger.Error("failed to check root user health", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *SnowflakeSQL) stopRootHealthChecker() {
+	s.rootHealth.stop()
+	s.rootHealth = nil
+}
+
+// checkRootHealth warns if the root user cannot log in, or will not be able
+// to soon, so that it can be fixed before user management and root
+// rotation start failing.
+func (s *SnowflakeSQL) checkRootHealth(ctx context.Context, opts rootHealthOptions) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, err := describeRootUser(ctx, db, s.Username)
+	if err != nil {
+		return fmt.Errorf("failed to describe root user: %w", err)
+	}
+
+	// The age of the private_key is only enforced by Initialize.
+	_ = s.checkPrivateKeyAge(time.Now())
+
+	problems := status.problems(time.Now(), opts.expiryWarning)
+	metrics.SetGauge([]string{snowflakeSQLTypeName, "root", "problems"}, float32(len(problems)))
+	if len(problems) > 0 {
+		s.logger.Warn("root user needs attention", "username", s.Username, "problems", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// describeRootUser returns the SHOW USERS status of username.
+func describeRootUser(ctx context.Context, db Database, username string) (rootUserStatus, error) {
+	var status rootUserStatus
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("show users like '%s'", likePattern(username)))
+	if err != nil {
+		return status, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return status, err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return status, err
+		}
+
+		user := rootUserStatus{}
+		for i, col := range cols {
+			switch strings.ToLower(col) {
+			case "name":
+				name, _ := values[i].(string)
+				user.found = strings.EqualFold(name, username)
+			case "disabled":
+				user.disabled = isTrue(values[i])
+			case "must_change_password":
+				user.mustChangePassword = isTrue(values[i])
+			case "locked_until_time":
+				user.lockedUntil, _ = values[i].(time.Time)
+			case "expires_at_time":
+				user.expiresAt, _ = values[i].(time.Time)
+			}
+		}
+		// LIKE is case insensitive, so it can match other users too.
+		if user.found {
+			status = user
+		}
+	}
+
+	return status, rows.Err()
+}
+
+// isTrue reports whether a SHOW column value, which Snowflake returns as a
+// string, is true.
+func isTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRootHealthOptions(t *testing.T) {
+	opts, err := parseRootHealthOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Zero(t, opts.interval)
+
+	opts, err = parseRootHealthOptions(map[string]interface{}{"root_health_check_interval": "1h"})
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, opts.interval)
+	require.Equal(t, defaultRootExpiryWarning, opts.expiryWarning)
+
+	opts, err = parseRootHealthOptions(map[string]interface{}{
+		"root_health_check_interval": "1h",
+		"root_expiry_warning":        "0",
+	})
+	require.NoError(t, err)
+	require.Zero(t, opts.expiryWarning)
+
+	_, err = parseRootHealthOptions(map[string]interface{}{"root_health_check_interval": "soon"})
+	require.Error(t, err)
+}
+
+func TestRootUserStatus_Problems(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	require.Empty(t, rootUserStatus{found: true}.problems(now, time.Hour))
+	require.Equal(t, []string{"user not visible to SHOW USERS"}, rootUserStatus{}.problems(now, time.Hour))
+	require.Equal(t, []string{
+		"disabled",
+		"locked until 2026-03-01T01:00:00Z",
+		"must change password",
+		"expires at 2026-03-01T00:30:00Z",
+	}, rootUserStatus{
+		found:              true,
+		disabled:           true,
+		mustChangePassword: true,
+		lockedUntil:        now.Add(time.Hour),
+		expiresAt:          now.Add(30 * time.Minute),
+	}.problems(now, time.Hour))
+
+	require.Empty(t, rootUserStatus{found: true, lockedUntil: now.Add(-time.Hour), expiresAt: now.Add(2 * time.Hour)}.problems(now, time.Hour))
+	require.Equal(t, []string{"expired at 2026-02-28T23:00:00Z"}, rootUserStatus{found: true, expiresAt: now.Add(-time.Hour)}.problems(now, time.Hour))
+}
+
+func TestDescribeRootUser(t *testing.T) {
+	db, _ := newFakeSnowflake(t, nil)
+	pool, err := db.getConnection(context.Background())
+	require.NoError(t, err)
+
+	_, err = pool.ExecContext(context.Background(), "create user vault; create user VAULTX; alter user vault set disabled = true")
+	require.NoError(t, err)
+
+	status, err := describeRootUser(context.Background(), pool, "vault")
+	require.NoError(t, err)
+	require.True(t, status.found)
+	require.True(t, status.disabled)
+	require.False(t, status.mustChangePassword)
+
+	status, err = describeRootUser(context.Background(), pool, "nobody")
+	require.NoError(t, err)
+	require.False(t, status.found)
+}
+
+func TestSnowflakeSQL_Initialize_RootHealthRequiresUsername(t *testing.T) {
+	db := new()
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":             "user:password@account/db",
+			"root_health_check_interval": "1h",
+		},
+	})
+	require.ErrorContains(t, err, "requires username")
+}
@@ -25,6 +25,13 @@ BUILD_TAGS="${BUILD_TAGS}:-${TOOL}"
 GIT_COMMIT="$(git rev-parse HEAD)"
 GIT_DIRTY="$(test -n "`git status --porcelain`" && echo "+CHANGES" || true)"
 
+# Get the version, from the tag of the commit unless it is set
+VERSION=${VERSION:-$(git describe --tags --exact-match 2>/dev/null || true)}
+LD_FLAGS="-X 'github.com/hashicorp/${TOOL}/version.GitCommit=${GIT_COMMIT}${GIT_DIRTY}'"
+if [ -n "${VERSION}" ]; then
+    LD_FLAGS="${LD_FLAGS} -X 'github.com/hashicorp/${TOOL}/version.Version=${VERSION}'"
+fi
+
 GOPATH=${GOPATH:-$(go env GOPATH)}
 case $(uname) in
     CYGWIN*)
@@ -41,7 +48,7 @@ mkdir -p bin/
 # Build!
 ${GO_CMD} build \
     -gcflags "${GCFLAGS}" \
-    -ldflags "-X github.com/hashicorp/${TOOL}/version.GitCommit='${GIT_COMMIT}${GIT_DIRTY}'" \
+    -ldflags "${LD_FLAGS}" \
     -o "bin/${TOOL}" \
     -tags "${BUILD_TAGS}" \
     "${DIR}/cmd/${TOOL}"
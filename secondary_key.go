@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// errCodeInvalidJWT is the error Snowflake refuses a keypair login with
+// when the JWT is not signed by either of the user's keys.
+const errCodeInvalidJWT = 390144
+
+// secondaryKey parses private_key_2, the key the plugin logs in with when
+// Snowflake refuses private_key. With the new key set as the user's
+// RSA_PUBLIC_KEY_2, it lets the keys be rotated without a moment where the
+// plugin cannot log in.
+func (o connectionOptions) secondaryKey() (*rsa.PrivateKey, error) {
+	if o.privateKey2 == "" {
+		return nil, nil
+	}
+	if o.privateKey == "" {
+		return nil, fmt.Errorf("private_key_2 requires private_key to be set")
+	}
+	key, err := parsePrivateKey(o.privateKey2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private_key_2: %w", err)
+	}
+	if err := checkRSAKeySize("private_key_2", &key.PublicKey, o.minKeyBits); err != nil {
+		return nil, err
+	}
+	if primary, err := parsePrivateKey(o.privateKey); err == nil && primary.Equal(key) {
+		return nil, fmt.Errorf("private_key_2 must be a different key than private_key")
+	}
+	return key, nil
+}
+
+// keyFallback is a connector for an account that logs in with the primary
+// key, or with the secondary key if Snowflake refuses the primary. Once
+// the secondary key has been used, new connections try it first, so that
+// after the user's RSA_PUBLIC_KEY is replaced every login does not start
+// with a refusal.
+type keyFallback struct {
+	primary   driver.Connector
+	secondary driver.Connector
+
+	mu           sync.Mutex
+	preferSecond bool
+}
+
+var _ driver.Connector = (*keyFallback)(nil)
+
+// newConnector returns a connector for cfg that falls back to secondaryKey,
+// if there is one.
+func newConnector(cfg *gosnowflake.Config, secondaryKey *rsa.PrivateKey) driver.Connector {
+	primary := gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, *cfg)
+	if secondaryKey == nil {
+		return primary
+	}
+	secondaryCfg := *cfg
+	secondaryCfg.PrivateKey = secondaryKey
+	return &keyFallback{
+		primary:   primary,
+		secondary: gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, secondaryCfg),
+	}
+}
+
+func (k *keyFallback) Connect(ctx context.Context) (driver.Conn, error) {
+	k.mu.Lock()
+	first, second := k.primary, k.secondary
+	preferSecond := k.preferSecond
+	k.mu.Unlock()
+	if preferSecond {
+		first, second = second, first
+	}
+
+	conn, err := first.Connect(ctx)
+	if err == nil || !isKeyRefused(err) {
+		return conn, err
+	}
+	conn, err = second.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.preferSecond = !preferSecond
+	k.mu.Unlock()
+	return conn, nil
+}
+
+func (k *keyFallback) Driver() driver.Driver {
+	return gosnowflake.SnowflakeDriver{}
+}
+
+// isKeyRefused reports whether err from connecting means Snowflake did not
+// accept the key the login was signed with.
+func isKeyRefused(err error) bool {
+	var sfErr *gosnowflake.SnowflakeError
+	return errors.As(err, &sfErr) && sfErr.Number == errCodeInvalidJWT
+}
+
+// secondaryKeyFingerprint returns the fingerprint of key, or nothing if
+// there is no key.
+func secondaryKeyFingerprint(key *rsa.PrivateKey) string {
+	if key == nil {
+		return ""
+	}
+	fingerprint, _ := privateKeyFingerprint(key)
+	return fingerprint
+}
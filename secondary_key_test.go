@@ -0,0 +1,146 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFallback_Connect(t *testing.T) {
+	refused := &gosnowflake.SnowflakeError{Number: errCodeInvalidJWT, Message: "JWT token is invalid."}
+	primary, secondary := &stubConnector{err: refused}, &stubConnector{}
+	k := &keyFallback{primary: primary, secondary: secondary}
+
+	_, err := k.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, primary.calls)
+	require.Equal(t, 1, secondary.calls)
+
+	// The secondary key is tried first once it has been used.
+	_, err = k.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, primary.calls)
+	require.Equal(t, 2, secondary.calls)
+
+	// Other errors do not fall back.
+	secondary.err = errors.New("unreachable")
+	_, err = k.Connect(context.Background())
+	require.EqualError(t, err, "unreachable")
+	require.Equal(t, 1, primary.calls)
+
+	secondary.err = refused
+	_, err = k.Connect(context.Background())
+	require.ErrorIs(t, err, refused)
+}
+
+func TestConnectionOptions_SecondaryKey(t *testing.T) {
+	encode := func() string {
+		der, err := x509.MarshalPKCS8PrivateKey(testPrivateKey(t))
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+	primary, secondary := encode(), encode()
+
+	key, err := connectionOptions{privateKey: primary}.secondaryKey()
+	require.NoError(t, err)
+	require.Nil(t, key)
+
+	key, err = connectionOptions{privateKey: primary, privateKey2: secondary}.secondaryKey()
+	require.NoError(t, err)
+	require.NotNil(t, key)
+
+	_, err = connectionOptions{privateKey2: secondary}.secondaryKey()
+	require.EqualError(t, err, "private_key_2 requires private_key to be set")
+
+	_, err = connectionOptions{privateKey: primary, privateKey2: primary}.secondaryKey()
+	require.EqualError(t, err, "private_key_2 must be a different key than private_key")
+
+	_, err = connectionOptions{privateKey: primary, privateKey2: "not a key"}.secondaryKey()
+	require.ErrorContains(t, err, "invalid private_key_2")
+
+	_, err = connectionOptions{privateKey: primary, privateKey2: secondary, minKeyBits: 4096}.secondaryKey()
+	require.ErrorContains(t, err, "private_key_2 is a 2048 bit RSA key")
+}
+
+func TestConfigCache_SecondaryKey(t *testing.T) {
+	cache := &configCache{entries: map[string]*cachedConfig{}}
+	dsn := "vault:password@account/db"
+	key := testPrivateKey(t)
+
+	fallbackKey := mustAcquire(t, cache, dsn, nil, networkOptions{}, key)
+	_, ok := cache.entries[fallbackKey].connector.(*keyFallback)
+	require.True(t, ok)
+
+	// The same DSN without the secondary key, as the old instance holds
+	// while Vault replaces a config, gets its own entry.
+	plainKey := mustAcquire(t, cache, dsn, nil, networkOptions{}, nil)
+	require.NotEqual(t, fallbackKey, plainKey)
+	require.Nil(t, cache.entries[plainKey].connector)
+	require.Equal(t, fallbackKey, mustAcquire(t, cache, dsn, nil, networkOptions{}, key))
+	require.NotEqual(t, fallbackKey, mustAcquire(t, cache, dsn, nil, networkOptions{}, testPrivateKey(t)))
+	cache.release(fallbackKey)
+	cache.release(fallbackKey)
+	cache.release(plainKey)
+	require.Len(t, cache.entries, 1)
+
+	// Each failover account falls back to the secondary key.
+	failoverKey := mustAcquire(t, cache, dsn, []string{"vault:password@failover/db"}, networkOptions{}, key)
+	f, ok := cache.entries[failoverKey].connector.(*failover)
+	require.True(t, ok)
+	require.Len(t, f.connectors, 2)
+	for _, connector := range f.connectors {
+		require.IsType(t, &keyFallback{}, connector)
+	}
+}
+
+func TestSnowflakeSQL_Initialize_SecondaryKey(t *testing.T) {
+	encode := func() string {
+		der, err := x509.MarshalPKCS8PrivateKey(testPrivateKey(t))
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+	primary, secondary := encode(), encode()
+
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+	dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": "myorg-myaccount/db",
+			"username":       "vault",
+			"private_key":    primary,
+		},
+	})
+
+	// Vault starts the instance for a rewritten config before it closes
+	// the old one, so adding private_key_2 must not conflict with the
+	// config the first instance still holds.
+	other := new()
+	defer dbtesting.AssertClose(t, other)
+	dbtesting.AssertInitialize(t, other, dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": "myorg-myaccount/db",
+			"username":       "vault",
+			"private_key":    primary,
+			"private_key_2":  secondary,
+		},
+	})
+	require.NotEqual(t, db.cachedKey, other.cachedKey)
+
+	connector, err := cachedDriver{}.OpenConnector(other.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, &keyFallback{}, connector)
+
+	connector, err = cachedDriver{}.OpenConnector(db.cachedKey)
+	require.NoError(t, err)
+	require.IsType(t, gosnowflake.Connector{}, connector)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"sync"
+)
+
+// keyedMutex serializes the operations that share a key. Concurrent GRANT
+// statements on the same Snowflake role can deadlock or time out waiting
+// for its lock, so with serialize_user_operations set, creations for the
+// same Vault role run one at a time. Vault does not name the role of a
+// user it revokes, so revocations are keyed by the user instead.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// lock waits until key is free or ctx is done, and returns the function
+// that frees it.
+func (k *keyedMutex) lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{sem: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	select {
+	case l.sem <- struct{}{}:
+		return func() {
+			<-l.sem
+			k.release(key, l)
+		}, nil
+	case <-ctx.Done():
+		k.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (k *keyedMutex) release(key string, l *keyedLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if l.refs--; l.refs == 0 {
+		delete(k.locks, key)
+	}
+}
+
+// lockUserOperation serializes the operation with others for the same key
+// if serialize_user_operations is set. The returned function must be called
+// when the operation is done.
+func (s *SnowflakeSQL) lockUserOperation(ctx context.Context, key string) (func(), error) {
+	if !s.serializeUserOperations {
+		return func() {}, nil
+	}
+	return s.userOperationLocks.lock(ctx, key)
+}
+
+func creationLockKey(roleName string) string {
+	return "role:" + roleName
+}
+
+func revocationLockKey(username string) string {
+	return "revoke:" + username
+}
@@ -0,0 +1,122 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var k keyedMutex
+
+	unlockA, err := k.lock(context.Background(), "a")
+	require.NoError(t, err)
+
+	// Other keys are not blocked.
+	unlockB, err := k.lock(context.Background(), "b")
+	require.NoError(t, err)
+	unlockB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = k.lock(ctx, "a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := k.lock(context.Background(), "a")
+		require.NoError(t, err)
+		close(acquired)
+		unlock()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock should be held")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlockA()
+	<-acquired
+
+	require.Eventually(t, func() bool {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		return len(k.locks) == 0
+	}, time.Second, time.Millisecond, "unused locks should be removed")
+}
+
+func TestSnowflakeSQL_SerializeUserOperations(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"serialize_user_operations": true})
+
+	var running, maxRunning atomic.Int32
+	fake.FailOnFunc("GRANT ROLE", func() error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dbtesting.AssertNewUser(t, db, fakeNewUserRequest(
+				"CREATE USER {{name}} PASSWORD = '{{password}}'",
+				"GRANT ROLE public TO USER {{name}}",
+			))
+		}()
+	}
+	wg.Wait()
+	require.Len(t, fake.Users(), 5)
+	require.EqualValues(t, 1, maxRunning.Load(), "creations for the same role should not overlap")
+}
+
+func TestSnowflakeSQL_SerializeRevocationsPerUser(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"serialize_user_operations": true})
+	statement := "CREATE USER {{name}} PASSWORD = '{{password}}'"
+	first := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(statement))
+	second := dbtesting.AssertNewUser(t, db, fakeNewUserRequest(statement))
+
+	// Each revocation waits for the other, which only finishes if users
+	// with the default revocation statements are not serialized together.
+	arrived := make(chan struct{}, 2)
+	fake.FailOnFunc("drop user", func() error {
+		arrived <- struct{}{}
+		timeout := time.After(5 * time.Second)
+		for len(arrived) < 2 {
+			select {
+			case <-timeout:
+				return errors.New("revocations of different users did not overlap")
+			case <-time.After(time.Millisecond):
+			}
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for _, username := range []string{first.Username, second.Username} {
+		wg.Add(1)
+		go func(username string) {
+			defer wg.Done()
+			dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: username})
+		}(username)
+	}
+	wg.Wait()
+	require.Empty(t, fake.Users())
+}
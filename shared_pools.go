@@ -0,0 +1,224 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+// errInstanceClosed is returned for connections requested of an instance
+// after it has been closed.
+var errInstanceClosed = errors.New("plugin instance is closed")
+
+// sharedPools holds the connection pools of every plugin instance in the
+// process, keyed by everything that determines how their connections are
+// opened. Vault writes a database config by initializing a new instance
+// and closing the old one, so when only settings such as username_template
+// change the new instance takes over the old one's pool instead of logging
+// in to Snowflake again.
+var sharedPools = &poolRegistry{pools: map[string]*sharedPool{}}
+
+type poolRegistry struct {
+	mu    sync.Mutex
+	pools map[string]*sharedPool
+}
+
+// sharedPool is a connection pool and the number of instances using it.
+type sharedPool struct {
+	key  string
+	db   Database
+	refs int
+}
+
+// acquire returns the pool for key, opening it with open if no instance
+// holds one.
+func (r *poolRegistry) acquire(key string, open func() (Database, error)) (*sharedPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.pools[key]; ok {
+		p.refs++
+		return p, nil
+	}
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	p := &sharedPool{key: key, db: db, refs: 1}
+	r.pools[key] = p
+	return p, nil
+}
+
+// release gives up a reference to p, closing it once no instance uses it.
+func (r *poolRegistry) release(p *sharedPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p.refs--; p.refs > 0 {
+		return
+	}
+	if r.pools[p.key] == p {
+		delete(r.pools, p.key)
+	}
+	p.db.Close()
+}
+
+// discard releases p and stops handing it out, so that the next instance
+// to acquire its key opens a new pool. Instances still holding p keep
+// using it until they discard it themselves.
+func (r *poolRegistry) discard(p *sharedPool) {
+	r.mu.Lock()
+	if r.pools[p.key] == p {
+		delete(r.pools, p.key)
+	}
+	r.mu.Unlock()
+	r.release(p)
+}
+
+// poolKey returns the key of the pool for the current configuration. Its
+// connection URL holds the credentials, so instances only share a pool
+// that logs in as the same user.
+func (s *SnowflakeSQL) poolKey() string {
+	s.SQLConnectionProducer.Lock()
+	defer s.SQLConnectionProducer.Unlock()
+
+	return strings.Join([]string{
+		s.SQLConnectionProducer.Type,
+		s.ConnectionURL,
+		strings.Join(s.failoverDSNs, " "),
+		fmt.Sprintf("%v", s.cachedNetwork),
+		secondaryKeyFingerprint(s.cachedSecondaryKey),
+		fmt.Sprintf("%d/%d/%v/%s", s.MaxOpenConnections, s.MaxIdleConnections, s.MaxConnectionLifetimeRaw, s.maxConnectionIdleTime),
+	}, "\x00")
+}
+
+// openPool opens a connection pool for the current configuration, with
+// the limits the connection producer would apply.
+func (s *SnowflakeSQL) openPool() (Database, error) {
+	s.SQLConnectionProducer.Lock()
+	driverName, dsn := s.SQLConnectionProducer.Type, s.ConnectionURL
+	if s.cachedKey != "" && keyDSN(s.cachedKey) == dsn {
+		dsn = dataSourceName(driverName, s.cachedKey)
+	}
+	maxOpen, maxIdle := s.MaxOpenConnections, s.MaxIdleConnections
+	lifetimeRaw := s.MaxConnectionLifetimeRaw
+	s.SQLConnectionProducer.Unlock()
+
+	var lifetime time.Duration
+	if lifetimeRaw != nil {
+		var err error
+		if lifetime, err = parseutil.ParseDurationSecond(lifetimeRaw); err != nil {
+			return nil, fmt.Errorf("invalid max_connection_lifetime: %w", err)
+		}
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(lifetime)
+	return NewSQLDatabase(db), nil
+}
+
+// sharedDatabase returns the pool shared by the instances configured like
+// this one, after checking that it can still reach Snowflake. Concurrent
+// callers share one check, and so never open more than one pool.
+func (s *SnowflakeSQL) sharedDatabase(ctx context.Context) (Database, error) {
+	s.SQLConnectionProducer.Lock()
+	initialized := s.Initialized
+	s.SQLConnectionProducer.Unlock()
+	if !initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	key := s.poolKey()
+	for {
+		ch := s.poolOpens.DoChan(key, func() (interface{}, error) {
+			return s.checkSharedDatabase(ctx, key)
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			if res.Err != nil && res.Shared && isContextError(res.Err) {
+				// The context of the caller that ran the check ended,
+				// but this caller's has not.
+				continue
+			}
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			return res.Val.(Database), nil
+		}
+	}
+}
+
+// checkSharedDatabase pings this instance's pool and returns it. A pool
+// that cannot reach Snowflake is discarded, and a new one opened, as the
+// connection producer reestablishes its own.
+func (s *SnowflakeSQL) checkSharedDatabase(ctx context.Context, key string) (Database, error) {
+	s.poolMu.Lock()
+	current := s.pool
+	s.poolMu.Unlock()
+
+	var broken bool
+	if current != nil && current.key == key {
+		if current.db.PingContext(ctx) == nil {
+			return current.db, nil
+		}
+		broken = true
+	}
+
+	s.poolMu.Lock()
+	defer s.poolMu.Unlock()
+	if s.poolClosed {
+		return nil, errInstanceClosed
+	}
+	if s.pool == current && current != nil {
+		if broken {
+			sharedPools.discard(current)
+		} else {
+			// The configuration changed, and instances still configured
+			// the old way may keep using the old pool.
+			sharedPools.release(current)
+		}
+		s.pool = nil
+	}
+	if s.pool == nil {
+		p, err := sharedPools.acquire(key, s.openPool)
+		if err != nil {
+			return nil, err
+		}
+		s.pool = p
+	}
+	return s.pool.db, nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// releasePool gives up this instance's reference to its pool when it is
+// closed. A connection opening concurrently fails rather than acquiring a
+// pool that would never be released.
+func (s *SnowflakeSQL) releasePool() {
+	s.poolMu.Lock()
+	defer s.poolMu.Unlock()
+	s.poolClosed = true
+	if s.pool != nil {
+		sharedPools.release(s.pool)
+		s.pool = nil
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault-plugin-database-snowflake/snowflaketest"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflakeSQL_SharedPool(t *testing.T) {
+	fake := snowflaketest.NewFake()
+	initialize := func(config map[string]interface{}) *SnowflakeSQL {
+		db := new()
+		db.SQLConnectionProducer.Type = fake.DriverName()
+		conf := map[string]interface{}{"connection_url": "vault:password@fake/db"}
+		for k, v := range config {
+			conf[k] = v
+		}
+		dbtesting.AssertInitialize(t, db, dbplugin.InitializeRequest{Config: conf, VerifyConnection: true})
+		return db
+	}
+
+	// Vault initializes the rewritten config before closing the old one.
+	old := initialize(nil)
+	logins := len(fake.DSNs())
+	updated := initialize(map[string]interface{}{"username_template": "{{ .RoleName }}_{{ random 8 }}"})
+	require.Same(t, old.loadLastConnection(), updated.loadLastConnection())
+	dbtesting.AssertClose(t, old)
+
+	_, err := updated.NewUser(context.Background(), fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	require.NoError(t, err)
+	require.Len(t, fake.DSNs(), logins, "the pool should have been kept, without logging in again")
+
+	resized := initialize(map[string]interface{}{"max_open_connections": 2})
+	require.NotSame(t, updated.loadLastConnection(), resized.loadLastConnection())
+	dbtesting.AssertClose(t, resized)
+
+	pool, key := updated.loadLastConnection(), updated.poolKey()
+	dbtesting.AssertClose(t, updated)
+	require.Error(t, pool.PingContext(context.Background()), "the pool should be closed with the last instance using it")
+	require.NotContains(t, sharedPools.pools, key)
+}
+
+func TestSnowflakeSQL_ConcurrentConnections(t *testing.T) {
+	db, _ := newFakeSnowflake(t, nil)
+	// Make the goroutines below race to open the pool.
+	db.releasePool()
+	db.poolClosed = false
+
+	var runs atomic.Int32
+	checks := func(ctx context.Context) error {
+		runs.Add(1)
+		// The checks get connections themselves.
+		_, err := db.getConnection(ctx)
+		return err
+	}
+	db.onFirstConnection.Store(&checks)
+
+	var wg sync.WaitGroup
+	conns := make([]Database, 10)
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := db.getConnection(context.Background())
+			require.NoError(t, err)
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	for _, conn := range conns {
+		require.Same(t, conns[0], conn)
+	}
+	require.EqualValues(t, 1, runs.Load())
+
+	dbtesting.AssertClose(t, db)
+	db.SQLConnectionProducer.Initialized = true
+	_, err := db.getConnection(context.Background())
+	require.ErrorIs(t, err, errInstanceClosed)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+type slowStatementLogKey struct{}
+
+// slowStatementLog logs the statements that take longer than threshold to
+// run, with their Snowflake query ID, so that slow operations can be
+// matched to the query history.
+type slowStatementLog struct {
+	threshold time.Duration
+	logger    hclog.Logger
+}
+
+// withSlowStatementLog returns a context in which execStatement logs the
+// statements slower than slow_statement_threshold.
+func (s *SnowflakeSQL) withSlowStatementLog(ctx context.Context) context.Context {
+	if s.slowStatementThreshold == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, slowStatementLogKey{}, &slowStatementLog{
+		threshold: s.slowStatementThreshold,
+		logger:    s.logger,
+	})
+}
+
+// observeStatement logs query if it has been running since start for
+// longer than the threshold of the context's slow statement log. query is
+// the statement template, so it does not contain credentials.
+func observeStatement(ctx context.Context, query, queryID string, start time.Time) {
+	l, _ := ctx.Value(slowStatementLogKey{}).(*slowStatementLog)
+	if l == nil {
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= l.threshold {
+		l.logger.Warn("slow statement", "statement", query, "query_id", queryID, "duration", elapsed)
+	}
+}
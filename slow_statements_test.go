@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflakeSQL_SlowStatementLog(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"slow_statement_threshold": "50ms",
+	})
+	var buf bytes.Buffer
+	db.logger = hclog.New(&hclog.LoggerOptions{
+		Output:     &buf,
+		JSONFormat: true,
+	})
+
+	fake.FailOnFunc("grant", func() error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	req := fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}'",
+		"GRANT ROLE public TO USER {{name}}",
+	)
+	_, err := db.NewUser(context.Background(), req)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1, "only the slow statement should be logged")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	require.Equal(t, "slow statement", entry["@message"])
+	require.Equal(t, "GRANT ROLE public TO USER {{name}}", entry["statement"])
+	require.Contains(t, entry, "query_id")
+	require.NotContains(t, buf.String(), req.Password)
+}
+
+func TestSnowflakeSQL_SlowStatementLog_Disabled(t *testing.T) {
+	db, _ := newFakeSnowflake(t, nil)
+	ctx := context.Background()
+	require.Equal(t, ctx, db.withSlowStatementLog(ctx))
+
+	// Without a slow statement log in the context nothing is logged.
+	observeStatement(ctx, "drop user {{name}}", "", time.Now().Add(-time.Hour))
+}
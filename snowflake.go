@@ -5,21 +5,30 @@ package snowflake
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rsa"
+	"errors"
 	"fmt"
 	"math"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault-plugin-database-snowflake/version"
 	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
 	"github.com/hashicorp/vault/sdk/database/helper/connutil"
 	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
-	"github.com/hashicorp/vault/sdk/helper/dbtxn"
 	"github.com/hashicorp/vault/sdk/helper/template"
-	_ "github.com/snowflakedb/gosnowflake"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/snowflakedb/gosnowflake"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -34,32 +43,59 @@ alter user {{name}} set PASSWORD = '{{password}}';
 alter user {{name}} set RSA_PUBLIC_KEY = '{{public_key}}';
 `
 	defaultSnowflakeDeleteSQL = `
+alter user if exists {{name}} unset RSA_PUBLIC_KEY, RSA_PUBLIC_KEY_2;
 drop user if exists {{name}};
 `
+	// revokeRSAPublicKeySQL disables keypair login for a user whose
+	// revocation statements failed, so its credential is dead even if the
+	// user could not be dropped.
+	revokeRSAPublicKeySQL = `alter user if exists {{name}} unset RSA_PUBLIC_KEY, RSA_PUBLIC_KEY_2`
+
 	defaultUserNameTemplate = `{{ printf "v_%s_%s_%s_%s" (.DisplayName | truncate 32) (.RoleName | truncate 32) (random 20) (unix_time) | truncate 255 | replace "-" "_" }}`
 )
 
-var _ dbplugin.Database = (*SnowflakeSQL)(nil)
+var (
+	_ dbplugin.Database       = (*SnowflakeSQL)(nil)
+	_ logical.PluginVersioner = (*SnowflakeSQL)(nil)
+)
 
 func New() (interface{}, error) {
-	db := new()
-	// Wrap the plugin with middleware to sanitize errors
-	dbType := dbplugin.NewDatabaseErrorSanitizerMiddleware(db, db.secretValues)
-	return dbType, nil
+	return wrap(new()), nil
 }
 
-func (s *SnowflakeSQL) secretValues() map[string]string {
-	return map[string]string{
-		s.Password: "[password]",
-	}
+// NewWithDatabase returns a plugin that runs its statements on db instead
+// of opening a connection pool from its config, and closes db when it is
+// closed.
+func NewWithDatabase(db Database) (interface{}, error) {
+	s := new()
+	s.injectedDB = db
+	return wrap(s), nil
+}
+
+// wrap returns db wrapped in the middleware shared by every plugin.
+func wrap(db *SnowflakeSQL) dbplugin.Database {
+	// Wrap the plugin with middleware to trace operations, emit metrics,
+	// and sanitize errors
+	var dbType dbplugin.Database = tracingMiddleware{next: db}
+	dbType = metricsMiddleware{next: dbType}
+	dbType = redactionMiddleware{next: dbType}
+	dbType = dbplugin.NewDatabaseErrorSanitizerMiddleware(dbType, db.secretValues)
+	return dbType
 }
 
 func new() *SnowflakeSQL {
 	connProducer := &connutil.SQLConnectionProducer{}
-	connProducer.Type = snowflakeSQLTypeName
+	connProducer.Type = cachedDriverName
 
 	db := &SnowflakeSQL{
 		SQLConnectionProducer: connProducer,
+		logger: hclog.New(&hclog.LoggerOptions{
+			Name:       snowflakeSQLTypeName,
+			Output:     os.Stderr,
+			JSONFormat: true,
+		}),
+		journal: &creationJournal{pending: map[string]time.Time{}},
+		limiter: rate.NewLimiter(rate.Inf, 0),
 	}
 
 	return db
@@ -69,34 +105,311 @@ type SnowflakeSQL struct {
 	*connutil.SQLConnectionProducer
 	sync.RWMutex
 
-	usernameProducer template.StringTemplate
+	usernameProducer    template.StringTemplate
+	usernameOptions     usernameOptions
+	userProperties      userProperties
+	passwordPolicyCheck string
+	privateKey          string
+	privateKey2         string
+
+	logger             hclog.Logger
+	journal            *creationJournal
+	roleQuota          *roleQuota
+	reconciler         *reconciler
+	rootHealth         *rootHealthChecker
+	poolStats          *poolStatsReporter
+	audit              *auditLog
+	asyncVerification  *asyncVerification
+	keyRotation        keyRotationOptions
+	ephemeralRole      ephemeralRoleOptions
+	ephemeralSchema    ephemeralSchemaOptions
+	ephemeralWarehouse ephemeralWarehouseOptions
+	ephemeralNetwork   ephemeralNetworkPolicyOptions
+	statementHooks     statementHooks
+
+	// dryRun makes NewUser and DeleteUser return the statements they
+	// would run as a dryRunError.
+	dryRun bool
+
+	// serializeUserOperations makes NewUser and DeleteUser take a lock
+	// from userOperationLocks.
+	serializeUserOperations bool
+	userOperationLocks      keyedMutex
+
+	// resumeCreationWindow is how long after NewUser starts creating a
+	// user a retry that generates the same name resumes the creation.
+	// Zero disables resuming.
+	resumeCreationWindow time.Duration
+	recentCreations      recentCreations
+
+	// operations are the user operations in flight, which Close drains.
+	operations operationDrain
+
+	// parallelStatements is the number of independent creation
+	// statements run at once. Below 2 they run one after another.
+	parallelStatements int
+
+	// slowStatementThreshold is how long a statement runs before it is
+	// logged as slow. Zero disables the log.
+	slowStatementThreshold time.Duration
+
+	revocations   *revocationQueue
+	limiter       *rate.Limiter
+	minRSAKeyBits int
+	keyPromotions keyPromotions
+
+	// operationLimit bounds the user operations in flight to
+	// max_concurrent_operations.
+	operationLimit concurrencyLimit
+
+	// privateKeySetAt is when privateKey was first configured, as tracked
+	// in the plugin config.
+	privateKeySetAt time.Time
+	privateKeyAge   privateKeyAgeOptions
+
+	// verification, if set, is the user that connection verification logs
+	// in as. Initialize then does not open the pool of the configured
+	// user, which is first connected by an operation.
+	verification verificationOptions
+
+	// verifyNewCredentials makes NewUser log in as each password user it
+	// creates before returning it. RSA key pair users are not verified,
+	// since Vault keeps their private key.
+	verifyNewCredentials bool
+
+	// maxConnectionIdleTime is applied to each new connection pool. The
+	// embedded connection producer does not support it.
+	maxConnectionIdleTime time.Duration
+
+	// injectedDB, if set, is used instead of the connection producer's
+	// pool, and closed with the plugin.
+	injectedDB Database
+
+	// pool is this instance's reference to the connection pool it shares
+	// with the instances configured the same way, and poolOpens the checks
+	// of it in flight. poolClosed is set once Close has released it.
+	poolMu     sync.Mutex
+	pool       *sharedPool
+	poolClosed bool
+	poolOpens  singleflight.Group
+
+	// checksMu makes operations wait for the first connection checks that
+	// another is running.
+	checksMu sync.Mutex
+
+	// lastConnection is the most recent connection pool handed out by
+	// getConnection, used to detect when the pool has been reestablished.
+	// It holds a lastDatabase.
+	lastConnection atomic.Value
+
+	// cachedDSN is the connection URL whose parsed config this instance
+	// holds in parsedConfigs at cachedKey, and failoverDSNs, cachedNetwork,
+	// and cachedSecondaryKey the failover accounts, network options, and
+	// private_key_2 it was cached with.
+	cachedDSN          string
+	cachedKey          string
+	failoverDSNs       []string
+	cachedNetwork      networkOptions
+	cachedSecondaryKey *rsa.PrivateKey
+
+	// onFirstConnection holds the checks Initialize defers until the first
+	// operation when lazy_connection is set.
+	onFirstConnection atomic.Pointer[func(context.Context) error]
 }
 
 func (s *SnowflakeSQL) Type() (string, error) {
 	return snowflakeSQLTypeName, nil
 }
 
-func (s *SnowflakeSQL) getConnection(ctx context.Context) (*sql.DB, error) {
-	db, err := s.Connection(ctx)
+// PluginVersion reports the version of the plugin binary to Vault.
+func (s *SnowflakeSQL) PluginVersion() logical.PluginVersion {
+	return logical.PluginVersion{Version: version.Version}
+}
+
+// pluginVersion returns the version reported by db, for middleware to pass
+// through.
+func pluginVersion(db dbplugin.Database) logical.PluginVersion {
+	if versioner, ok := db.(logical.PluginVersioner); ok {
+		return versioner.PluginVersion()
+	}
+	return logical.EmptyPluginVersion
+}
+
+func (s *SnowflakeSQL) Close() error {
+	s.stopAsyncVerification()
+	s.stopReconciler()
+	s.stopRootHealthChecker()
+	s.stopPoolStatsReporter()
+	s.keyPromotions.stop()
+
+	// User operations are given closeDrainTimeout to finish, and those
+	// still running are then cancelled. They hold the lock for reading, so
+	// taking it waits for the cancelled ones to return before what they
+	// use is closed.
+	if !s.operations.drain(closeDrainTimeout) {
+		s.logger.Warn("cancelled user operations still running on close", "timeout", closeDrainTimeout)
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	s.audit.close(closeDrainTimeout)
+	if err := s.SQLConnectionProducer.Close(); err != nil {
+		return err
+	}
+	s.releasePool()
+	s.releaseConnectionConfig()
+	if s.injectedDB != nil {
+		return s.injectedDB.Close()
+	}
+	return nil
+}
+
+func (s *SnowflakeSQL) getConnection(ctx context.Context) (Database, error) {
+	db, err := s.openDatabase(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return db.(*sql.DB), nil
+	if prev := s.swapLastConnection(db); prev != db {
+		// Snowflake closes idle sessions server side, so evict pooled
+		// connections before they go stale.
+		setConnMaxIdleTime(db, s.maxConnectionIdleTime)
+		if prev != nil {
+			emitConnectionReopened()
+		}
+	}
+
+	if err := s.runFirstConnectionChecks(ctx); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// connectionChecksKey marks the context the first connection checks run
+// in, since they get connections themselves.
+type connectionChecksKey struct{}
+
+// runFirstConnectionChecks runs the checks Initialize deferred, if they
+// have not passed yet. Operations arriving while another runs them wait
+// for the outcome, rather than going ahead unchecked.
+func (s *SnowflakeSQL) runFirstConnectionChecks(ctx context.Context) error {
+	if s.onFirstConnection.Load() == nil || ctx.Value(connectionChecksKey{}) != nil {
+		return nil
+	}
+
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	if checks := s.onFirstConnection.Swap(nil); checks != nil {
+		if err := (*checks)(context.WithValue(ctx, connectionChecksKey{}, true)); err != nil {
+			// Retry on the next operation rather than letting it through.
+			s.onFirstConnection.CompareAndSwap(nil, checks)
+			return err
+		}
+	}
+	return nil
+}
+
+// Connection returns the pool the plugin runs statements on. It replaces
+// the connection producer's, which would open a pool of its own without
+// holding its lock.
+func (s *SnowflakeSQL) Connection(ctx context.Context) (interface{}, error) {
+	return s.getConnection(ctx)
 }
 
 func (s *SnowflakeSQL) Initialize(ctx context.Context, req dbplugin.InitializeRequest) (dbplugin.InitializeResponse, error) {
-	err := s.SQLConnectionProducer.Initialize(ctx, req.Config, req.VerifyConnection)
+	// Checks still running in the background for a previous configuration
+	// must not race with this one.
+	s.stopAsyncVerification()
+
+	s.poolMu.Lock()
+	s.poolClosed = false
+	s.poolMu.Unlock()
+
+	lazyConnection, err := getBool(req.Config, "lazy_connection")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	asyncVerify, err := getBool(req.Config, "verify_connection_async")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if lazyConnection && asyncVerify {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("lazy_connection and verify_connection_async cannot both be set")
+	}
+
+	connectionURL, err := strutil.GetString(req.Config, "connection_url")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to retrieve connection_url: %w", err)
+	}
+	if connectionURL != "" {
+		if req.Config["connection_url"], err = stripURLScheme("connection_url", connectionURL); err != nil {
+			return dbplugin.InitializeResponse{}, err
+		}
+	}
+
+	connOpts, err := parseConnectionOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.privateKey = connOpts.privateKey
+	s.privateKey2 = connOpts.privateKey2
+	s.minRSAKeyBits = connOpts.minKeyBits
+
+	s.verification, err = parseVerificationOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if err := s.verification.recordKeyFingerprint(req.Config); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.verifyNewCredentials, err = getBool(req.Config, "verify_new_credentials")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	// Options the connection producer does not support are added to the
+	// connection URL, and the URL parsed, after the producer has been
+	// initialized, so verification waits until then.
+	verifyConnection := req.VerifyConnection && !lazyConnection && !asyncVerify
+	err = s.SQLConnectionProducer.Initialize(ctx, req.Config, false)
 	if err != nil {
 		return dbplugin.InitializeResponse{}, err
 	}
 
+	if err := s.configureConnection(ctx, connOpts, verifyConnection); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.maxConnectionIdleTime, err = getDuration(req.Config, "max_connection_idle_time")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if db := s.loadLastConnection(); db != nil {
+		setConnMaxIdleTime(db, s.maxConnectionIdleTime)
+	}
+
+	logLevel, err := parseLogLevel(req.Config, "log_level", hclog.Info)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.logger.SetLevel(logLevel)
+
+	driverLogLevel, err := parseLogLevel(req.Config, "driver_log_level", defaultDriverLogLevel)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if err := bridgeDriverLogs(driverLogLevel); err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to set driver_log_level: %w", err)
+	}
+
 	usernameTemplate, err := strutil.GetString(req.Config, "username_template")
 	if err != nil {
 		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to retrieve username_template: %w", err)
 	}
 	if usernameTemplate == "" {
 		usernameTemplate = defaultUserNameTemplate
+	} else if err := checkTemplateFunctions(usernameTemplate); err != nil {
+		return dbplugin.InitializeResponse{}, err
 	}
 
 	up, err := template.NewTemplate(template.Template(usernameTemplate))
@@ -110,6 +423,219 @@ func (s *SnowflakeSQL) Initialize(ctx context.Context, req dbplugin.InitializeRe
 		return dbplugin.InitializeResponse{}, fmt.Errorf("invalid username template: %w", err)
 	}
 
+	s.usernameOptions, err = parseUsernameOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.userProperties, err = parseUserProperties(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.ephemeralRole, err = parseEphemeralRoleOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.ephemeralSchema, err = parseEphemeralSchemaOptions(req.Config, s.ephemeralRole)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.ephemeralWarehouse, err = parseEphemeralWarehouseOptions(req.Config, s.ephemeralRole)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.ephemeralNetwork, err = parseEphemeralNetworkPolicyOptions(req.Config, s.userProperties)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.dryRun, err = getBool(req.Config, "dry_run")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if s.dryRun {
+		s.logger.Warn("dry_run is set, user creations and revocations will return their statements without executing them")
+	}
+
+	s.serializeUserOperations, err = getBool(req.Config, "serialize_user_operations")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.resumeCreationWindow, err = getDuration(req.Config, "resume_creation_window")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.parallelStatements, err = getPositiveInt(req.Config, "parallel_statements", 1)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.slowStatementThreshold, err = getDuration(req.Config, "slow_statement_threshold")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.statementHooks, err = parseStatementHooks(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if err := s.statementHooks.check(s.ephemeralVariables(map[string]string{"name": "", "username": ""})); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	limit, burst, err := parseRateLimit(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.limiter.SetLimit(limit)
+	s.limiter.SetBurst(burst)
+
+	maxOperations, err := getPositiveInt(req.Config, "max_concurrent_operations", 0)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.operationLimit.setLimit(maxOperations)
+
+	revocationOpts, err := parseRevocationQueueOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.revocations = nil
+	if revocationOpts.window > 0 {
+		s.revocations = newRevocationQueue(revocationOpts, s.execRevocationBatch)
+	}
+
+	s.keyRotation, err = parseKeyRotationOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	reconcileOpts, err := parseReconcileOptions(req.Config, s.usernameOptions)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	rootHealthOpts, err := parseRootHealthOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if rootHealthOpts.interval != 0 && s.Username == "" {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("root_health_check_interval requires username to be set")
+	}
+
+	poolStatsInterval, err := getDuration(req.Config, "pool_stats_interval")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	auditOpts, err := parseAuditOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	s.privateKeyAge, err = parsePrivateKeyAgeOptions(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.privateKeySetAt, err = trackPrivateKey(req.Config, s.privateKey, time.Now())
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if err := s.checkPrivateKeyAge(time.Now()); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+
+	passwordPolicyCheck, err := strutil.GetString(req.Config, "password_policy_check")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to retrieve password_policy_check: %w", err)
+	}
+	switch passwordPolicyCheck {
+	case "", passwordPolicyCheckWarn, passwordPolicyCheckDeny:
+		s.passwordPolicyCheck = passwordPolicyCheck
+	default:
+		return dbplugin.InitializeResponse{}, fmt.Errorf("invalid password_policy_check %q: must be %q or %q",
+			passwordPolicyCheck, passwordPolicyCheckWarn, passwordPolicyCheckDeny)
+	}
+
+	privilegeCheck, err := strutil.GetString(req.Config, "privilege_check")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to retrieve privilege_check: %w", err)
+	}
+	switch privilegeCheck {
+	case "", privilegeCheckWarn, privilegeCheckDeny:
+	default:
+		return dbplugin.InitializeResponse{}, fmt.Errorf("invalid privilege_check %q: must be %q or %q",
+			privilegeCheck, privilegeCheckWarn, privilegeCheckDeny)
+	}
+
+	journalPath, err := strutil.GetString(req.Config, "creation_journal_path")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to retrieve creation_journal_path: %w", err)
+	}
+	journal, err := newCreationJournal(journalPath)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if err := journal.adopt(s.journal); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.journal = journal
+
+	quota, err := newRoleQuota(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if err := quota.adopt(s.roleQuota); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	s.roleQuota = quota
+	verifyQuery, err := strutil.GetString(req.Config, "verify_connection_query")
+	if err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to retrieve verify_connection_query: %w", err)
+	}
+
+	connectionChecks := func(ctx context.Context) error {
+		if req.VerifyConnection && verifyQuery != "" {
+			if err := s.runVerifyQuery(ctx, verifyQuery); err != nil {
+				return fmt.Errorf("error verifying connection: %w", err)
+			}
+		}
+		s.replayCreationJournal(ctx)
+		if privilegeCheck != "" {
+			return s.preflightPrivileges(ctx, privilegeCheck)
+		}
+		return nil
+	}
+	switch {
+	case lazyConnection:
+		s.onFirstConnection.Store(&connectionChecks)
+	case asyncVerify:
+		s.startAsyncVerification(req.VerifyConnection, connectionChecks)
+	default:
+		s.onFirstConnection.Store(nil)
+		if err := connectionChecks(ctx); err != nil {
+			return dbplugin.InitializeResponse{}, err
+		}
+	}
+
+	audit, err := newAuditLog(auditOpts, s.logger)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	prevAudit := s.audit
+	s.audit = audit
+	prevAudit.close(closeDrainTimeout)
+
+	s.startReconciler(reconcileOpts)
+	s.startRootHealthChecker(rootHealthOpts)
+	s.startPoolStatsReporter(poolStatsInterval)
+
 	resp := dbplugin.InitializeResponse{
 		Config: req.Config,
 	}
@@ -121,41 +647,67 @@ func (s *SnowflakeSQL) Initialize(ctx context.Context, req dbplugin.InitializeRe
 	return resp, nil
 }
 
-func (s *SnowflakeSQL) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
+func (s *SnowflakeSQL) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (_ dbplugin.NewUserResponse, err error) {
 	s.RLock()
 	defer s.RUnlock()
 
+	ctx, done := s.operations.begin(ctx)
+	defer done()
+	ctx, progress := withStatementProgress(ctx)
+	defer func() { err = classifyError(progress.interrupted(ctx, err)) }()
+	ctx = s.withSlowStatementLog(ctx)
+	ctx, event := s.startAudit(ctx, "create", req.UsernameConfig.RoleName, "")
+	defer func() { event.finish(err) }()
+
+	if err := s.waitForRateLimit(ctx); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	release, err := s.acquireOperationSlot(ctx)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	defer release()
+
 	statements := req.Statements.Commands
 	if len(statements) == 0 {
 		return dbplugin.NewUserResponse{}, dbutil.ErrEmptyCreationStatement
 	}
 
-	username, err := s.generateUsername(req)
-	if err != nil {
+	if err := s.userProperties.validate(req.CredentialType); err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
 
-	expirationStr, err := calculateExpirationString(req.Expiration)
+	if req.CredentialType == dbplugin.CredentialTypeRSAPrivateKey {
+		if err := checkPublicKeySize(req.PublicKey, s.minRSAKeyBits); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+	}
+
+	username, err := s.generateUsername(req)
 	if err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
+	event.setUsername(username)
 
-	// Get the connection
-	db, err := s.getConnection(ctx)
+	expirationStr, err := calculateExpirationString(req.Expiration)
 	if err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
+	id, err := uuid.GenerateUUID()
 	if err != nil {
-		return dbplugin.NewUserResponse{}, err
+		return dbplugin.NewUserResponse{}, fmt.Errorf("failed to generate uuid: %w", err)
 	}
-	defer tx.Rollback()
 
 	m := map[string]string{
-		"name":       username,
-		"username":   username,
-		"expiration": expirationStr,
+		"name":         username,
+		"username":     username,
+		"quoted_name":  quoteIdentifier(username),
+		"expiration":   expirationStr,
+		"role_name":    req.UsernameConfig.RoleName,
+		"display_name": req.UsernameConfig.DisplayName,
+		"uuid":         id,
+		"expires_at":   req.Expiration.UTC().Format(time.RFC3339),
 	}
 
 	switch req.CredentialType {
@@ -168,40 +720,264 @@ func (s *SnowflakeSQL) NewUser(ctx context.Context, req dbplugin.NewUserRequest)
 			req.CredentialType.String())
 	}
 
-	// Execute each query
-	for _, stmt := range statements {
-		// it's fine to split the statements on the semicolon.
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
+	m = s.ephemeralVariables(m)
 
-			if err := dbtxn.ExecuteTxQueryDirect(ctx, tx, m, query); err != nil {
-				return dbplugin.NewUserResponse{}, err
-			}
+	if err := checkPlaceholders(statements, m); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	if s.dryRun {
+		return dbplugin.NewUserResponse{}, dryRun(m, s.creationQueries(m, statements))
+	}
+
+	// Get the connection
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	if req.CredentialType == dbplugin.CredentialTypePassword {
+		if err := s.checkPasswordPolicy(ctx, db, req.Password); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+	}
+
+	unlock, err := s.lockUserOperation(ctx, creationLockKey(req.UsernameConfig.RoleName))
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	defer unlock()
+
+	var resume bool
+	if s.resumeCreationWindow > 0 {
+		// An earlier attempt must have finished, and cleaned up after
+		// itself if it failed, before this one can tell whether to resume.
+		unlockUser, err := s.userOperationLocks.lock(ctx, resumeLockKey(username))
+		if err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+		defer unlockUser()
+
+		if resume = s.recentCreations.record(username, time.Now(), s.resumeCreationWindow); resume {
+			s.logger.Info("resuming creation of user started by an earlier request", "username", username)
+			statements = s.resumeStatements(statements, req.CredentialType)
 		}
 	}
 
-	err = tx.Commit()
+	var fingerprint string
+	if req.CredentialType == dbplugin.CredentialTypeRSAPrivateKey {
+		if fingerprint, err = publicKeyFingerprint(req.PublicKey); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+	}
+
+	tx, sessions, err := s.beginCreationTx(ctx, db, statements)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	defer tx.Rollback()
+	defer sessions.close()
+
+	if err := s.roleQuota.reserve(req.UsernameConfig.RoleName, username); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	defer func() {
+		if err != nil {
+			s.releaseQuota(username)
+		}
+	}()
+
+	if err := s.journal.begin(username); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	if creation, err := s.createUser(ctx, tx, sessions, m, statements, fingerprint, resume); err != nil {
+		// Return the transaction's connection to the pool, which the
+		// cleanup needs, before waiting on it.
+		tx.Rollback()
+		s.cleanupPartialUser(username, creation)
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	if s.verifyNewCredentials && req.CredentialType == dbplugin.CredentialTypePassword {
+		if err := s.verifyNewUser(ctx, username, req.Password); err != nil {
+			s.cleanupPartialUser(username, userCreated)
+			return dbplugin.NewUserResponse{}, err
+		}
+	}
+
+	// A user left pending in the journal would be dropped on the next
+	// initialization, so failing to record success must fail the request.
+	if err := s.journal.done(username); err != nil {
+		s.cleanupPartialUser(username, userCreated)
+		return dbplugin.NewUserResponse{}, err
+	}
+
 	resp := dbplugin.NewUserResponse{
 		Username: username,
 	}
-	return resp, err
+	return resp, nil
+}
+
+// createUser runs the creation statements and sets up everything else the
+// user needs. When fingerprint is set, the user's public key is checked
+// against it before the transaction is committed. When resume is set, the
+// ephemeral objects are only created if they do not exist, and user
+// properties that cannot be set twice are unset first. The userCreation
+// returned tells how far the CREATE USER got, so that a failed creation
+// only drops a user it created. The sessions set aside for the creation,
+// if any, are returned to the pool once it is done.
+func (s *SnowflakeSQL) createUser(ctx context.Context, tx Tx, sessions *parallelSessions, m map[string]string, statements []string, fingerprint string, resume bool) (created userCreation, err error) {
+	defer sessions.close()
+
+	if err := executeQueries(ctx, tx, m, s.statementHooks.pre); err != nil {
+		return userNotCreated, fmt.Errorf("failed to execute pre_statements: %w", err)
+	}
+
+	// Execute each statement block in a single round trip, apart from the
+	// CREATE USER
+	for _, batch := range batchCreationStatements(statements) {
+		for _, queries := range splitAtCreateUser(batch) {
+			createsUser := createsNewUser(queries[0])
+			if err := s.executeCreationQueries(ctx, sessions, tx, m, queries); err != nil {
+				// Snowflake may have applied the CREATE USER before the
+				// request failed, or was cancelled.
+				if createsUser && !isAlreadyExistsError(err) {
+					created = max(created, userMaybeCreated)
+				}
+				return created, err
+			}
+			if createsUser {
+				created = userCreated
+			}
+		}
+	}
+
+	ephemeralQueries := s.ephemeralCreateQueries()
+	if resume {
+		for i, query := range ephemeralQueries {
+			ephemeralQueries[i] = resumeQuery(query)
+		}
+	}
+	if err := executeQueries(ctx, tx, m, s.usernameOptions.statements(ephemeralQueries...)); err != nil {
+		return created, fmt.Errorf("failed to create ephemeral objects: %w", err)
+	}
+
+	propertyQueries := s.userProperties.queries(m)
+	if resume {
+		propertyQueries = append(s.userProperties.resumeQueries(m), propertyQueries...)
+	}
+	if err := executeQueries(ctx, tx, m, s.usernameOptions.statements(propertyQueries...)); err != nil {
+		return created, fmt.Errorf("failed to set user properties: %w", err)
+	}
+
+	if err := executeQueries(ctx, tx, m, s.statementHooks.post); err != nil {
+		return created, fmt.Errorf("failed to execute post_statements: %w", err)
+	}
+
+	if fingerprint != "" {
+		if err := verifyPublicKey(ctx, tx, s.usernameOptions.identifier(m["name"]), fingerprint); err != nil {
+			return created, err
+		}
+	}
+
+	return created, tx.Commit()
+}
+
+// checkPasswordPolicy validates the password against the password policy it
+// will be subject to when password_policy_check is enabled. Violations are logged when
+// set to "warn" and returned as an error when set to "deny".
+func (s *SnowflakeSQL) checkPasswordPolicy(ctx context.Context, db Database, password string) error {
+	if s.passwordPolicyCheck == "" {
+		return nil
+	}
+
+	policy, err := fetchPasswordPolicy(ctx, db, s.userProperties.passwordPolicy)
+	if err != nil {
+		s.logger.Warn("skipping password policy check", "error", err)
+		return nil
+	}
+
+	err = policy.check(password)
+	if err != nil && s.passwordPolicyCheck == passwordPolicyCheckWarn {
+		s.logger.Warn("generated password may be rejected by Snowflake", "error", err)
+		return nil
+	}
+	return err
+}
+
+// runVerifyQuery runs the operator's verify_connection_query and reads its
+// results, so a query that fails part way through is also caught.
+func (s *SnowflakeSQL) runVerifyQuery(ctx context.Context, query string) error {
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// preflightPrivileges checks the configured role's privileges, logging any
+// that are missing, and with privilege_check=deny also failing.
+func (s *SnowflakeSQL) preflightPrivileges(ctx context.Context, mode string) error {
+	db, err := s.getConnection(ctx)
+	if err == nil {
+		err = checkPrivileges(ctx, db)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var missingErr *missingPrivilegesError
+	if errors.As(err, &missingErr) {
+		s.logger.Warn("configured role is missing privileges", "role", missingErr.Role, "missing", missingErr.Missing)
+	} else {
+		s.logger.Warn("failed to check privileges", "error", err)
+	}
+
+	if mode == privilegeCheckDeny {
+		return fmt.Errorf("privilege check failed: %w", err)
+	}
+	return nil
 }
 
 func (s *SnowflakeSQL) generateUsername(req dbplugin.NewUserRequest) (string, error) {
-	username, err := s.usernameProducer.Generate(req.UsernameConfig)
+	username, err := s.usernameProducer.Generate(s.usernameOptions.metadata(req.UsernameConfig))
 	if err != nil {
 		return "", errwrap.Wrapf("error generating username: {{err}}", err)
 	}
-	return username, nil
+	return s.usernameOptions.normalize(username), nil
 }
 
-func (s *SnowflakeSQL) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+func (s *SnowflakeSQL) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (_ dbplugin.UpdateUserResponse, err error) {
 	s.RLock()
 	defer s.RUnlock()
 
+	ctx, done := s.operations.begin(ctx)
+	defer done()
+	ctx, progress := withStatementProgress(ctx)
+	defer func() { err = classifyError(progress.interrupted(ctx, err)) }()
+	ctx = s.withSlowStatementLog(ctx)
+	ctx, event := s.startAudit(ctx, updateOperation(req), "", req.Username)
+	defer func() { event.finish(err) }()
+
+	if err := s.waitForRateLimit(ctx); err != nil {
+		return dbplugin.UpdateUserResponse{}, err
+	}
+	release, err := s.acquireOperationSlot(ctx)
+	if err != nil {
+		return dbplugin.UpdateUserResponse{}, err
+	}
+	defer release()
+
 	if req.Username == "" {
 		err := fmt.Errorf("a username must be provided to update a user")
 		return dbplugin.UpdateUserResponse{}, err
@@ -239,14 +1015,16 @@ func (s *SnowflakeSQL) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRe
 	return dbplugin.UpdateUserResponse{}, nil
 }
 
-func (s *SnowflakeSQL) updateUserCredential(ctx context.Context, tx *sql.Tx, req dbplugin.UpdateUserRequest) error {
+func (s *SnowflakeSQL) updateUserCredential(ctx context.Context, tx Tx, req dbplugin.UpdateUserRequest) error {
 	m := map[string]string{
-		"name":     req.Username,
-		"username": req.Username,
+		"name":        req.Username,
+		"username":    req.Username,
+		"quoted_name": quoteIdentifier(req.Username),
 	}
 
 	var stmts []string
-	switch req.CredentialType {
+	var fingerprint string
+	switch updateCredentialType(req) {
 	case dbplugin.CredentialTypePassword:
 		if req.Password == nil || req.Password.NewPassword == "" {
 			return fmt.Errorf("new password credential must not be empty")
@@ -254,7 +1032,7 @@ func (s *SnowflakeSQL) updateUserCredential(ctx context.Context, tx *sql.Tx, req
 
 		stmts = req.Password.Statements.Commands
 		if len(stmts) == 0 {
-			stmts = []string{defaultSnowflakeRotatePasswordSQL}
+			stmts = s.usernameOptions.statements(defaultSnowflakeRotatePasswordSQL)
 		}
 
 		m["password"] = req.Password.NewPassword
@@ -263,10 +1041,20 @@ func (s *SnowflakeSQL) updateUserCredential(ctx context.Context, tx *sql.Tx, req
 		if req.PublicKey == nil || len(req.PublicKey.NewPublicKey) == 0 {
 			return fmt.Errorf("new public key credential must not be empty")
 		}
+		if err := checkPublicKeySize(req.PublicKey.NewPublicKey, s.minRSAKeyBits); err != nil {
+			return err
+		}
+		var err error
+		if fingerprint, err = publicKeyFingerprint(req.PublicKey.NewPublicKey); err != nil {
+			return err
+		}
 
 		stmts = req.PublicKey.Statements.Commands
 		if len(stmts) == 0 {
-			stmts = []string{defaultSnowflakeRotateRSAPublicKeySQL}
+			if s.keyRotation.dualKey {
+				return s.rotatePublicKeyDual(ctx, tx, req.Username, req.PublicKey.NewPublicKey)
+			}
+			stmts = s.usernameOptions.statements(defaultSnowflakeRotateRSAPublicKeySQL)
 		}
 
 		m["public_key"] = preparePublicKey(string(req.PublicKey.NewPublicKey))
@@ -276,22 +1064,30 @@ func (s *SnowflakeSQL) updateUserCredential(ctx context.Context, tx *sql.Tx, req
 	}
 
 	for _, stmt := range stmts {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
-
-			if err := dbtxn.ExecuteTxQueryDirect(ctx, tx, m, query); err != nil {
+		for _, query := range splitStatements(stmt) {
+			if err := execQuery(ctx, tx, m, query); err != nil {
 				return fmt.Errorf("failed to execute query: %w", err)
 			}
 		}
 	}
 
+	if fingerprint != "" {
+		return verifyPublicKey(ctx, tx, s.usernameOptions.identifier(req.Username), fingerprint)
+	}
 	return nil
 }
 
-func (s *SnowflakeSQL) updateUserExpiration(ctx context.Context, tx *sql.Tx, username string, req *dbplugin.ChangeExpiration) error {
+// updateCredentialType returns the type of credential being changed. A
+// request that only changes the public key is a public key change, even if
+// its credential type was left as the zero value, which is password.
+func updateCredentialType(req dbplugin.UpdateUserRequest) dbplugin.CredentialType {
+	if req.CredentialType == dbplugin.CredentialTypePassword && req.Password == nil && req.PublicKey != nil {
+		return dbplugin.CredentialTypeRSAPrivateKey
+	}
+	return req.CredentialType
+}
+
+func (s *SnowflakeSQL) updateUserExpiration(ctx context.Context, tx Tx, username string, req *dbplugin.ChangeExpiration) error {
 	expiration := req.NewExpiration
 
 	if username == "" || expiration.IsZero() {
@@ -305,23 +1101,19 @@ func (s *SnowflakeSQL) updateUserExpiration(ctx context.Context, tx *sql.Tx, use
 
 	stmts := req.Statements.Commands
 	if len(stmts) == 0 {
-		stmts = []string{defaultSnowflakeRenewSQL}
+		stmts = s.usernameOptions.statements(defaultSnowflakeRenewSQL)
 	}
 
 	for _, stmt := range stmts {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
-
+		for _, query := range splitStatements(stmt) {
 			m := map[string]string{
-				"name":       username,
-				"username":   username,
-				"expiration": expirationStr,
+				"name":        username,
+				"username":    username,
+				"quoted_name": quoteIdentifier(username),
+				"expiration":  expirationStr,
 			}
 
-			if err := dbtxn.ExecuteTxQueryDirect(ctx, tx, m, query); err != nil {
+			if err := execQuery(ctx, tx, m, query); err != nil {
 				return fmt.Errorf("failed to execute query: %w", err)
 			}
 		}
@@ -330,16 +1122,73 @@ func (s *SnowflakeSQL) updateUserExpiration(ctx context.Context, tx *sql.Tx, use
 	return nil
 }
 
-func (s *SnowflakeSQL) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (dbplugin.DeleteUserResponse, error) {
+func (s *SnowflakeSQL) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (_ dbplugin.DeleteUserResponse, err error) {
 	s.RLock()
 	defer s.RUnlock()
 
+	ctx, done := s.operations.begin(ctx)
+	defer done()
+	ctx, progress := withStatementProgress(ctx)
+	defer func() { err = classifyError(progress.interrupted(ctx, err)) }()
+	ctx = s.withSlowStatementLog(ctx)
+	ctx, event := s.startAudit(ctx, "revoke", "", req.Username)
+	defer func() { event.finish(err) }()
+
+	if err := s.waitForRateLimit(ctx); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+	release, err := s.acquireOperationSlot(ctx)
+	if err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+	defer release()
+
 	username := req.Username
 	statements := req.Statements.Commands
 	if len(statements) == 0 {
-		statements = []string{defaultSnowflakeDeleteSQL}
+		statements = s.usernameOptions.statements(defaultSnowflakeDeleteSQL)
 	}
 
+	m := s.ephemeralVariables(map[string]string{
+		"name":        username,
+		"username":    username,
+		"quoted_name": quoteIdentifier(username),
+	})
+
+	var queries []string
+	for _, stmt := range statements {
+		queries = append(queries, splitStatements(stmt)...)
+	}
+	queries = s.statementHooks.wrap(append(queries, s.usernameOptions.statements(s.ephemeralDropQueries()...)...))
+
+	if s.dryRun {
+		return dbplugin.DeleteUserResponse{}, dryRun(m, queries)
+	}
+	s.keyPromotions.cancel(username)
+
+	// Only the default statements are batched, because a failed batch is
+	// retried one revocation at a time and they are safe to run twice.
+	if s.revocations != nil && len(req.Statements.Commands) == 0 {
+		rendered := make([]string, 0, len(queries))
+		for _, query := range queries {
+			rendered = append(rendered, dbutil.QueryHelper(query, m))
+		}
+		if err := s.revocations.submit(ctx, rendered); err != nil {
+			s.revokeRSAPublicKey(username)
+			return dbplugin.DeleteUserResponse{}, err
+		}
+		s.releaseQuota(username)
+		return dbplugin.DeleteUserResponse{}, nil
+	}
+
+	// Batched revocations are not serialized, because holding the lock
+	// through the batch window would keep the next revocation out of it.
+	unlock, err := s.lockUserOperation(ctx, revocationLockKey(username))
+	if err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+	defer unlock()
+
 	db, err := s.getConnection(ctx)
 	if err != nil {
 		return dbplugin.DeleteUserResponse{}, err
@@ -351,25 +1200,108 @@ func (s *SnowflakeSQL) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRe
 	}
 	defer tx.Rollback()
 
-	for _, stmt := range statements {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
-
-			m := map[string]string{
-				"name":     username,
-				"username": username,
-			}
-			if err := dbtxn.ExecuteTxQueryDirect(ctx, tx, m, query); err != nil {
-				return dbplugin.DeleteUserResponse{}, err
-			}
+	// Snowflake commits each statement as it runs, so a revocation that
+	// runs out of time reports the statements left for Vault's retry.
+	progress.plan(queries)
+	for _, query := range queries {
+		if err := execQuery(ctx, tx, m, query); err != nil {
+			s.revokeRSAPublicKey(username)
+			return dbplugin.DeleteUserResponse{}, err
 		}
 	}
 
-	err = tx.Commit()
-	return dbplugin.DeleteUserResponse{}, err
+	if err := tx.Commit(); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+	s.releaseQuota(username)
+	return dbplugin.DeleteUserResponse{}, nil
+}
+
+// execRevocationBatch runs a batch of rendered revocation queries in one
+// round trip.
+func (s *SnowflakeSQL) execRevocationBatch(ctx context.Context, queries []string) error {
+	db, err := s.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := executeQueries(ctx, tx, nil, queries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeRSAPublicKey is a best effort fallback for revocations that fail.
+// It runs outside the failed transaction and request context, either of
+// which may no longer be usable.
+func (s *SnowflakeSQL) revokeRSAPublicKey(username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	db, err := s.getConnection(ctx)
+	if err == nil {
+		m := map[string]string{"name": s.usernameOptions.identifier(username)}
+		_, err = db.ExecContext(ctx, dbutil.QueryHelper(revokeRSAPublicKeySQL, m))
+	}
+	if err != nil {
+		s.logger.Error("failed to unset RSA public key after revocation failed", "username", username, "error", err)
+	}
+}
+
+// executeQueries runs the given queries within the transaction or on the
+// pool. Multiple queries are rendered and sent to Snowflake as one
+// multi-statement request so that a statement block does not pay a round
+// trip per query.
+func executeQueries(ctx context.Context, tx execer, m map[string]string, queries []string) error {
+	switch len(queries) {
+	case 0:
+		return nil
+	case 1:
+		return execQuery(ctx, tx, m, queries[0])
+	}
+
+	multiCtx, err := gosnowflake.WithMultiStatement(ctx, len(queries))
+	if err != nil {
+		return err
+	}
+
+	return runStatements(ctx, queries, func() error {
+		return execStatement(multiCtx, tx, m, strings.Join(queries, ";\n"))
+	})
+}
+
+// execQuery renders the query with the template variables in m and executes
+// it within the transaction or on the pool.
+func execQuery(ctx context.Context, tx execer, m map[string]string, query string) error {
+	return runStatements(ctx, []string{query}, func() error {
+		return execStatement(ctx, tx, m, query)
+	})
+}
+
+// execStatement renders the query and executes it, recording a span tagged
+// with the Snowflake query ID and logging it if it is slow.
+func execStatement(ctx context.Context, tx execer, m map[string]string, query string) (err error) {
+	ctx, span := startSpan(ctx, "query")
+	defer endSpan(span, &err)
+
+	start := time.Now()
+	queryID := make(chan string, 1)
+	_, err = tx.ExecContext(gosnowflake.WithQueryIDChan(ctx, queryID), dbutil.QueryHelper(query, m))
+	var id string
+	select {
+	case id = <-queryID:
+		span.SetAttributes(attribute.String("snowflake.query_id", id))
+	default:
+	}
+	observeStatement(ctx, query, id, start)
+	recordQueryID(ctx, id)
+	return err
 }
 
 // calculateExpirationString has a minimum expiration of 1 Day. This
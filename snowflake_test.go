@@ -5,45 +5,19 @@ package snowflake
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"database/sql"
-	"encoding/pem"
-	"fmt"
-	"log"
-	"os"
 	"reflect"
 	"testing"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault-plugin-database-snowflake/snowflaketest"
+	"github.com/hashicorp/vault-plugin-database-snowflake/version"
 	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
 	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
-	"github.com/snowflakedb/gosnowflake"
+	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/require"
 )
 
-const (
-	envVarSnowflakeAccount  = "SNOWFLAKE_ACCOUNT"
-	envVarSnowflakeUser     = "SNOWFLAKE_USER"
-	envVarSnowflakePassword = "SNOWFLAKE_PASSWORD"
-	envVarSnowflakeDatabase = "SNOWFLAKE_DATABASE"
-	envVarSnowflakeSchema   = "SNOWFLAKE_SCHEMA"
-
-	envVarRunAccTests = "VAULT_ACC"
-)
-
-var runAcceptanceTests = os.Getenv(envVarRunAccTests) != ""
-
-func connUrl(t *testing.T) string {
-	connURL, err := dsnString()
-	if err != nil {
-		t.Fatalf("failed to retrieve connection DSN: %s", err)
-	}
-
-	return connURL
-}
+var runAcceptanceTests = snowflaketest.AcceptanceTestsEnabled()
 
 func TestSnowflakeSQL_Initialize(t *testing.T) {
 	if !runAcceptanceTests {
@@ -53,7 +27,7 @@ func TestSnowflakeSQL_Initialize(t *testing.T) {
 	db := new()
 	defer dbtesting.AssertClose(t, db)
 
-	connURL, err := dsnString()
+	connURL, err := snowflaketest.DSN()
 	if err != nil {
 		t.Fatalf("failed to retrieve connection DSN: %s", err)
 	}
@@ -82,6 +56,81 @@ func TestSnowflakeSQL_Initialize(t *testing.T) {
 	}
 }
 
+func TestSnowflakeSQL_Initialize_VerifyConnectionQuery(t *testing.T) {
+	if !runAcceptanceTests {
+		t.SkipNow()
+	}
+
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	req := dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":          snowflaketest.ConnURL(t),
+			"verify_connection_query": "SELECT CURRENT_ROLE()",
+		},
+		VerifyConnection: true,
+	}
+	dbtesting.AssertInitialize(t, db, req)
+
+	req.Config["verify_connection_query"] = "SELECT * FROM vault_plugin_missing_table"
+	if _, err := db.Initialize(context.Background(), req); err == nil {
+		t.Fatal("expected a failing verify_connection_query to fail Initialize")
+	}
+}
+
+func TestSnowflakeSQL_Initialize_LazyConnection(t *testing.T) {
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	req := dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":  "vault:password@unreachable.invalid/db",
+			"lazy_connection": true,
+			"privilege_check": "deny",
+		},
+		VerifyConnection: true,
+	}
+	dbtesting.AssertInitialize(t, db, req)
+
+	if db.lastConnection.Load() != nil {
+		t.Fatal("Initialize should not have opened a connection")
+	}
+	if db.onFirstConnection.Load() == nil {
+		t.Fatal("connection checks should be deferred to the first operation")
+	}
+}
+
+func TestSnowflakeSQL_Initialize_VerifyConnectionAsync(t *testing.T) {
+	db := new()
+
+	req := dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":          "vault:password@unreachable.invalid/db",
+			"verify_connection_async": true,
+		},
+		VerifyConnection: true,
+	}
+	dbtesting.AssertInitialize(t, db, req)
+
+	if db.asyncVerification == nil {
+		t.Fatal("verification should be running in the background")
+	}
+	if db.onFirstConnection.Load() == nil {
+		t.Fatal("connection checks should be armed until they pass")
+	}
+
+	// Close stops verification that is still in progress.
+	dbtesting.AssertClose(t, db)
+	if db.asyncVerification != nil {
+		t.Fatal("Close should stop background verification")
+	}
+
+	req.Config["lazy_connection"] = true
+	_, err := new().Initialize(context.Background(), req)
+	require.Error(t, err)
+}
+
 func TestSnowflake_NewUser(t *testing.T) {
 	if !runAcceptanceTests {
 		t.SkipNow()
@@ -118,6 +167,15 @@ func TestSnowflake_NewUser(t *testing.T) {
 			},
 			password: "secure_password",
 		},
+		"new user with password credential using metadata template variables": {
+			credentialType: dbplugin.CredentialTypePassword,
+			creationStmts: []string{
+				`
+				CREATE USER {{name}} PASSWORD = '{{password}}' COMMENT = 'role={{role_name}} display={{display_name}} id={{uuid}}';
+				GRANT ROLE public TO USER {{name}};`,
+			},
+			password: "y8fva_sdVA3rasf",
+		},
 		"new user with 2048 bit rsa_private_key credential": {
 			credentialType: dbplugin.CredentialTypeRSAPrivateKey,
 			creationStmts: []string{
@@ -146,7 +204,7 @@ func TestSnowflake_NewUser(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			connURL := connUrl(t)
+			connURL := snowflaketest.ConnURL(t)
 
 			db := new()
 			defer dbtesting.AssertClose(t, db)
@@ -171,7 +229,7 @@ func TestSnowflake_NewUser(t *testing.T) {
 				Expiration:     time.Now().Add(time.Hour),
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), getRequestTimeout(t))
+			ctx, cancel := context.WithTimeout(context.Background(), snowflaketest.RequestTimeout(t))
 			defer cancel()
 
 			switch test.credentialType {
@@ -184,11 +242,11 @@ func TestSnowflake_NewUser(t *testing.T) {
 				} else if err != nil {
 					t.Fatalf("failed to create user %s", err)
 				}
-				defer attemptDropUser(connURL, createResp.Username)
-				assertPasswordCredentialsExist(t, connURL, createResp.Username, test.password)
+				defer snowflaketest.DropUser(connURL, createResp.Username)
+				snowflaketest.AssertPasswordCredentialsExist(t, connURL, createResp.Username, test.password)
 
 			case dbplugin.CredentialTypeRSAPrivateKey:
-				pub, priv := testGenerateRSAKeyPair(t, test.keyBits)
+				pub, priv := snowflaketest.GenerateRSAKeyPair(t, test.keyBits)
 				createReq.PublicKey = pub
 				createResp, err := db.NewUser(ctx, createReq)
 				if test.expectErr {
@@ -197,19 +255,94 @@ func TestSnowflake_NewUser(t *testing.T) {
 				} else if err != nil {
 					t.Fatalf("failed to create user %s", err)
 				}
-				defer attemptDropUser(connURL, createResp.Username)
-				assertRSAKeyPairCredentialsExist(t, connURL, createResp.Username, priv)
+				defer snowflaketest.DropUser(connURL, createResp.Username)
+				snowflaketest.AssertRSAKeyPairCredentialsExist(t, connURL, createResp.Username, priv)
 			}
 		})
 	}
 }
 
+func TestSnowflake_UpdateUser_PublicKey(t *testing.T) {
+	if !runAcceptanceTests {
+		t.SkipNow()
+	}
+
+	connURL := snowflaketest.ConnURL(t)
+
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	initReq := dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": connURL,
+		},
+		VerifyConnection: true,
+	}
+	dbtesting.AssertInitialize(t, db, initReq)
+
+	pub, priv := snowflaketest.GenerateRSAKeyPair(t, 2048)
+	createReq := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "test",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{
+				`
+				CREATE USER {{name}} RSA_PUBLIC_KEY = '{{public_key}}';
+				GRANT ROLE public TO USER {{name}};`,
+			},
+		},
+		CredentialType: dbplugin.CredentialTypeRSAPrivateKey,
+		PublicKey:      pub,
+		Expiration:     time.Now().Add(time.Hour),
+	}
+
+	createResp := dbtesting.AssertNewUser(t, db, createReq)
+	defer snowflaketest.DropUser(connURL, createResp.Username)
+	snowflaketest.AssertRSAKeyPairCredentialsExist(t, connURL, createResp.Username, priv)
+
+	newPub, newPriv := snowflaketest.GenerateRSAKeyPair(t, 2048)
+	updateReq := dbplugin.UpdateUserRequest{
+		Username:       createResp.Username,
+		CredentialType: dbplugin.CredentialTypeRSAPrivateKey,
+		PublicKey: &dbplugin.ChangePublicKey{
+			NewPublicKey: newPub,
+		},
+	}
+	dbtesting.AssertUpdateUser(t, db, updateReq)
+
+	snowflaketest.AssertRSAKeyPairCredentialsExist(t, connURL, createResp.Username, newPriv)
+	snowflaketest.AssertRSAKeyPairCredentialsDoNotExist(t, connURL, createResp.Username, priv)
+}
+
+func TestUpdateCredentialType(t *testing.T) {
+	publicKeyOnly := dbplugin.UpdateUserRequest{
+		PublicKey: &dbplugin.ChangePublicKey{NewPublicKey: []byte("key")},
+	}
+	require.Equal(t, dbplugin.CredentialTypeRSAPrivateKey, updateCredentialType(publicKeyOnly))
+
+	password := dbplugin.UpdateUserRequest{
+		Password: &dbplugin.ChangePassword{NewPassword: "password"},
+	}
+	require.Equal(t, dbplugin.CredentialTypePassword, updateCredentialType(password))
+}
+
+func TestSnowflakeSQL_PluginVersion(t *testing.T) {
+	db, err := New()
+	require.NoError(t, err)
+
+	versioner, ok := db.(logical.PluginVersioner)
+	require.True(t, ok, "wrapped plugin should report its version")
+	require.Equal(t, version.Version, versioner.PluginVersion().Version)
+}
+
 func TestSnowflake_RenewUser(t *testing.T) {
 	if !runAcceptanceTests {
 		t.SkipNow()
 	}
 
-	connURL := connUrl(t)
+	connURL := snowflaketest.ConnURL(t)
 
 	db := new()
 	defer dbtesting.AssertClose(t, db)
@@ -241,9 +374,9 @@ func TestSnowflake_RenewUser(t *testing.T) {
 	}
 
 	createResp := dbtesting.AssertNewUser(t, db, createReq)
-	defer attemptDropUser(connURL, createResp.Username)
+	defer snowflaketest.DropUser(connURL, createResp.Username)
 
-	assertPasswordCredentialsExist(t, connURL, createResp.Username, password)
+	snowflaketest.AssertPasswordCredentialsExist(t, connURL, createResp.Username, password)
 
 	renewReq := dbplugin.UpdateUserRequest{
 		Username: createResp.Username,
@@ -257,7 +390,7 @@ func TestSnowflake_RenewUser(t *testing.T) {
 	// Sleep longer than the initial expiration time
 	time.Sleep(2 * time.Second)
 
-	assertPasswordCredentialsExist(t, connURL, createResp.Username, password)
+	snowflaketest.AssertPasswordCredentialsExist(t, connURL, createResp.Username, password)
 }
 
 func TestSnowflake_RevokeUser(t *testing.T) {
@@ -265,7 +398,7 @@ func TestSnowflake_RevokeUser(t *testing.T) {
 		t.SkipNow()
 	}
 
-	connURL := connUrl(t)
+	connURL := snowflaketest.ConnURL(t)
 
 	type testCase struct {
 		deleteStatements []string
@@ -320,7 +453,7 @@ func TestSnowflake_RevokeUser(t *testing.T) {
 
 			createResp := dbtesting.AssertNewUser(t, db, createReq)
 
-			assertPasswordCredentialsExist(t, connURL, createResp.Username, password)
+			snowflaketest.AssertPasswordCredentialsExist(t, connURL, createResp.Username, password)
 
 			deleteReq := dbplugin.DeleteUserRequest{
 				Username: createResp.Username,
@@ -329,7 +462,7 @@ func TestSnowflake_RevokeUser(t *testing.T) {
 				},
 			}
 			dbtesting.AssertDeleteUser(t, db, deleteReq)
-			assertPasswordCredentialsDoNotExist(t, connURL, createResp.Username, password)
+			snowflaketest.AssertPasswordCredentialsDoNotExist(t, connURL, createResp.Username, password)
 		})
 	}
 }
@@ -339,7 +472,7 @@ func TestSnowflake_DefaultUsernameTemplate(t *testing.T) {
 		t.SkipNow()
 	}
 
-	connURL := connUrl(t)
+	connURL := snowflaketest.ConnURL(t)
 
 	db := new()
 	defer dbtesting.AssertClose(t, db)
@@ -369,13 +502,13 @@ func TestSnowflake_DefaultUsernameTemplate(t *testing.T) {
 		Expiration: time.Now().Add(time.Hour),
 	}
 	createResp := dbtesting.AssertNewUser(t, db, createReq)
-	defer attemptDropUser(connURL, createResp.Username)
+	defer snowflaketest.DropUser(connURL, createResp.Username)
 
 	if createResp.Username == "" {
 		t.Fatalf("Missing username")
 	}
 
-	assertPasswordCredentialsExist(t, connURL, createResp.Username, password)
+	snowflaketest.AssertPasswordCredentialsExist(t, connURL, createResp.Username, password)
 
 	require.Regexp(t, `^v_test_test_[a-zA-Z0-9]{20}_[0-9]{10}$`, createResp.Username)
 }
@@ -385,7 +518,7 @@ func TestSnowflake_CustomUsernameTemplate(t *testing.T) {
 		t.SkipNow()
 	}
 
-	connURL := connUrl(t)
+	connURL := snowflaketest.ConnURL(t)
 
 	db := new()
 	defer dbtesting.AssertClose(t, db)
@@ -416,182 +549,13 @@ func TestSnowflake_CustomUsernameTemplate(t *testing.T) {
 		Expiration: time.Now().Add(time.Hour),
 	}
 	createResp := dbtesting.AssertNewUser(t, db, createReq)
-	defer attemptDropUser(connURL, createResp.Username)
+	defer snowflaketest.DropUser(connURL, createResp.Username)
 
 	if createResp.Username == "" {
 		t.Fatalf("Missing username")
 	}
 
-	assertPasswordCredentialsExist(t, connURL, createResp.Username, password)
+	snowflaketest.AssertPasswordCredentialsExist(t, connURL, createResp.Username, password)
 
 	require.Regexp(t, `^test_[a-zA-Z0-9]{10}$`, createResp.Username)
 }
-
-func dsnString() (string, error) {
-	user := os.Getenv(envVarSnowflakeUser)
-	password := os.Getenv(envVarSnowflakePassword)
-	account := os.Getenv(envVarSnowflakeAccount)
-
-	var err error
-	if user == "" {
-		err = multierror.Append(err, fmt.Errorf("SNOWFLAKE_USER not set"))
-	}
-	if password == "" {
-		err = multierror.Append(err, fmt.Errorf("SNOWFLAKE_PASSWORD not set"))
-	}
-	if account == "" {
-		err = multierror.Append(err, fmt.Errorf("SNOWFLAKE_ACCOUNT not set"))
-	}
-
-	if err != nil {
-		return "", err
-	}
-
-	dsnString := fmt.Sprintf("%s:%s@%s", user, password, account)
-
-	database := os.Getenv(envVarSnowflakeDatabase)
-	schema := os.Getenv(envVarSnowflakeSchema)
-
-	if database != "" {
-		dsnString += "/" + database
-		if schema != "" {
-			dsnString += "/" + schema
-		}
-	}
-
-	return dsnString, nil
-}
-
-func verifyConnWithKeyPairCredential(connString, username string, private *rsa.PrivateKey) error {
-	conf, err := gosnowflake.ParseDSN(connString)
-	if err != nil {
-		return err
-	}
-
-	config := &gosnowflake.Config{
-		Authenticator: gosnowflake.AuthTypeJwt,
-		Account:       conf.Account,
-		Region:        conf.Region,
-		Database:      conf.Database,
-		Schema:        conf.Schema,
-		User:          username,
-		PrivateKey:    private,
-	}
-	dsn, err := gosnowflake.DSN(config)
-	if err != nil {
-		return err
-	}
-
-	db, err := sql.Open("snowflake", dsn)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	return db.Ping()
-}
-
-func verifyConnWithPasswordCredential(connString, username, password string) error {
-	conf, err := gosnowflake.ParseDSN(connString)
-	if err != nil {
-		return err
-	}
-
-	config := &gosnowflake.Config{
-		Authenticator: gosnowflake.AuthTypeSnowflake,
-		Account:       conf.Account,
-		Region:        conf.Region,
-		Database:      conf.Database,
-		Schema:        conf.Schema,
-		User:          username,
-		Password:      password,
-	}
-
-	dsn, err := gosnowflake.DSN(config)
-	if err != nil {
-		return err
-	}
-
-	db, err := sql.Open("snowflake", dsn)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	return db.Ping()
-}
-
-func assertPasswordCredentialsExist(t *testing.T, connString, username, password string) {
-	t.Helper()
-	err := verifyConnWithPasswordCredential(connString, username, password)
-	if err != nil {
-		t.Fatalf("failed to log in with password credential: %s", err)
-	}
-}
-
-// assertPasswordCredentialsDoNotExist is a helper to assert db creds were
-// properly removed. A successful assertion will result in the gosnowflake
-// default logger to output `msg="Authentication FAILED"` in the test logs.
-func assertPasswordCredentialsDoNotExist(t *testing.T, connString, username, password string) {
-	t.Helper()
-	err := verifyConnWithPasswordCredential(connString, username, password)
-	if err == nil {
-		t.Fatalf("logged in when it shouldn't have been able to")
-	}
-}
-
-func assertRSAKeyPairCredentialsExist(t *testing.T, connString, username string, private *rsa.PrivateKey) {
-	t.Helper()
-	err := verifyConnWithKeyPairCredential(connString, username, private)
-	if err != nil {
-		t.Fatalf("failed to log in with RSA key pair credential: %s", err)
-	}
-}
-
-func assertRSAKeyPairCredentialsDoNotExist(t *testing.T, connString, username string, private *rsa.PrivateKey) {
-	t.Helper()
-	err := verifyConnWithKeyPairCredential(connString, username, private)
-	if err == nil {
-		t.Fatalf("logged in when it shouldn't have been able to")
-	}
-}
-
-// Needed to not clutter the shared instance with testing artifacts
-func attemptDropUser(connString, username string) {
-	db, err := sql.Open("snowflake", connString)
-	if err != nil {
-		log.Printf("connection issue: %s", err)
-	}
-
-	defer db.Close()
-	_, err = db.Exec(fmt.Sprintf("DROP USER %s", username))
-
-	if err != nil {
-		log.Printf("query issue: %s", err)
-	}
-}
-
-func getRequestTimeout(t *testing.T) time.Duration {
-	rawDur := os.Getenv("VAULT_TEST_DATABASE_REQUEST_TIMEOUT")
-	if rawDur == "" {
-		return 1 * time.Minute
-	}
-
-	dur, err := time.ParseDuration(rawDur)
-	if err != nil {
-		t.Fatalf("Failed to parse custom request timeout %q: %s", rawDur, err)
-	}
-	return dur
-}
-
-func testGenerateRSAKeyPair(t *testing.T, bits int) ([]byte, *rsa.PrivateKey) {
-	t.Helper()
-
-	key, err := rsa.GenerateKey(rand.Reader, bits)
-	require.NoError(t, err)
-	public, err := x509.MarshalPKIXPublicKey(key.Public())
-	require.NoError(t, err)
-	publicBlock := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: public,
-	}
-	return pem.EncodeToMemory(publicBlock), key
-}
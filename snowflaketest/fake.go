@@ -0,0 +1,823 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflaketest
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// Snowflake error codes returned by the fake.
+const (
+	ErrNumObjectAlreadyExists = 2002
+	ErrNumObjectDoesNotExist  = 2003
+)
+
+// fakeDriverCount numbers the drivers registered for fakes, since
+// database/sql drivers cannot be unregistered.
+var fakeDriverCount atomic.Int64
+
+// Fake is an in-process stand-in for the parts of Snowflake the plugin
+// uses: creating, altering, describing, listing, and dropping users, roles
+// granted to them, schemas, warehouses, and network rules and policies. Connections to it are opened through the
+// database/sql driver named by DriverName, with any DSN.
+//
+// Statements are split on semicolons, so multi-statement requests work as
+// they do against Snowflake. There are no transactions, which matches how
+// Snowflake commits DDL immediately. USE and INSERT statements are accepted
+// and only recorded, since the fake has no sessions or tables.
+type Fake struct {
+	driverName string
+
+	mu         sync.Mutex
+	users      map[string]*FakeUser
+	roles      map[string]bool
+	schemas    map[string]bool
+	warehouses map[string]map[string]string
+	rules      map[string]map[string]string
+	policies   map[string]map[string]string
+	grants     []string
+	statements []string
+	dsns       []string
+	failures   []fakeFailure
+	logins     []fakeFailure
+}
+
+// FakeUser is a user in a Fake.
+type FakeUser struct {
+	Name string
+
+	// Properties holds the user's properties by upper case name, such as
+	// PASSWORD, RSA_PUBLIC_KEY, or DAYS_TO_EXPIRY.
+	Properties map[string]string
+
+	// Tags holds the user's tag values by tag name.
+	Tags map[string]string
+
+	// Roles are the roles granted to the user.
+	Roles []string
+
+	// PasswordPolicy is the qualified name of the password policy attached
+	// to the user, upper-cased like other names.
+	PasswordPolicy string
+
+	ExpiresAt time.Time
+}
+
+type fakeFailure struct {
+	match string
+	err   func() error
+}
+
+// NewFake returns a fake holding only the PUBLIC role, and registers a
+// driver for it.
+func NewFake() *Fake {
+	f := &Fake{
+		driverName: fmt.Sprintf("snowflaketest-fake-%d", fakeDriverCount.Add(1)),
+		users:      map[string]*FakeUser{},
+		roles:      map[string]bool{"PUBLIC": true},
+		schemas:    map[string]bool{},
+		warehouses: map[string]map[string]string{},
+		rules:      map[string]map[string]string{},
+		policies:   map[string]map[string]string{},
+	}
+	sql.Register(f.driverName, fakeDriver{fake: f})
+	return f
+}
+
+// DriverName returns the name of the database/sql driver connecting to f.
+func (f *Fake) DriverName() string {
+	return f.driverName
+}
+
+// Open returns a database handle connected to f.
+func (f *Fake) Open() (*sql.DB, error) {
+	return sql.Open(f.driverName, "fake")
+}
+
+// User returns a copy of the named user. Names follow Snowflake's rules:
+// unquoted names are upper-cased, and double-quoted names are used as
+// they are.
+func (f *Fake) User(name string) (FakeUser, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		name = strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	} else {
+		name = normalizeIdentifier(name)
+	}
+	u, ok := f.users[name]
+	if !ok {
+		return FakeUser{}, false
+	}
+	c := *u
+	c.Properties = copyMap(u.Properties)
+	c.Tags = copyMap(u.Tags)
+	c.Roles = append([]string(nil), u.Roles...)
+	return c, true
+}
+
+// Users returns the names of all users, sorted.
+func (f *Fake) Users() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.users)
+}
+
+// Roles returns the names of all roles, sorted.
+func (f *Fake) Roles() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.roles)
+}
+
+// Schemas returns the names of all schemas, sorted.
+func (f *Fake) Schemas() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.schemas)
+}
+
+// Warehouse returns the properties of the named warehouse, by upper case
+// name, as it was created.
+func (f *Fake) Warehouse(name string) (map[string]string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	props, ok := f.warehouses[normalizeIdentifier(name)]
+	return copyMap(props), ok
+}
+
+// Warehouses returns the names of all warehouses, sorted.
+func (f *Fake) Warehouses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.warehouses)
+}
+
+// NetworkRule returns the properties of the named network rule, by upper
+// case name, as it was created.
+func (f *Fake) NetworkRule(name string) (map[string]string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	props, ok := f.rules[normalizeQualifiedIdentifier(name)]
+	return copyMap(props), ok
+}
+
+// NetworkRules returns the qualified names of all network rules, sorted.
+func (f *Fake) NetworkRules() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.rules)
+}
+
+// NetworkPolicy returns the properties of the named network policy, by
+// upper case name, as it was created.
+func (f *Fake) NetworkPolicy(name string) (map[string]string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	props, ok := f.policies[normalizeIdentifier(name)]
+	return copyMap(props), ok
+}
+
+// NetworkPolicies returns the names of all network policies, sorted.
+func (f *Fake) NetworkPolicies() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.policies)
+}
+
+// Grants returns the privilege grants made to roles, as executed.
+func (f *Fake) Grants() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.grants...)
+}
+
+// Statements returns every statement executed, in order.
+func (f *Fake) Statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.statements...)
+}
+
+// DSNs returns the DSN of every connection opened to f, in order.
+func (f *Fake) DSNs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.dsns...)
+}
+
+// FailOn makes statements containing match, compared case-insensitively,
+// fail with err until ClearFailures is called.
+func (f *Fake) FailOn(match string, err error) {
+	f.FailOnFunc(match, func() error { return err })
+}
+
+// FailOnFunc is like FailOn, but calls fn for the error when a statement
+// matches, so a test can act at that point, such as by cancelling a
+// context. A nil error lets the statement run. fn must not call methods
+// of the Fake.
+func (f *Fake) FailOnFunc(match string, fn func() error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, fakeFailure{match: strings.ToLower(match), err: fn})
+}
+
+// FailLogin makes connections whose DSN contains match, compared
+// case-insensitively, fail to open with err.
+func (f *Fake) FailLogin(match string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logins = append(f.logins, fakeFailure{match: strings.ToLower(match), err: func() error { return err }})
+}
+
+// ClearFailures removes the failures added with FailOn and FailLogin.
+func (f *Fake) ClearFailures() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = nil
+	f.logins = nil
+}
+
+// exec runs the statements in query, stopping at the first that fails.
+// The result of the last statement is returned.
+func (f *Fake) exec(query string) (*fakeRows, error) {
+	var rows *fakeRows
+	for _, stmt := range splitFakeStatements(query) {
+		// Failure funcs run without the lock held, so that they may block
+		// to observe concurrent statements.
+		for _, fail := range f.record(stmt) {
+			if err := fail(); err != nil {
+				return nil, err
+			}
+		}
+
+		f.mu.Lock()
+		var err error
+		rows, err = f.execStatement(stmt)
+		f.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return rows, nil
+}
+
+// record adds stmt to the statements run and returns the failures that
+// match it.
+func (f *Fake) record(stmt string) []func() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.statements = append(f.statements, stmt)
+	var fails []func() error
+	for _, failure := range f.failures {
+		if strings.Contains(strings.ToLower(stmt), failure.match) {
+			fails = append(fails, failure.err)
+		}
+	}
+	return fails
+}
+
+func (f *Fake) execStatement(stmt string) (*fakeRows, error) {
+	p, err := newFakeParser(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.keywords("create", "user"):
+		return nil, f.createUser(p)
+	case p.keywords("alter", "user"):
+		return nil, f.alterUser(p)
+	case p.keywords("drop", "user"):
+		return nil, f.drop(p, "User", f.dropUser)
+	case p.keywords("describe", "user"), p.keywords("desc", "user"):
+		return f.describeUser(p)
+	case p.keywords("show", "users"):
+		return f.showUsers(p)
+	case p.keywords("create", "role"):
+		return nil, f.create(p, "Role", f.roles)
+	case p.keywords("drop", "role"):
+		return nil, f.drop(p, "Role", func(name string) bool {
+			ok := f.roles[name]
+			delete(f.roles, name)
+			return ok
+		})
+	case p.keywords("create", "schema"):
+		return nil, f.create(p, "Schema", f.schemas)
+	case p.keywords("drop", "schema"):
+		return nil, f.drop(p, "Schema", func(name string) bool {
+			ok := f.schemas[name]
+			delete(f.schemas, name)
+			return ok
+		})
+	case p.keywords("create", "warehouse"):
+		return nil, f.createWithProperties(p, "Warehouse", f.warehouses)
+	case p.keywords("drop", "warehouse"):
+		return nil, f.drop(p, "Warehouse", func(name string) bool {
+			_, ok := f.warehouses[name]
+			delete(f.warehouses, name)
+			return ok
+		})
+	case p.keywords("create", "network", "rule"):
+		return nil, f.createWithProperties(p, "Network rule", f.rules)
+	case p.keywords("drop", "network", "rule"):
+		return nil, f.drop(p, "Network rule", func(name string) bool {
+			_, ok := f.rules[name]
+			delete(f.rules, name)
+			return ok
+		})
+	case p.keywords("create", "network", "policy"):
+		return nil, f.createWithProperties(p, "Network policy", f.policies)
+	case p.keywords("drop", "network", "policy"):
+		return nil, f.dropNetworkPolicy(p)
+	case p.keywords("grant", "role"):
+		return nil, f.grantRole(p)
+	case p.keywords("grant"):
+		f.grants = append(f.grants, stmt)
+		return nil, nil
+	case p.keywords("use"), p.keywords("insert"):
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("snowflaketest: unsupported statement %q", stmt)
+	}
+}
+
+func (f *Fake) createUser(p *fakeParser) error {
+	ifNotExists := p.keywords("if", "not", "exists")
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	if _, ok := f.users[name]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return alreadyExists("User", name)
+	}
+
+	props, err := p.properties()
+	if err != nil {
+		return err
+	}
+	u := &FakeUser{Name: name, Properties: map[string]string{}, Tags: map[string]string{}}
+	setProperties(u, props)
+	f.users[name] = u
+	return nil
+}
+
+func (f *Fake) alterUser(p *fakeParser) error {
+	ifExists := p.keywords("if", "exists")
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	u, ok := f.users[name]
+	if !ok {
+		if ifExists {
+			return nil
+		}
+		return doesNotExist("User", name)
+	}
+
+	switch {
+	case p.keywords("set", "password", "policy"):
+		policy, err := p.qualifiedIdentifier()
+		if err != nil {
+			return err
+		}
+		if u.PasswordPolicy != "" {
+			return p.errorf("password policy already attached to user %s", name)
+		}
+		u.PasswordPolicy = policy
+	case p.keywords("unset", "password", "policy"):
+		u.PasswordPolicy = ""
+	case p.keywords("set", "tag"):
+		tags, err := p.assignments(true)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			u.Tags[tag.name] = tag.value
+		}
+	case p.keywords("unset", "tag"):
+		names, err := p.identifierList(true)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			delete(u.Tags, name)
+		}
+	case p.keywords("set"):
+		props, err := p.properties()
+		if err != nil {
+			return err
+		}
+		setProperties(u, props)
+	case p.keywords("unset"):
+		names, err := p.identifierList(false)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			delete(u.Properties, strings.ToUpper(name))
+		}
+	default:
+		return p.errorf("expected SET or UNSET")
+	}
+	return p.end()
+}
+
+func (f *Fake) dropUser(name string) bool {
+	_, ok := f.users[name]
+	delete(f.users, name)
+	return ok
+}
+
+func (f *Fake) describeUser(p *fakeParser) (*fakeRows, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	u, ok := f.users[name]
+	if !ok {
+		return nil, doesNotExist("User", name)
+	}
+
+	props := copyMap(u.Properties)
+	props["NAME"] = u.Name
+	props["RSA_PUBLIC_KEY_FP"] = fingerprint(props["RSA_PUBLIC_KEY"])
+	props["RSA_PUBLIC_KEY_2_FP"] = fingerprint(props["RSA_PUBLIC_KEY_2"])
+	for _, key := range []string{"RSA_PUBLIC_KEY", "RSA_PUBLIC_KEY_2", "PASSWORD"} {
+		if _, ok := props[key]; !ok {
+			props[key] = ""
+		}
+	}
+	if props["PASSWORD"] != "" {
+		props["PASSWORD"] = "********"
+	}
+
+	rows := &fakeRows{columns: []string{"property", "value", "default", "description"}}
+	for _, key := range sortedKeys(props) {
+		value := props[key]
+		if value == "" {
+			value = "null"
+		}
+		rows.values = append(rows.values, []driver.Value{key, value, "null", ""})
+	}
+	return rows, nil
+}
+
+func (f *Fake) showUsers(p *fakeParser) (*fakeRows, error) {
+	pattern := "%"
+	if p.keywords("like") {
+		var err error
+		if pattern, err = p.stringLiteral(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := &fakeRows{columns: []string{"name", "created_on", "comment", "expires_at_time", "disabled", "must_change_password"}}
+	for _, name := range sortedKeys(f.users) {
+		if !likeMatch(pattern, name) {
+			continue
+		}
+		u := f.users[name]
+		var expiresAt interface{}
+		if !u.ExpiresAt.IsZero() {
+			expiresAt = u.ExpiresAt
+		}
+		rows.values = append(rows.values, []driver.Value{
+			u.Name, time.Time{}, u.Properties["COMMENT"], expiresAt,
+			showBool(u.Properties["DISABLED"]), showBool(u.Properties["MUST_CHANGE_PASSWORD"]),
+		})
+	}
+	return rows, p.end()
+}
+
+// showBool returns a boolean property as SHOW commands report it.
+func showBool(value string) string {
+	if strings.EqualFold(value, "true") {
+		return "true"
+	}
+	return "false"
+}
+
+func (f *Fake) create(p *fakeParser, kind string, objects map[string]bool) error {
+	ifNotExists := p.keywords("if", "not", "exists")
+	name, err := p.qualifiedIdentifier()
+	if err != nil {
+		return err
+	}
+	if objects[name] {
+		if ifNotExists {
+			return nil
+		}
+		return alreadyExists(kind, name)
+	}
+	objects[name] = true
+	return nil
+}
+
+// createWithProperties creates an object that is created with properties,
+// such as a warehouse.
+func (f *Fake) createWithProperties(p *fakeParser, kind string, objects map[string]map[string]string) error {
+	ifNotExists := p.keywords("if", "not", "exists")
+	name, err := p.qualifiedIdentifier()
+	if err != nil {
+		return err
+	}
+	props, err := p.properties()
+	if err != nil {
+		return err
+	}
+	if _, ok := objects[name]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return alreadyExists(kind, name)
+	}
+	objects[name] = map[string]string{}
+	for _, prop := range props {
+		objects[name][prop.name] = prop.value
+	}
+	return nil
+}
+
+// dropNetworkPolicy drops a network policy, which Snowflake refuses to do
+// while it is attached to a user.
+func (f *Fake) dropNetworkPolicy(p *fakeParser) error {
+	ifExists := p.keywords("if", "exists")
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	if _, ok := f.policies[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return doesNotExist("Network policy", name)
+	}
+	for _, u := range f.users {
+		if normalizeIdentifier(u.Properties["NETWORK_POLICY"]) == name {
+			return p.errorf("network policy %s is attached to user %s", name, u.Name)
+		}
+	}
+	delete(f.policies, name)
+	return nil
+}
+
+func (f *Fake) drop(p *fakeParser, kind string, drop func(string) bool) error {
+	ifExists := p.keywords("if", "exists")
+	name, err := p.qualifiedIdentifier()
+	if err != nil {
+		return err
+	}
+	if !drop(name) && !ifExists {
+		return doesNotExist(kind, name)
+	}
+	return nil
+}
+
+func (f *Fake) grantRole(p *fakeParser) error {
+	role, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	if !p.keywords("to", "user") {
+		// Grants of roles to roles are recorded but not modeled.
+		f.grants = append(f.grants, p.stmt)
+		return nil
+	}
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	if !f.roles[role] {
+		return doesNotExist("Role", role)
+	}
+	u, ok := f.users[name]
+	if !ok {
+		return doesNotExist("User", name)
+	}
+	u.Roles = append(u.Roles, role)
+	return p.end()
+}
+
+func setProperties(u *FakeUser, props []fakeAssignment) {
+	for _, prop := range props {
+		key := strings.ToUpper(prop.name)
+		u.Properties[key] = prop.value
+		if key == "DAYS_TO_EXPIRY" {
+			if days, err := strconv.ParseFloat(prop.value, 64); err == nil {
+				u.ExpiresAt = time.Now().Add(time.Duration(days * float64(24*time.Hour)))
+			}
+		}
+	}
+}
+
+// fingerprint returns the fingerprint Snowflake reports for a public key
+// set without its PEM delimiters.
+func fingerprint(publicKey string) string {
+	if publicKey == "" {
+		return ""
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(publicKey), ""))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// likeMatch reports whether s matches the SQL LIKE pattern, compared
+// case-insensitively as SHOW ... LIKE does.
+func likeMatch(pattern, s string) bool {
+	pattern, s = strings.ToUpper(pattern), strings.ToUpper(s)
+	if pattern == "" {
+		return s == ""
+	}
+
+	switch c := pattern[0]; c {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if likeMatch(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return s != "" && likeMatch(pattern[1:], s[1:])
+	case '\\':
+		if len(pattern) > 1 {
+			return s != "" && s[0] == pattern[1] && likeMatch(pattern[2:], s[1:])
+		}
+		fallthrough
+	default:
+		return s != "" && s[0] == c && likeMatch(pattern[1:], s[1:])
+	}
+}
+
+func alreadyExists(kind, name string) error {
+	return &gosnowflake.SnowflakeError{
+		Number:  ErrNumObjectAlreadyExists,
+		Message: fmt.Sprintf("%s '%s' already exists.", kind, name),
+	}
+}
+
+func doesNotExist(kind, name string) error {
+	return &gosnowflake.SnowflakeError{
+		Number:  ErrNumObjectDoesNotExist,
+		Message: fmt.Sprintf("%s '%s' does not exist or not authorized.", kind, name),
+	}
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type fakeDriver struct {
+	fake *Fake
+}
+
+func (d fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+	d.fake.dsns = append(d.fake.dsns, dsn)
+	for _, login := range d.fake.logins {
+		if strings.Contains(strings.ToLower(dsn), login.match) {
+			return nil, login.err()
+		}
+	}
+	return &fakeConn{fake: d.fake}, nil
+}
+
+type fakeConn struct {
+	fake *Fake
+}
+
+var (
+	_ driver.ExecerContext  = (*fakeConn)(nil)
+	_ driver.QueryerContext = (*fakeConn)(nil)
+	_ driver.ConnBeginTx    = (*fakeConn)(nil)
+	_ driver.Pinger         = (*fakeConn)(nil)
+)
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error { return ctx.Err() }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := checkArgs(ctx, args); err != nil {
+		return nil, err
+	}
+	if _, err := c.fake.exec(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := checkArgs(ctx, args); err != nil {
+		return nil, err
+	}
+	return c.fake.exec(query)
+}
+
+func checkArgs(ctx context.Context, args []driver.NamedValue) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("snowflaketest: query arguments are not supported")
+	}
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,379 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflaketest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type fakeTokenKind int
+
+const (
+	tokenWord fakeTokenKind = iota
+	tokenQuotedIdentifier
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type fakeToken struct {
+	kind fakeTokenKind
+	text string
+}
+
+type fakeAssignment struct {
+	name  string
+	value string
+}
+
+var unquotedIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// normalizeIdentifier returns name as Snowflake stores it: upper-cased if
+// it is a valid unquoted identifier, and unchanged otherwise.
+func normalizeIdentifier(name string) string {
+	if unquotedIdentifier.MatchString(name) {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// normalizeQualifiedIdentifier normalizes each dot-separated part of name.
+func normalizeQualifiedIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = normalizeIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// splitFakeStatements splits query on the semicolons outside of quotes.
+func splitFakeStatements(query string) []string {
+	var stmts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '\'' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';':
+			stmts = append(stmts, query[start:i])
+			start = i + 1
+		}
+	}
+	stmts = append(stmts, query[start:])
+
+	var trimmed []string
+	for _, stmt := range stmts {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			trimmed = append(trimmed, stmt)
+		}
+	}
+	return trimmed
+}
+
+// fakeParser reads a statement token by token.
+type fakeParser struct {
+	stmt   string
+	tokens []fakeToken
+	pos    int
+}
+
+func newFakeParser(stmt string) (*fakeParser, error) {
+	tokens, err := tokenize(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeParser{stmt: stmt, tokens: tokens}, nil
+}
+
+func (p *fakeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("snowflaketest: %s in %q", fmt.Sprintf(format, args...), p.stmt)
+}
+
+func (p *fakeParser) peek() (fakeToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return fakeToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keywords consumes the given sequence of keywords if the statement
+// continues with it.
+func (p *fakeParser) keywords(words ...string) bool {
+	if p.pos+len(words) > len(p.tokens) {
+		return false
+	}
+	for i, word := range words {
+		tok := p.tokens[p.pos+i]
+		if tok.kind != tokenWord || !strings.EqualFold(tok.text, word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *fakeParser) punct(c string) bool {
+	if tok, ok := p.peek(); ok && tok.kind == tokenPunct && tok.text == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *fakeParser) end() error {
+	if tok, ok := p.peek(); ok {
+		return p.errorf("unexpected %q", tok.text)
+	}
+	return nil
+}
+
+func (p *fakeParser) identifier() (string, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return "", p.errorf("expected identifier")
+	}
+	switch tok.kind {
+	case tokenWord:
+		p.pos++
+		return strings.ToUpper(tok.text), nil
+	case tokenQuotedIdentifier:
+		p.pos++
+		return tok.text, nil
+	default:
+		return "", p.errorf("expected identifier, got %q", tok.text)
+	}
+}
+
+// qualifiedIdentifier reads a dot-separated name such as db.schema.
+func (p *fakeParser) qualifiedIdentifier() (string, error) {
+	var parts []string
+	for {
+		part, err := p.identifier()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+		if !p.punct(".") {
+			return strings.Join(parts, "."), nil
+		}
+	}
+}
+
+func (p *fakeParser) identifierList(qualified bool) ([]string, error) {
+	var names []string
+	for {
+		read := p.identifier
+		if qualified {
+			read = p.qualifiedIdentifier
+		}
+		name, err := read()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.punct(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *fakeParser) stringLiteral() (string, error) {
+	tok, ok := p.peek()
+	if !ok || tok.kind != tokenString {
+		return "", p.errorf("expected string literal")
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+// value reads a property value: a literal, a word, or a parenthesized
+// list of them, which is returned comma-separated.
+func (p *fakeParser) value() (string, error) {
+	if p.punct("(") {
+		var values []string
+		for !p.punct(")") {
+			if len(values) > 0 && !p.punct(",") {
+				return "", p.errorf("expected , or )")
+			}
+			value, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, ", "), nil
+	}
+
+	tok, ok := p.peek()
+	if !ok || tok.kind == tokenPunct {
+		return "", p.errorf("expected value")
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+// properties reads space-separated NAME = value pairs up to the end of
+// the statement.
+func (p *fakeParser) properties() ([]fakeAssignment, error) {
+	var props []fakeAssignment
+	for {
+		if _, ok := p.peek(); !ok {
+			return props, nil
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct("=") {
+			return nil, p.errorf("expected = after %s", name)
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, fakeAssignment{name: name, value: value})
+	}
+}
+
+// assignments reads comma-separated NAME = value pairs, as in SET TAG.
+func (p *fakeParser) assignments(qualified bool) ([]fakeAssignment, error) {
+	var assignments []fakeAssignment
+	for {
+		read := p.identifier
+		if qualified {
+			read = p.qualifiedIdentifier
+		}
+		name, err := read()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct("=") {
+			return nil, p.errorf("expected = after %s", name)
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, fakeAssignment{name: name, value: value})
+		if !p.punct(",") {
+			return assignments, p.end()
+		}
+	}
+}
+
+func tokenize(stmt string) ([]fakeToken, error) {
+	var tokens []fakeToken
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case strings.HasPrefix(stmt[i:], "--") || strings.HasPrefix(stmt[i:], "//"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				end = len(stmt) - i
+			}
+			i += end
+
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("snowflaketest: unterminated comment in %q", stmt)
+			}
+			i += end + 4
+
+		case c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(stmt); j++ {
+				if stmt[j] == '\\' && j+1 < len(stmt) {
+					j++
+					b.WriteByte(stmt[j])
+					continue
+				}
+				if stmt[j] == '\'' {
+					if j+1 < len(stmt) && stmt[j+1] == '\'' {
+						b.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(stmt[j])
+			}
+			if j >= len(stmt) {
+				return nil, fmt.Errorf("snowflaketest: unterminated string in %q", stmt)
+			}
+			tokens = append(tokens, fakeToken{kind: tokenString, text: b.String()})
+			i = j + 1
+
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(stmt); j++ {
+				if stmt[j] == '"' {
+					if j+1 < len(stmt) && stmt[j+1] == '"' {
+						b.WriteByte('"')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(stmt[j])
+			}
+			if j >= len(stmt) {
+				return nil, fmt.Errorf("snowflaketest: unterminated identifier in %q", stmt)
+			}
+			tokens = append(tokens, fakeToken{kind: tokenQuotedIdentifier, text: b.String()})
+			i = j + 1
+
+		case c == '$' && strings.HasPrefix(stmt[i:], "$$"):
+			end := strings.Index(stmt[i+2:], "$$")
+			if end < 0 {
+				return nil, fmt.Errorf("snowflaketest: unterminated string in %q", stmt)
+			}
+			tokens = append(tokens, fakeToken{kind: tokenString, text: stmt[i+2 : i+2+end]})
+			i += end + 4
+
+		case strings.ContainsRune("=,().", rune(c)):
+			tokens = append(tokens, fakeToken{kind: tokenPunct, text: string(c)})
+			i++
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(stmt) && (stmt[j] == '.' || (stmt[j] >= '0' && stmt[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: tokenNumber, text: stmt[i:j]})
+			i = j
+
+		case c == '_' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			j := i + 1
+			for j < len(stmt) && isWordByte(stmt[j]) {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: tokenWord, text: stmt[i:j]})
+			i = j
+
+		default:
+			return nil, fmt.Errorf("snowflaketest: unexpected %q in %q", c, stmt)
+		}
+	}
+	return tokens, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
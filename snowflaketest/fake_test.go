@@ -0,0 +1,131 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflaketest
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	fake := NewFake()
+	db, err := fake.Open()
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`create user alice password = 'it''s; secret' days_to_expiry = 1 default_secondary_roles = ('ALL');
+grant role public to user alice;
+alter user alice set tag governance.tags.owner = 'vault', cost_center = '42'`)
+	require.NoError(t, err)
+
+	user, ok := fake.User("alice")
+	require.True(t, ok)
+	require.Equal(t, "ALICE", user.Name)
+	require.Equal(t, "it's; secret", user.Properties["PASSWORD"])
+	require.Equal(t, "ALL", user.Properties["DEFAULT_SECONDARY_ROLES"])
+	require.Equal(t, map[string]string{"GOVERNANCE.TAGS.OWNER": "vault", "COST_CENTER": "42"}, user.Tags)
+	require.Equal(t, []string{"PUBLIC"}, user.Roles)
+	require.False(t, user.ExpiresAt.IsZero())
+
+	_, err = db.Exec(`create user "Alice"`)
+	require.NoError(t, err, "quoted names are case sensitive")
+	_, err = db.Exec(`create user ALICE`)
+	var sfErr *gosnowflake.SnowflakeError
+	require.ErrorAs(t, err, &sfErr)
+	require.Equal(t, ErrNumObjectAlreadyExists, sfErr.Number)
+
+	var count int
+	rows, err := db.Query(`show users like 'ali%'`)
+	require.NoError(t, err)
+	for rows.Next() {
+		count++
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, 2, count, "SHOW ... LIKE is case insensitive")
+
+	_, err = db.Exec(`alter user alice set password policy security.policies.vault`)
+	require.NoError(t, err)
+	user, _ = fake.User("alice")
+	require.Equal(t, "SECURITY.POLICIES.VAULT", user.PasswordPolicy)
+	_, err = db.Exec(`alter user alice set password policy security.policies.other`)
+	require.Error(t, err, "a user has at most one password policy")
+
+	_, err = db.Exec(`create network rule security.network.alice_rule mode = ingress type = ipv4 value_list = ('10.0.0.0/8');
+create network policy alice_policy allowed_network_rule_list = ('security.network.alice_rule');
+alter user alice set network_policy = alice_policy`)
+	require.NoError(t, err)
+	_, ok = fake.NetworkRule("security.network.alice_rule")
+	require.True(t, ok)
+	_, err = db.Exec(`drop network policy alice_policy`)
+	require.Error(t, err, "a network policy attached to a user cannot be dropped")
+
+	_, err = db.Exec(`alter user alice unset password, days_to_expiry`)
+	require.NoError(t, err)
+	user, _ = fake.User("alice")
+	require.NotContains(t, user.Properties, "PASSWORD")
+
+	_, err = db.Exec(`drop user if exists nobody; drop user alice`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Alice"}, fake.Users())
+
+	_, err = db.Exec(`drop user alice`)
+	require.ErrorAs(t, err, &sfErr)
+	require.Equal(t, ErrNumObjectDoesNotExist, sfErr.Number)
+
+	_, err = db.Exec(`select 1`)
+	require.ErrorContains(t, err, "unsupported statement")
+}
+
+func TestFake_DescribeUser(t *testing.T) {
+	fake := NewFake()
+	db, err := fake.Open()
+	require.NoError(t, err)
+	defer db.Close()
+
+	pub, _ := GenerateRSAKeyPair(t, 2048)
+	block := string(pub)
+	_, err = db.Exec("create user bob rsa_public_key = '" + block[len("-----BEGIN PUBLIC KEY-----\n"):len(block)-len("-----END PUBLIC KEY-----\n")] + "'")
+	require.NoError(t, err)
+
+	props := describe(t, db, "bob")
+	require.Regexp(t, `^SHA256:`, props["RSA_PUBLIC_KEY_FP"])
+	require.Equal(t, "null", props["RSA_PUBLIC_KEY_2_FP"])
+}
+
+func TestFake_FailOn(t *testing.T) {
+	fake := NewFake()
+	db, err := fake.Open()
+	require.NoError(t, err)
+	defer db.Close()
+
+	fake.FailOn("GRANT ROLE", errors.New("denied"))
+	_, err = db.Exec("create user carol; grant role public to user carol; drop user carol")
+	require.EqualError(t, err, "denied")
+	require.Equal(t, []string{"CAROL"}, fake.Users(), "statements before the failure should have run")
+	require.Len(t, fake.Statements(), 2)
+
+	fake.ClearFailures()
+	_, err = db.Exec("grant role public to user carol")
+	require.NoError(t, err)
+}
+
+func describe(t *testing.T, db *sql.DB, name string) map[string]string {
+	t.Helper()
+	rows, err := db.Query("describe user " + name)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	props := map[string]string{}
+	for rows.Next() {
+		var property, value, def, description string
+		require.NoError(t, rows.Scan(&property, &value, &def, &description))
+		props[property] = value
+	}
+	require.NoError(t, rows.Err())
+	return props
+}
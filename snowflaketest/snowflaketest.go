@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package snowflaketest holds the helpers the plugin's acceptance tests use
+// to connect to a Snowflake account and check the credentials the plugin
+// manages, for reuse by wrappers and forks running the same tests against
+// their own accounts.
+//
+// The account is configured with the SNOWFLAKE_ACCOUNT, SNOWFLAKE_USER, and
+// SNOWFLAKE_PASSWORD environment variables, and optionally
+// SNOWFLAKE_DATABASE and SNOWFLAKE_SCHEMA. Acceptance tests run when
+// VAULT_ACC is set.
+package snowflaketest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	EnvVarSnowflakeAccount  = "SNOWFLAKE_ACCOUNT"
+	EnvVarSnowflakeUser     = "SNOWFLAKE_USER"
+	EnvVarSnowflakePassword = "SNOWFLAKE_PASSWORD"
+	EnvVarSnowflakeDatabase = "SNOWFLAKE_DATABASE"
+	EnvVarSnowflakeSchema   = "SNOWFLAKE_SCHEMA"
+
+	EnvVarRunAccTests = "VAULT_ACC"
+
+	// EnvVarRequestTimeout overrides the timeout returned by RequestTimeout.
+	EnvVarRequestTimeout = "VAULT_TEST_DATABASE_REQUEST_TIMEOUT"
+)
+
+// AcceptanceTestsEnabled reports whether acceptance tests should run.
+func AcceptanceTestsEnabled() bool {
+	return os.Getenv(EnvVarRunAccTests) != ""
+}
+
+// ConnURL returns the DSN for the configured account, failing the test if
+// it is not configured.
+func ConnURL(t testing.TB) string {
+	t.Helper()
+	connURL, err := DSN()
+	if err != nil {
+		t.Fatalf("failed to retrieve connection DSN: %s", err)
+	}
+
+	return connURL
+}
+
+// DSN returns the DSN for the configured account.
+func DSN() (string, error) {
+	user := os.Getenv(EnvVarSnowflakeUser)
+	password := os.Getenv(EnvVarSnowflakePassword)
+	account := os.Getenv(EnvVarSnowflakeAccount)
+
+	var err error
+	if user == "" {
+		err = multierror.Append(err, fmt.Errorf("%s not set", EnvVarSnowflakeUser))
+	}
+	if password == "" {
+		err = multierror.Append(err, fmt.Errorf("%s not set", EnvVarSnowflakePassword))
+	}
+	if account == "" {
+		err = multierror.Append(err, fmt.Errorf("%s not set", EnvVarSnowflakeAccount))
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	dsnString := fmt.Sprintf("%s:%s@%s", user, password, account)
+
+	database := os.Getenv(EnvVarSnowflakeDatabase)
+	schema := os.Getenv(EnvVarSnowflakeSchema)
+
+	if database != "" {
+		dsnString += "/" + database
+		if schema != "" {
+			dsnString += "/" + schema
+		}
+	}
+
+	return dsnString, nil
+}
+
+// VerifyKeyPairCredential logs in to the account connString names as
+// username, authenticating with private.
+func VerifyKeyPairCredential(connString, username string, private *rsa.PrivateKey) error {
+	conf, err := gosnowflake.ParseDSN(connString)
+	if err != nil {
+		return err
+	}
+
+	config := &gosnowflake.Config{
+		Authenticator: gosnowflake.AuthTypeJwt,
+		Account:       conf.Account,
+		Region:        conf.Region,
+		Database:      conf.Database,
+		Schema:        conf.Schema,
+		User:          username,
+		PrivateKey:    private,
+	}
+	return ping(config)
+}
+
+// VerifyPasswordCredential logs in to the account connString names as
+// username, authenticating with password.
+func VerifyPasswordCredential(connString, username, password string) error {
+	conf, err := gosnowflake.ParseDSN(connString)
+	if err != nil {
+		return err
+	}
+
+	config := &gosnowflake.Config{
+		Authenticator: gosnowflake.AuthTypeSnowflake,
+		Account:       conf.Account,
+		Region:        conf.Region,
+		Database:      conf.Database,
+		Schema:        conf.Schema,
+		User:          username,
+		Password:      password,
+	}
+	return ping(config)
+}
+
+func ping(config *gosnowflake.Config) error {
+	dsn, err := gosnowflake.DSN(config)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("snowflake", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Ping()
+}
+
+// AssertPasswordCredentialsExist fails the test if username cannot log in
+// with password.
+func AssertPasswordCredentialsExist(t testing.TB, connString, username, password string) {
+	t.Helper()
+	err := VerifyPasswordCredential(connString, username, password)
+	if err != nil {
+		t.Fatalf("failed to log in with password credential: %s", err)
+	}
+}
+
+// AssertPasswordCredentialsDoNotExist is a helper to assert db creds were
+// properly removed. A successful assertion will result in the gosnowflake
+// default logger to output `msg="Authentication FAILED"` in the test logs.
+func AssertPasswordCredentialsDoNotExist(t testing.TB, connString, username, password string) {
+	t.Helper()
+	err := VerifyPasswordCredential(connString, username, password)
+	if err == nil {
+		t.Fatalf("logged in when it shouldn't have been able to")
+	}
+}
+
+// AssertRSAKeyPairCredentialsExist fails the test if username cannot log
+// in with private.
+func AssertRSAKeyPairCredentialsExist(t testing.TB, connString, username string, private *rsa.PrivateKey) {
+	t.Helper()
+	err := VerifyKeyPairCredential(connString, username, private)
+	if err != nil {
+		t.Fatalf("failed to log in with RSA key pair credential: %s", err)
+	}
+}
+
+// AssertRSAKeyPairCredentialsDoNotExist fails the test if username can log
+// in with private.
+func AssertRSAKeyPairCredentialsDoNotExist(t testing.TB, connString, username string, private *rsa.PrivateKey) {
+	t.Helper()
+	err := VerifyKeyPairCredential(connString, username, private)
+	if err == nil {
+		t.Fatalf("logged in when it shouldn't have been able to")
+	}
+}
+
+// DropUser drops a user created by a test, so tests do not clutter a
+// shared account. Failures are logged rather than failing the test.
+func DropUser(connString, username string) {
+	db, err := sql.Open("snowflake", connString)
+	if err != nil {
+		log.Printf("connection issue: %s", err)
+		return
+	}
+
+	defer db.Close()
+	_, err = db.Exec(fmt.Sprintf("DROP USER %s", username))
+
+	if err != nil {
+		log.Printf("query issue: %s", err)
+	}
+}
+
+// RequestTimeout returns the timeout for requests made to the plugin,
+// which defaults to a minute.
+func RequestTimeout(t testing.TB) time.Duration {
+	t.Helper()
+	rawDur := os.Getenv(EnvVarRequestTimeout)
+	if rawDur == "" {
+		return 1 * time.Minute
+	}
+
+	dur, err := time.ParseDuration(rawDur)
+	if err != nil {
+		t.Fatalf("Failed to parse custom request timeout %q: %s", rawDur, err)
+	}
+	return dur
+}
+
+// GenerateRSAKeyPair returns a new RSA key and its PEM encoded public key.
+func GenerateRSAKeyPair(t testing.TB, bits int) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	publicBlock := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: public,
+	}
+	return pem.EncodeToMemory(publicBlock), key
+}
@@ -0,0 +1,54 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+)
+
+// statementHooks are statements from pre_statements and post_statements,
+// run before and after creation and revocation statements in the same
+// session, such as USE ROLE or an insert into an audit table. Session
+// state they change, such as the current role, stays with the pooled
+// connection, so a pre statement that changes it should be undone by a
+// post statement.
+type statementHooks struct {
+	pre  []string
+	post []string
+}
+
+func parseStatementHooks(config map[string]interface{}) (statementHooks, error) {
+	var hooks statementHooks
+	var err error
+
+	if hooks.pre, err = getStatements(config, "pre_statements"); err != nil {
+		return hooks, err
+	}
+	if hooks.post, err = getStatements(config, "post_statements"); err != nil {
+		return hooks, err
+	}
+	return hooks, nil
+}
+
+// check returns an error if the hooks use template variables other than
+// those in m. Hooks run for revocations as well as creations, so only the
+// variables both have are allowed.
+func (h statementHooks) check(m map[string]string) error {
+	if err := checkPlaceholders(append(append([]string(nil), h.pre...), h.post...), m); err != nil {
+		return fmt.Errorf("invalid pre_statements or post_statements: %w", err)
+	}
+	return nil
+}
+
+// wrap returns queries with the pre statements before them and the post
+// statements after them.
+func (h statementHooks) wrap(queries []string) []string {
+	if len(h.pre) == 0 && len(h.post) == 0 {
+		return queries
+	}
+	wrapped := make([]string, 0, len(h.pre)+len(queries)+len(h.post))
+	wrapped = append(wrapped, h.pre...)
+	wrapped = append(wrapped, queries...)
+	return append(wrapped, h.post...)
+}
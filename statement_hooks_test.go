@@ -0,0 +1,70 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	dbtesting "github.com/hashicorp/vault/sdk/database/dbplugin/v5/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatementHooks(t *testing.T) {
+	hooks, err := parseStatementHooks(map[string]interface{}{
+		"pre_statements":  "USE ROLE SECURITYADMIN; USE SECONDARY ROLES NONE;",
+		"post_statements": []interface{}{"INSERT INTO audit.log VALUES ('{{name}}')", "USE ROLE SYSADMIN"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"USE ROLE SECURITYADMIN", "USE SECONDARY ROLES NONE"}, hooks.pre)
+	require.Equal(t, []string{"INSERT INTO audit.log VALUES ('{{name}}')", "USE ROLE SYSADMIN"}, hooks.post)
+	require.Equal(t, []string{"USE ROLE SECURITYADMIN", "USE SECONDARY ROLES NONE", "drop user a",
+		"INSERT INTO audit.log VALUES ('{{name}}')", "USE ROLE SYSADMIN"}, hooks.wrap([]string{"drop user a"}))
+
+	require.NoError(t, hooks.check(map[string]string{"name": "", "username": ""}))
+	hooks.post = append(hooks.post, "INSERT INTO audit.log VALUES ('{{password}}')")
+	require.ErrorContains(t, hooks.check(map[string]string{"name": "", "username": ""}), "{{password}}")
+
+	_, err = parseStatementHooks(map[string]interface{}{"pre_statements": 42})
+	require.Error(t, err)
+
+	hooks, err = parseStatementHooks(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"drop user a"}, hooks.wrap([]string{"drop user a"}))
+}
+
+func TestSnowflakeSQL_StatementHooks(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"pre_statements":  "USE ROLE SECURITYADMIN",
+		"post_statements": "INSERT INTO audit.log VALUES ('{{name}}'); USE ROLE SYSADMIN",
+	})
+
+	resp := dbtesting.AssertNewUser(t, db, fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{Username: resp.Username})
+
+	stmts := fake.Statements()
+	require.Equal(t, "USE ROLE SECURITYADMIN", stmts[0])
+	require.True(t, strings.HasPrefix(stmts[1], "CREATE USER "))
+	require.Equal(t, "INSERT INTO audit.log VALUES ('"+resp.Username+"')", stmts[2])
+	require.Equal(t, "USE ROLE SYSADMIN", stmts[3])
+
+	require.Equal(t, "USE ROLE SECURITYADMIN", stmts[4])
+	require.Equal(t, "USE ROLE SYSADMIN", stmts[len(stmts)-1])
+	require.Empty(t, fake.Users())
+}
+
+func TestSnowflakeSQL_StatementHooks_UnknownVariable(t *testing.T) {
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":  "vault:password@account/db",
+			"post_statements": "INSERT INTO audit.log VALUES ('{{role_name}}')",
+		},
+	})
+	require.ErrorContains(t, err, "invalid pre_statements or post_statements")
+}
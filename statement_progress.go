@@ -0,0 +1,168 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type statementProgressKey struct{}
+
+// statementProgress records the statements an operation has run. Snowflake
+// commits DDL as it runs, so rolling back the transaction of an operation
+// that is cancelled part way does not undo the statements that completed,
+// and the caller needs to know which they were.
+type statementProgress struct {
+	mu        sync.Mutex
+	completed []string
+	inFlight  []string
+
+	// pending are the statements an operation has planned but not started.
+	pending []string
+}
+
+// withStatementProgress returns a context in which execQuery and
+// executeQueries record the statements they run.
+func withStatementProgress(ctx context.Context) (context.Context, *statementProgress) {
+	p := &statementProgress{}
+	return context.WithValue(ctx, statementProgressKey{}, p), p
+}
+
+func statementProgressFromContext(ctx context.Context) *statementProgress {
+	p, _ := ctx.Value(statementProgressKey{}).(*statementProgress)
+	return p
+}
+
+// plan records queries as statements the operation will run, so that an
+// interruption can report those it did not get to.
+func (p *statementProgress) plan(queries []string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, queries...)
+}
+
+// start records queries as in flight. Requests may run concurrently, so
+// their statements are tracked separately until they finish.
+func (p *statementProgress) start(queries []string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, query := range queries {
+		p.pending = removeStatement(p.pending, query)
+	}
+	p.inFlight = append(p.inFlight, queries...)
+}
+
+func (p *statementProgress) finish(queries []string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Snowflake may have run the statements of a failed request, or some
+	// of them, before the failure, so they stay in flight.
+	if err != nil {
+		return
+	}
+	for _, query := range queries {
+		p.inFlight = removeStatement(p.inFlight, query)
+	}
+	p.completed = append(p.completed, queries...)
+}
+
+// removeStatement removes the first occurrence of query from queries.
+func removeStatement(queries []string, query string) []string {
+	for i, q := range queries {
+		if q == query {
+			return append(queries[:i], queries[i+1:]...)
+		}
+	}
+	return queries
+}
+
+// interrupted wraps err with the statements that had run if the operation
+// stopped because ctx was cancelled after it began running statements.
+// Otherwise err is returned unchanged.
+func (p *statementProgress) interrupted(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.completed) == 0 && len(p.inFlight) == 0 {
+		return err
+	}
+	return &interruptedError{
+		Completed: append([]string(nil), p.completed...),
+		InFlight:  append([]string(nil), p.inFlight...),
+		Remaining: append([]string(nil), p.pending...),
+		err:       err,
+	}
+}
+
+// runStatements runs the given queries with exec, unless ctx is already
+// done, and records them in the context's statement progress.
+func runStatements(ctx context.Context, queries []string, exec func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p := statementProgressFromContext(ctx)
+	p.start(queries)
+	err := exec()
+	p.finish(queries, err)
+	return err
+}
+
+// interruptedError is returned by an operation cancelled after it began
+// running statements. The statements are the templates from the role and
+// plugin configuration, so they do not contain generated credentials.
+type interruptedError struct {
+	Completed []string
+
+	// InFlight are the statements of the request that failed, some of
+	// which may have run.
+	InFlight []string
+
+	// Remaining are the planned statements that did not start. Retrying
+	// the operation runs them.
+	Remaining []string
+
+	err error
+}
+
+func (e *interruptedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "stopped after %d statement(s) completed", len(e.Completed))
+	if len(e.Completed) > 0 {
+		fmt.Fprintf(&b, " [%s]", joinStatements(e.Completed))
+	}
+	if len(e.InFlight) > 0 {
+		fmt.Fprintf(&b, ", %d more may have run [%s]", len(e.InFlight), joinStatements(e.InFlight))
+	}
+	if len(e.Remaining) > 0 {
+		fmt.Fprintf(&b, ", %d not run [%s]", len(e.Remaining), joinStatements(e.Remaining))
+	}
+	fmt.Fprintf(&b, ": %v", e.err)
+	return b.String()
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+func joinStatements(stmts []string) string {
+	trimmed := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		trimmed[i] = strings.Join(strings.Fields(stmt), " ")
+	}
+	return strings.Join(trimmed, "; ")
+}
@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflakeSQL_NewUser_Cancelled(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake.FailOnFunc("GRANT ROLE", func() error {
+		cancel()
+		return context.Canceled
+	})
+
+	_, err := db.NewUser(ctx, fakeNewUserRequest(
+		"CREATE USER {{name}} PASSWORD = '{{password}}';",
+		"GRANT ROLE public TO USER {{name}};",
+		"ALTER USER {{name}} SET COMMENT = 'never run';",
+	))
+	require.ErrorIs(t, err, context.Canceled)
+
+	var interrupted *interruptedError
+	require.ErrorAs(t, err, &interrupted)
+	require.Equal(t, []string{"CREATE USER {{name}} PASSWORD = '{{password}}'"}, interrupted.Completed)
+	require.Equal(t, []string{"GRANT ROLE public TO USER {{name}}"}, interrupted.InFlight)
+	require.NotContains(t, err.Error(), "y8fva_sdVA3rasf")
+
+	for _, stmt := range fake.Statements() {
+		require.NotContains(t, stmt, "never run", "no statement should run after cancellation")
+	}
+}
+
+func TestSnowflakeSQL_DeleteUser_DeadlineExceeded(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{"ephemeral_role": true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	fake.FailOnFunc("drop user", func() error {
+		cancel()
+		return context.DeadlineExceeded
+	})
+
+	_, err := db.DeleteUser(ctx, dbplugin.DeleteUserRequest{Username: "v_someone"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var interrupted *interruptedError
+	require.ErrorAs(t, err, &interrupted)
+	require.Equal(t, []string{"alter user if exists {{name}} unset RSA_PUBLIC_KEY, RSA_PUBLIC_KEY_2"}, interrupted.Completed)
+	require.Equal(t, []string{"drop user if exists {{name}}"}, interrupted.InFlight)
+	require.Equal(t, []string{"drop role if exists {{role}}"}, interrupted.Remaining)
+	require.ErrorContains(t, err, ", 1 not run [drop role if exists {{role}}]")
+
+	var classified *classifiedError
+	require.ErrorAs(t, err, &classified)
+	require.True(t, classified.Retryable)
+}
+
+func TestSnowflakeSQL_UpdateUser_CancelledBeforeStatements(t *testing.T) {
+	db, fake := newFakeSnowflake(t, nil)
+	before := len(fake.Statements())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+		Username: "vault_user",
+		Password: &dbplugin.ChangePassword{NewPassword: "new_password"},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	var interrupted *interruptedError
+	require.False(t, errors.As(err, &interrupted), "nothing ran, so there is nothing to report")
+	require.Len(t, fake.Statements(), before)
+}
+
+func TestStatementProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, progress := withStatementProgress(ctx)
+
+	ok := func() error { return nil }
+	require.NoError(t, runStatements(ctx, []string{"create user a"}, ok))
+	require.NoError(t, runStatements(ctx, []string{"grant role r\n  to user a", "alter user a set x = 1"}, ok))
+	require.Equal(t, errors.New("boom"), progress.interrupted(ctx, errors.New("boom")),
+		"errors are only wrapped once the context is done")
+
+	cancel()
+	err := runStatements(ctx, []string{"drop user a"}, func() error {
+		t.Fatal("statements must not run once the context is done")
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	err = progress.interrupted(ctx, err)
+	require.EqualError(t, err, "stopped after 3 statement(s) completed [create user a; grant role r to user a; alter user a set x = 1]: context canceled")
+
+	require.NoError(t, runStatements(context.Background(), nil, ok), "contexts without progress are not tracked")
+}
@@ -0,0 +1,163 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// splitStatements splits a block of SQL into individual queries on the
+// semicolons that terminate them. Semicolons inside single-quoted string
+// literals, double-quoted identifiers, dollar-quoted blocks, and comments
+// do not end a query. Queries are trimmed of surrounding whitespace, and
+// queries made up of only whitespace and comments are dropped.
+func splitStatements(stmt string) []string {
+	var (
+		queries    []string
+		start      int
+		hasContent bool
+	)
+
+	appendQuery := func(end int) {
+		if hasContent {
+			queries = append(queries, strings.TrimSpace(stmt[start:end]))
+		}
+		hasContent = false
+	}
+
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case c == ';':
+			appendQuery(i)
+			start = i + 1
+
+		case c == '\'':
+			i = skipQuoted(stmt, i, '\'', true)
+			hasContent = true
+
+		case c == '"':
+			i = skipQuoted(stmt, i, '"', false)
+			hasContent = true
+
+		case c == '$' && strings.HasPrefix(stmt[i:], "$$"):
+			end := strings.Index(stmt[i+2:], "$$")
+			if end < 0 {
+				i = len(stmt) - 1
+			} else {
+				i += end + 3
+			}
+			hasContent = true
+
+		case strings.HasPrefix(stmt[i:], "--"), strings.HasPrefix(stmt[i:], "//"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				i = len(stmt) - 1
+			} else {
+				i += end
+			}
+
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				i = len(stmt) - 1
+			} else {
+				i += end + 3
+			}
+
+		case c == ' ', c == '\t', c == '\n', c == '\r':
+
+		default:
+			hasContent = true
+		}
+	}
+	appendQuery(len(stmt))
+
+	return queries
+}
+
+// skipQuoted returns the index of the quote that closes the quoted section
+// opening at stmt[start]. A doubled quote character is treated as an escaped
+// quote, as is a backslash-escaped character when backslash is true. An
+// unterminated section runs to the end of stmt.
+func skipQuoted(stmt string, start int, quote byte, backslash bool) int {
+	for i := start + 1; i < len(stmt); i++ {
+		switch stmt[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(stmt) && stmt[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(stmt) - 1
+}
+
+// unquotedIdentifier matches identifiers Snowflake accepts without quotes.
+var unquotedIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// identifier returns name as it should appear in a statement: unchanged if
+// it is a valid unquoted identifier, and double-quoted otherwise.
+func identifier(name string) string {
+	if unquotedIdentifier.MatchString(name) {
+		return name
+	}
+	return quoteIdentifier(name)
+}
+
+// quoteIdentifier returns name as a double-quoted Snowflake identifier.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// qualifiedIdentifier formats each dot-separated part of name with
+// identifier, for names such as db.schema.tag.
+func qualifiedIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = identifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteString returns s as a single-quoted Snowflake string literal.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+// templatePlaceholder matches a template variable in a statement, including
+// ones with whitespace inside the braces, which are not substituted.
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)?\s*\}\}`)
+
+// checkPlaceholders returns an error naming every template variable in the
+// statements that would not be substituted with m, such as a misspelled
+// variable, so a typo is reported before any statement runs.
+func checkPlaceholders(statements []string, m map[string]string) error {
+	var unknown []string
+	seen := map[string]bool{}
+	for _, stmt := range statements {
+		for _, match := range templatePlaceholder.FindAllStringSubmatch(stmt, -1) {
+			placeholder, name := match[0], match[1]
+			if _, ok := m[name]; ok && placeholder == "{{"+name+"}}" {
+				continue
+			}
+			if !seen[placeholder] {
+				seen[placeholder] = true
+				unknown = append(unknown, placeholder)
+			}
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("statements contain unknown template variables: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := map[string]struct {
+		stmt     string
+		expected []string
+	}{
+		"empty": {
+			stmt:     "",
+			expected: nil,
+		},
+		"single query without terminator": {
+			stmt:     "DROP USER foo",
+			expected: []string{"DROP USER foo"},
+		},
+		"multiple queries with whitespace": {
+			stmt: `
+				CREATE USER {{name}} PASSWORD = '{{password}}';
+				GRANT ROLE public TO USER {{name}};`,
+			expected: []string{
+				"CREATE USER {{name}} PASSWORD = '{{password}}'",
+				"GRANT ROLE public TO USER {{name}}",
+			},
+		},
+		"empty queries are dropped": {
+			stmt:     ";; DROP USER foo;;",
+			expected: []string{"DROP USER foo"},
+		},
+		"semicolon in string literal": {
+			stmt: "CREATE USER foo PASSWORD = 'a;b'; GRANT ROLE public TO USER foo;",
+			expected: []string{
+				"CREATE USER foo PASSWORD = 'a;b'",
+				"GRANT ROLE public TO USER foo",
+			},
+		},
+		"escaped quotes in string literal": {
+			stmt: `CREATE USER foo COMMENT = 'it''s; \'quoted\';'; DROP USER bar`,
+			expected: []string{
+				`CREATE USER foo COMMENT = 'it''s; \'quoted\';'`,
+				"DROP USER bar",
+			},
+		},
+		"semicolon in quoted identifier": {
+			stmt:     `CREATE USER "odd;name"; DROP USER bar`,
+			expected: []string{`CREATE USER "odd;name"`, "DROP USER bar"},
+		},
+		"semicolon in dollar-quoted block": {
+			stmt:     "CREATE USER foo COMMENT = $$a;b$$; DROP USER bar",
+			expected: []string{"CREATE USER foo COMMENT = $$a;b$$", "DROP USER bar"},
+		},
+		"semicolon in comments": {
+			stmt: `
+				-- create the user; then grant
+				CREATE USER foo; /* grant; */ GRANT ROLE public TO USER foo;
+				// trailing comment;`,
+			expected: []string{
+				"-- create the user; then grant\n\t\t\t\tCREATE USER foo",
+				"/* grant; */ GRANT ROLE public TO USER foo",
+			},
+		},
+		"unterminated string literal": {
+			stmt:     "CREATE USER foo PASSWORD = 'a;b",
+			expected: []string{"CREATE USER foo PASSWORD = 'a;b"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, splitStatements(test.stmt))
+		})
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	require.Equal(t, "corp_network", identifier("corp_network"))
+	require.Equal(t, `"corp-network"`, identifier("corp-network"))
+	require.Equal(t, `"SECURITYADMIN"`, quoteIdentifier("SECURITYADMIN"))
+	require.Equal(t, `"my ""odd"" role"`, quoteIdentifier(`my "odd" role`))
+}
+
+func TestQuoteString(t *testing.T) {
+	require.Equal(t, `'vault'`, quoteString("vault"))
+	require.Equal(t, `'o''brien \\ co'`, quoteString(`o'brien \ co`))
+	require.Equal(t, `governance.tags."cost-center"`, qualifiedIdentifier("governance.tags.cost-center"))
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	m := map[string]string{"name": "V_USER", "password": "secret"}
+
+	require.NoError(t, checkPlaceholders([]string{
+		"create user {{name}} password = '{{password}}';",
+		"grant role analyst to user {{name}};",
+	}, m))
+
+	err := checkPlaceholders([]string{
+		"create user {{username}} password = '{{ password }}';",
+		"grant role analyst to user {{username}} comment = '{{}}';",
+	}, m)
+	require.EqualError(t, err, "statements contain unknown template variables: {{username}}, {{ password }}, {{}}")
+}
@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Status holds counters of what the plugin process has done since it
+// started, across every database config it serves, so that operators can
+// see how it is doing without going through its logs.
+type Status struct {
+	StartedAt          time.Time  `json:"started_at"`
+	UsersCreated       uint64     `json:"users_created"`
+	UsersDeleted       uint64     `json:"users_deleted"`
+	CredentialsRotated uint64     `json:"credentials_rotated"`
+	UsersRenewed       uint64     `json:"users_renewed"`
+	FailedOperations   uint64     `json:"failed_operations"`
+	Reconnects         uint64     `json:"reconnects"`
+	Failovers          uint64     `json:"failovers"`
+	LastSuccess        *time.Time `json:"last_success,omitempty"`
+}
+
+// operationStats are the counters behind CurrentStatus.
+var operationStats = &statusCounters{startedAt: time.Now()}
+
+type statusCounters struct {
+	startedAt          time.Time
+	usersCreated       atomic.Uint64
+	usersDeleted       atomic.Uint64
+	credentialsRotated atomic.Uint64
+	usersRenewed       atomic.Uint64
+	failedOperations   atomic.Uint64
+	reconnects         atomic.Uint64
+	failovers          atomic.Uint64
+
+	// lastSuccess is the Unix time in nanoseconds of the last user
+	// operation that succeeded, or zero.
+	lastSuccess atomic.Int64
+}
+
+// record counts a user operation, named as emitMetrics names it. Other
+// operations, such as initialize, are not counted.
+func (c *statusCounters) record(operation string, err error, now time.Time) {
+	var succeeded *atomic.Uint64
+	switch operation {
+	case "new_user":
+		succeeded = &c.usersCreated
+	case "delete_user":
+		succeeded = &c.usersDeleted
+	case "rotate_credential":
+		succeeded = &c.credentialsRotated
+	case "renew_user":
+		succeeded = &c.usersRenewed
+	default:
+		return
+	}
+
+	if err != nil {
+		c.failedOperations.Add(1)
+		return
+	}
+	succeeded.Add(1)
+	c.lastSuccess.Store(now.UnixNano())
+}
+
+func (c *statusCounters) status() Status {
+	status := Status{
+		StartedAt:          c.startedAt.UTC(),
+		UsersCreated:       c.usersCreated.Load(),
+		UsersDeleted:       c.usersDeleted.Load(),
+		CredentialsRotated: c.credentialsRotated.Load(),
+		UsersRenewed:       c.usersRenewed.Load(),
+		FailedOperations:   c.failedOperations.Load(),
+		Reconnects:         c.reconnects.Load(),
+		Failovers:          c.failovers.Load(),
+	}
+	if nanos := c.lastSuccess.Load(); nanos != 0 {
+		lastSuccess := time.Unix(0, nanos).UTC()
+		status.LastSuccess = &lastSuccess
+	}
+	return status
+}
+
+// CurrentStatus returns the counters of the plugin process.
+func CurrentStatus() Status {
+	return operationStats.status()
+}
+
+// StatusHandler serves CurrentStatus as JSON.
+func StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CurrentStatus())
+	})
+}
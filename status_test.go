@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusCounters(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	c := &statusCounters{startedAt: start}
+	require.Equal(t, Status{StartedAt: start}, c.status())
+
+	c.record("new_user", nil, start.Add(time.Minute))
+	c.record("new_user", errors.New("boom"), start.Add(2*time.Minute))
+	c.record("delete_user", nil, start.Add(3*time.Minute))
+	c.record("rotate_credential", nil, start.Add(4*time.Minute))
+	c.record("renew_user", errors.New("boom"), start.Add(5*time.Minute))
+	c.record("initialize", errors.New("boom"), start.Add(6*time.Minute))
+	c.reconnects.Add(1)
+
+	lastSuccess := start.Add(4 * time.Minute)
+	require.Equal(t, Status{
+		StartedAt:          start,
+		UsersCreated:       1,
+		UsersDeleted:       1,
+		CredentialsRotated: 1,
+		FailedOperations:   2,
+		Reconnects:         1,
+		LastSuccess:        &lastSuccess,
+	}, c.status())
+}
+
+func TestStatusHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Contains(t, status, "users_created")
+	require.Contains(t, status, "started_at")
+
+	rec = httptest.NewRecorder()
+	StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
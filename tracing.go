@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/snowflakedb/gosnowflake"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/hashicorp/vault-plugin-database-snowflake"
+
+var (
+	_ dbplugin.Database       = tracingMiddleware{}
+	_ logical.PluginVersioner = tracingMiddleware{}
+)
+
+// tracingMiddleware wraps a Database and records a span for each operation.
+// Spans for the individual statements an operation runs are created as its
+// children by execStatement.
+type tracingMiddleware struct {
+	next dbplugin.Database
+}
+
+func (mw tracingMiddleware) Initialize(ctx context.Context, req dbplugin.InitializeRequest) (resp dbplugin.InitializeResponse, err error) {
+	ctx, span := startSpan(ctx, "Initialize",
+		attribute.Bool("snowflake.verify_connection", req.VerifyConnection))
+	defer endSpan(span, &err)
+	return mw.next.Initialize(ctx, req)
+}
+
+func (mw tracingMiddleware) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (resp dbplugin.NewUserResponse, err error) {
+	ctx, span := startSpan(ctx, "NewUser",
+		attribute.String("snowflake.credential_type", req.CredentialType.String()),
+		attribute.String("vault.role_name", req.UsernameConfig.RoleName))
+	defer func() {
+		span.SetAttributes(attribute.String("snowflake.username", resp.Username))
+		endSpan(span, &err)
+	}()
+	return mw.next.NewUser(ctx, req)
+}
+
+func (mw tracingMiddleware) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (resp dbplugin.UpdateUserResponse, err error) {
+	ctx, span := startSpan(ctx, "UpdateUser",
+		attribute.String("snowflake.username", req.Username),
+		attribute.Bool("snowflake.change_credential", req.Password != nil || req.PublicKey != nil),
+		attribute.Bool("snowflake.change_expiration", req.Expiration != nil))
+	defer endSpan(span, &err)
+	return mw.next.UpdateUser(ctx, req)
+}
+
+func (mw tracingMiddleware) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (resp dbplugin.DeleteUserResponse, err error) {
+	ctx, span := startSpan(ctx, "DeleteUser",
+		attribute.String("snowflake.username", req.Username))
+	defer endSpan(span, &err)
+	return mw.next.DeleteUser(ctx, req)
+}
+
+func (mw tracingMiddleware) Type() (string, error) {
+	return mw.next.Type()
+}
+
+func (mw tracingMiddleware) Close() error {
+	return mw.next.Close()
+}
+
+func (mw tracingMiddleware) PluginVersion() logical.PluginVersion {
+	return pluginVersion(mw.next)
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("db.system", snowflakeSQLTypeName))
+	return otel.Tracer(tracerName).Start(ctx, "snowflake."+name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, marking it as failed if err points at a non-nil
+// error. Error messages are deliberately not recorded because Snowflake
+// may echo statement text, including credentials, back in them.
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		var sfErr *gosnowflake.SnowflakeError
+		if errors.As(*err, &sfErr) {
+			span.SetAttributes(
+				attribute.Int("snowflake.error_code", sfErr.Number),
+				attribute.String("snowflake.sql_state", sfErr.SQLState),
+			)
+		}
+		span.SetStatus(codes.Error, "operation failed")
+	}
+	span.End()
+}
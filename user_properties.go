@@ -0,0 +1,197 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+const (
+	userTypeService       = "SERVICE"
+	userTypeLegacyService = "LEGACY_SERVICE"
+	userTypePerson        = "PERSON"
+)
+
+// userProperties are the properties the plugin sets on every user it
+// creates, after the role's creation statements have run.
+type userProperties struct {
+	userType      string
+	networkPolicy string
+
+	// passwordPolicy is attached to password users only.
+	passwordPolicy string
+
+	// secondaryRoles are the user's DEFAULT_SECONDARY_ROLES, or nil to leave
+	// them unset. A list holding only ALL enables every granted role.
+	secondaryRoles []string
+
+	// comment is a template for the user's COMMENT.
+	comment string
+
+	// email and displayName are templates for the user's EMAIL and
+	// DISPLAY_NAME, so that Snowflake shows who a user was created for.
+	// They are left unset when they render empty.
+	email       string
+	displayName string
+
+	// tags maps tag names to templated values. They include the
+	// dynamic_user_tag, set to true, so that masking and row access
+	// policies can match every user created by Vault with one tag.
+	tags map[string]string
+}
+
+func parseUserProperties(config map[string]interface{}) (userProperties, error) {
+	var props userProperties
+
+	userType, err := strutil.GetString(config, "user_type")
+	if err != nil {
+		return props, fmt.Errorf("failed to retrieve user_type: %w", err)
+	}
+	switch userType = strings.ToUpper(userType); userType {
+	case "", userTypeService, userTypeLegacyService, userTypePerson:
+		props.userType = userType
+	default:
+		return props, fmt.Errorf("invalid user_type %q: must be one of %s, %s, or %s",
+			userType, userTypeService, userTypeLegacyService, userTypePerson)
+	}
+
+	if props.networkPolicy, err = strutil.GetString(config, "network_policy"); err != nil {
+		return props, fmt.Errorf("failed to retrieve network_policy: %w", err)
+	}
+
+	if props.passwordPolicy, err = strutil.GetString(config, "password_policy"); err != nil {
+		return props, fmt.Errorf("failed to retrieve password_policy: %w", err)
+	}
+
+	if raw, ok := config["default_secondary_roles"]; ok && raw != nil {
+		// A present but empty value sets DEFAULT_SECONDARY_ROLES = ().
+		roles, err := parseutil.ParseCommaStringSlice(raw)
+		if err != nil {
+			return props, fmt.Errorf("failed to retrieve default_secondary_roles: %w", err)
+		}
+		props.secondaryRoles = []string{}
+		for _, role := range roles {
+			if strings.EqualFold(role, "ALL") {
+				role = "ALL"
+			}
+			props.secondaryRoles = append(props.secondaryRoles, role)
+		}
+	}
+
+	if props.comment, err = strutil.GetString(config, "user_comment_template"); err != nil {
+		return props, fmt.Errorf("failed to retrieve user_comment_template: %w", err)
+	}
+	if props.email, err = strutil.GetString(config, "user_email_template"); err != nil {
+		return props, fmt.Errorf("failed to retrieve user_email_template: %w", err)
+	}
+	if props.displayName, err = strutil.GetString(config, "user_display_name_template"); err != nil {
+		return props, fmt.Errorf("failed to retrieve user_display_name_template: %w", err)
+	}
+
+	if props.tags, err = getStringMap(config, "user_tags"); err != nil {
+		return props, err
+	}
+
+	dynamicUserTag, err := strutil.GetString(config, "dynamic_user_tag")
+	if err != nil {
+		return props, fmt.Errorf("failed to retrieve dynamic_user_tag: %w", err)
+	}
+	if dynamicUserTag != "" {
+		for name := range props.tags {
+			if strings.EqualFold(name, dynamicUserTag) {
+				return props, fmt.Errorf("dynamic_user_tag %q cannot also be set in user_tags", dynamicUserTag)
+			}
+		}
+		if props.tags == nil {
+			props.tags = map[string]string{}
+		}
+		props.tags[dynamicUserTag] = "true"
+	}
+
+	return props, nil
+}
+
+// validate checks that a user with these properties can hold the given
+// credential type.
+func (p userProperties) validate(credentialType dbplugin.CredentialType) error {
+	if p.userType == userTypeService && credentialType == dbplugin.CredentialTypePassword {
+		return fmt.Errorf("password credentials cannot be used with users of type %s", userTypeService)
+	}
+	return nil
+}
+
+// queries returns the queries that apply these properties to the user
+// referenced by the {{name}} template variable. The comment, email, display
+// name, and tag values are rendered with m and quoted here, since the template variables
+// available to them are not safe to substitute into a string literal
+// unescaped.
+func (p userProperties) queries(m map[string]string) []string {
+	var queries []string
+
+	var set []string
+	if p.userType != "" {
+		set = append(set, fmt.Sprintf("TYPE = %s", p.userType))
+	}
+	if p.networkPolicy != "" {
+		set = append(set, fmt.Sprintf("NETWORK_POLICY = %s", identifier(p.networkPolicy)))
+	}
+	if p.secondaryRoles != nil {
+		roles := make([]string, 0, len(p.secondaryRoles))
+		for _, role := range p.secondaryRoles {
+			roles = append(roles, quoteString(role))
+		}
+		set = append(set, fmt.Sprintf("DEFAULT_SECONDARY_ROLES = (%s)", strings.Join(roles, ", ")))
+	}
+	if p.comment != "" {
+		set = append(set, fmt.Sprintf("COMMENT = %s", quoteString(dbutil.QueryHelper(p.comment, m))))
+	}
+	if email := dbutil.QueryHelper(p.email, m); email != "" {
+		set = append(set, fmt.Sprintf("EMAIL = %s", quoteString(email)))
+	}
+	if displayName := dbutil.QueryHelper(p.displayName, m); displayName != "" {
+		set = append(set, fmt.Sprintf("DISPLAY_NAME = %s", quoteString(displayName)))
+	}
+	if len(set) > 0 {
+		queries = append(queries, fmt.Sprintf("alter user {{name}} set %s", strings.Join(set, " ")))
+	}
+
+	// Only password users are rendered with a password.
+	if _, ok := m["password"]; ok && p.passwordPolicy != "" {
+		queries = append(queries, fmt.Sprintf("alter user {{name}} set password policy %s", qualifiedIdentifier(p.passwordPolicy)))
+	}
+
+	if len(p.tags) > 0 {
+		names := make([]string, 0, len(p.tags))
+		for name := range p.tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		tags := make([]string, 0, len(names))
+		for _, name := range names {
+			value := dbutil.QueryHelper(p.tags[name], m)
+			tags = append(tags, fmt.Sprintf("%s = %s", qualifiedIdentifier(name), quoteString(value)))
+		}
+		queries = append(queries, fmt.Sprintf("alter user {{name}} set tag %s", strings.Join(tags, ", ")))
+	}
+
+	return queries
+}
+
+// resumeQueries returns the queries to run before queries on a user an
+// earlier attempt may have set the properties of already, undoing those
+// that cannot be set twice.
+func (p userProperties) resumeQueries(m map[string]string) []string {
+	if _, ok := m["password"]; ok && p.passwordPolicy != "" {
+		return []string{"alter user {{name}} unset password policy"}
+	}
+	return nil
+}
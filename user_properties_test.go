@@ -0,0 +1,193 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserProperties(t *testing.T) {
+	type testCase struct {
+		config          map[string]interface{}
+		credentialType  dbplugin.CredentialType
+		expectedQueries []string
+		expectParseErr  bool
+		expectValidErr  bool
+	}
+
+	tests := map[string]testCase{
+		"no properties": {
+			config:         map[string]interface{}{},
+			credentialType: dbplugin.CredentialTypePassword,
+		},
+		"service user with rsa credential": {
+			config: map[string]interface{}{
+				"user_type": "service",
+			},
+			credentialType:  dbplugin.CredentialTypeRSAPrivateKey,
+			expectedQueries: []string{"alter user {{name}} set TYPE = SERVICE"},
+		},
+		"service user with password credential": {
+			config: map[string]interface{}{
+				"user_type": "SERVICE",
+			},
+			credentialType: dbplugin.CredentialTypePassword,
+			expectValidErr: true,
+		},
+		"legacy service user with password credential": {
+			config: map[string]interface{}{
+				"user_type": "LEGACY_SERVICE",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{"alter user {{name}} set TYPE = LEGACY_SERVICE"},
+		},
+		"network policy": {
+			config: map[string]interface{}{
+				"network_policy": "corp_network",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{"alter user {{name}} set NETWORK_POLICY = corp_network"},
+		},
+		"service user with network policy": {
+			config: map[string]interface{}{
+				"user_type":      "service",
+				"network_policy": "corp-network",
+			},
+			credentialType:  dbplugin.CredentialTypeRSAPrivateKey,
+			expectedQueries: []string{`alter user {{name}} set TYPE = SERVICE NETWORK_POLICY = "corp-network"`},
+		},
+		"comment": {
+			config: map[string]interface{}{
+				"user_type":             "person",
+				"user_comment_template": "Vault role {{role_name}}",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{`alter user {{name}} set TYPE = PERSON COMMENT = 'Vault role analyst''s'`},
+		},
+		"email and display name": {
+			config: map[string]interface{}{
+				"user_email_template":        "{{display_name}}",
+				"user_display_name_template": "{{display_name}} ({{role_name}})",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{`alter user {{name}} set EMAIL = 'oidc-jane@example.com' DISPLAY_NAME = 'oidc-jane@example.com (analyst''s)'`},
+		},
+		"all secondary roles": {
+			config: map[string]interface{}{
+				"default_secondary_roles": "all",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{`alter user {{name}} set DEFAULT_SECONDARY_ROLES = ('ALL')`},
+		},
+		"listed secondary roles": {
+			config: map[string]interface{}{
+				"default_secondary_roles": []interface{}{"ANALYST", "REPORTER"},
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{`alter user {{name}} set DEFAULT_SECONDARY_ROLES = ('ANALYST', 'REPORTER')`},
+		},
+		"no secondary roles": {
+			config: map[string]interface{}{
+				"default_secondary_roles": "",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{`alter user {{name}} set DEFAULT_SECONDARY_ROLES = ()`},
+		},
+		"tags": {
+			config: map[string]interface{}{
+				"user_tags": map[string]interface{}{
+					"governance.tags.cost_center": "{{role_name}}",
+					"owner":                       "vault",
+				},
+			},
+			credentialType: dbplugin.CredentialTypePassword,
+			expectedQueries: []string{
+				`alter user {{name}} set tag governance.tags.cost_center = 'analyst''s', owner = 'vault'`,
+			},
+		},
+		"tags as json": {
+			config: map[string]interface{}{
+				"user_tags": `{"owner": "vault"}`,
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{`alter user {{name}} set tag owner = 'vault'`},
+		},
+		"password policy": {
+			config: map[string]interface{}{
+				"password_policy": "security.policies.vault",
+			},
+			credentialType:  dbplugin.CredentialTypePassword,
+			expectedQueries: []string{"alter user {{name}} set password policy security.policies.vault"},
+		},
+		"password policy with rsa credential": {
+			config: map[string]interface{}{
+				"password_policy": "security.policies.vault",
+			},
+			credentialType: dbplugin.CredentialTypeRSAPrivateKey,
+		},
+		"dynamic user tag": {
+			config: map[string]interface{}{
+				"user_tags":        map[string]interface{}{"owner": "vault"},
+				"dynamic_user_tag": "governance.tags.vault_dynamic_user",
+			},
+			credentialType: dbplugin.CredentialTypeRSAPrivateKey,
+			expectedQueries: []string{
+				`alter user {{name}} set tag governance.tags.vault_dynamic_user = 'true', owner = 'vault'`,
+			},
+		},
+		"dynamic user tag also in user tags": {
+			config: map[string]interface{}{
+				"user_tags":        map[string]interface{}{"Governance.Tags.Vault_Dynamic_User": "false"},
+				"dynamic_user_tag": "governance.tags.vault_dynamic_user",
+			},
+			expectParseErr: true,
+		},
+		"invalid tags": {
+			config: map[string]interface{}{
+				"user_tags": map[string]interface{}{"owner": 42},
+			},
+			expectParseErr: true,
+		},
+		"invalid user type": {
+			config: map[string]interface{}{
+				"user_type": "ROBOT",
+			},
+			expectParseErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			props, err := parseUserProperties(test.config)
+			if test.expectParseErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = props.validate(test.credentialType)
+			if test.expectValidErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			m := map[string]string{
+				"name":         "V_USER",
+				"role_name":    "analyst's",
+				"display_name": "oidc-jane@example.com",
+			}
+			if test.credentialType == dbplugin.CredentialTypePassword {
+				m["password"] = "y8fva_sdVA3rasf"
+			}
+			require.Equal(t, test.expectedQueries, props.queries(m))
+		})
+	}
+
+	// Tokens without a display name leave EMAIL unset rather than empty.
+	props := userProperties{email: "{{display_name}}"}
+	require.Empty(t, props.queries(map[string]string{"name": "V_USER", "display_name": ""}))
+}
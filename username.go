@@ -0,0 +1,208 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template/parse"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// maxIdentifierLength is the maximum length of a Snowflake identifier.
+const maxIdentifierLength = 255
+
+var disallowedIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_$]`)
+
+// usernameOptions control how generated usernames are normalized so they are
+// valid unquoted Snowflake identifiers.
+type usernameOptions struct {
+	uppercase        bool
+	truncate         bool
+	sanitizeMetadata bool
+
+	// quoted makes the statements the plugin issues itself refer to users
+	// by quoted identifier, so that names Snowflake would otherwise upper
+	// case, or reject, match users created with quoted names.
+	quoted bool
+}
+
+func parseUsernameOptions(config map[string]interface{}) (usernameOptions, error) {
+	var opts usernameOptions
+	var err error
+
+	if opts.uppercase, err = getBool(config, "username_uppercase"); err != nil {
+		return opts, err
+	}
+	if opts.truncate, err = getBool(config, "username_truncate"); err != nil {
+		return opts, err
+	}
+	if opts.sanitizeMetadata, err = getBool(config, "username_sanitize_metadata"); err != nil {
+		return opts, err
+	}
+	if opts.quoted, err = getBool(config, "username_quoted"); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// metadata returns the username metadata to render the username template
+// with, stripping characters that are not allowed in unquoted identifiers
+// when sanitizeMetadata is set.
+func (o usernameOptions) metadata(m dbplugin.UsernameMetadata) dbplugin.UsernameMetadata {
+	if !o.sanitizeMetadata {
+		return m
+	}
+
+	return dbplugin.UsernameMetadata{
+		DisplayName: disallowedIdentifierChars.ReplaceAllString(m.DisplayName, ""),
+		RoleName:    disallowedIdentifierChars.ReplaceAllString(m.RoleName, ""),
+	}
+}
+
+// normalize applies the case and length options to a rendered username.
+func (o usernameOptions) normalize(username string) string {
+	if o.uppercase {
+		username = strings.ToUpper(username)
+	}
+	if o.truncate && len(username) > maxIdentifierLength {
+		username = username[:maxIdentifierLength]
+	}
+	return username
+}
+
+// statements returns the plugin's own statements with the user referred to
+// by {{quoted_name}}, the username as a quoted identifier, rather than
+// {{name}} if usernames are quoted. Role statements are left as they are
+// written.
+func (o usernameOptions) statements(queries ...string) []string {
+	if !o.quoted {
+		return queries
+	}
+	quoted := make([]string, 0, len(queries))
+	for _, query := range queries {
+		quoted = append(quoted, strings.ReplaceAll(query, "{{name}}", "{{quoted_name}}"))
+	}
+	return quoted
+}
+
+// identifier returns username as the plugin's own statements refer to it.
+func (o usernameOptions) identifier(username string) string {
+	if o.quoted {
+		return quoteIdentifier(username)
+	}
+	return username
+}
+
+// allowedTemplateFunctions is the allowlist set by
+// SetUsernameTemplateFunctions, shared by every instance in the process so
+// that the operator running the plugin, rather than whoever writes a
+// database config, decides which functions templates may call.
+var allowedTemplateFunctions struct {
+	mu    sync.RWMutex
+	names map[string]bool
+}
+
+// SetUsernameTemplateFunctions limits the functions username_template may
+// call, including text/template builtins such as printf, to names, or
+// removes the limit if names is empty. Templates calling other functions
+// are rejected when a config is initialized. The default template is not
+// checked.
+func SetUsernameTemplateFunctions(names []string) {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+
+	allowedTemplateFunctions.mu.Lock()
+	defer allowedTemplateFunctions.mu.Unlock()
+	if len(allowed) == 0 {
+		allowed = nil
+	}
+	allowedTemplateFunctions.names = allowed
+}
+
+// checkTemplateFunctions returns an error naming the functions text calls
+// that SetUsernameTemplateFunctions does not allow.
+func checkTemplateFunctions(text string) error {
+	allowedTemplateFunctions.mu.RLock()
+	allowed := allowedTemplateFunctions.names
+	allowedTemplateFunctions.mu.RUnlock()
+	if allowed == nil {
+		return nil
+	}
+
+	tree := parse.New("username_template")
+	tree.Mode = parse.SkipFuncCheck
+	trees := map[string]*parse.Tree{}
+	if _, err := tree.Parse(text, "", "", trees); err != nil {
+		return fmt.Errorf("unable to initialize username template: %w", err)
+	}
+
+	used := map[string]bool{}
+	for _, t := range trees {
+		collectTemplateFunctions(t.Root, used)
+	}
+	var disallowed []string
+	for name := range used {
+		if !allowed[name] {
+			disallowed = append(disallowed, name)
+		}
+	}
+	if len(disallowed) > 0 {
+		sort.Strings(disallowed)
+		return fmt.Errorf("invalid username_template: functions not allowed by the plugin: %s", strings.Join(disallowed, ", "))
+	}
+	return nil
+}
+
+// collectTemplateFunctions adds the names of the functions called under
+// node to used.
+func collectTemplateFunctions(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFunctions(child, used)
+		}
+	case *parse.ActionNode:
+		collectTemplateFunctions(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectTemplateFunctions(cmd, used)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectTemplateFunctions(arg, used)
+		}
+	case *parse.ChainNode:
+		collectTemplateFunctions(n.Node, used)
+	case *parse.IdentifierNode:
+		used[n.Ident] = true
+	case *parse.IfNode:
+		collectBranchFunctions(&n.BranchNode, used)
+	case *parse.RangeNode:
+		collectBranchFunctions(&n.BranchNode, used)
+	case *parse.WithNode:
+		collectBranchFunctions(&n.BranchNode, used)
+	case *parse.TemplateNode:
+		collectTemplateFunctions(n.Pipe, used)
+	}
+}
+
+func collectBranchFunctions(n *parse.BranchNode, used map[string]bool) {
+	collectTemplateFunctions(n.Pipe, used)
+	collectTemplateFunctions(n.List, used)
+	collectTemplateFunctions(n.ElseList, used)
+}
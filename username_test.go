@@ -0,0 +1,141 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/helper/template"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflake_GenerateUsername_Options(t *testing.T) {
+	type testCase struct {
+		usernameTemplate string
+		config           map[string]interface{}
+		metadata         dbplugin.UsernameMetadata
+		expected         string
+	}
+
+	tests := map[string]testCase{
+		"no options": {
+			usernameTemplate: "{{.DisplayName}}_{{.RoleName}}",
+			config:           map[string]interface{}{},
+			metadata:         dbplugin.UsernameMetadata{DisplayName: "token-abc", RoleName: "my.role"},
+			expected:         "token-abc_my.role",
+		},
+		"uppercase": {
+			usernameTemplate: "{{.DisplayName}}_{{.RoleName}}",
+			config:           map[string]interface{}{"username_uppercase": true},
+			metadata:         dbplugin.UsernameMetadata{DisplayName: "token", RoleName: "role"},
+			expected:         "TOKEN_ROLE",
+		},
+		"sanitize metadata": {
+			usernameTemplate: "v_{{.DisplayName}}_{{.RoleName}}",
+			config:           map[string]interface{}{"username_sanitize_metadata": "true"},
+			metadata:         dbplugin.UsernameMetadata{DisplayName: "oidc-jane@example.com", RoleName: "my.role"},
+			expected:         "v_oidcjaneexamplecom_myrole",
+		},
+		"truncate": {
+			usernameTemplate: "{{.DisplayName}}",
+			config:           map[string]interface{}{"username_truncate": true},
+			metadata:         dbplugin.UsernameMetadata{DisplayName: strings.Repeat("a", 300)},
+			expected:         strings.Repeat("a", maxIdentifierLength),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			up, err := template.NewTemplate(template.Template(test.usernameTemplate))
+			require.NoError(t, err)
+
+			opts, err := parseUsernameOptions(test.config)
+			require.NoError(t, err)
+
+			db := &SnowflakeSQL{
+				usernameProducer: up,
+				usernameOptions:  opts,
+			}
+			username, err := db.generateUsername(dbplugin.NewUserRequest{UsernameConfig: test.metadata})
+			require.NoError(t, err)
+			require.Equal(t, test.expected, username)
+		})
+	}
+}
+
+func TestSnowflakeSQL_QuotedUsernames(t *testing.T) {
+	req := fakeNewUserRequest("CREATE USER {{quoted_name}} PASSWORD = '{{password}}'")
+
+	// The plugin's own statements refer to the lower case user by its upper
+	// cased name unless usernames are quoted.
+	db, _ := newFakeSnowflake(t, map[string]interface{}{"ephemeral_role": true})
+	_, err := db.NewUser(context.Background(), req)
+	require.ErrorContains(t, err, "does not exist")
+
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"username_quoted":       true,
+		"ephemeral_role":        true,
+		"user_comment_template": "created by Vault",
+	})
+	resp, err := db.NewUser(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []string{resp.Username}, fake.Users(), "the user should keep its case")
+	user, ok := fake.User(quoteIdentifier(resp.Username))
+	require.True(t, ok)
+	require.Equal(t, "created by Vault", user.Properties["COMMENT"])
+
+	_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: resp.Username,
+		Password: &dbplugin.ChangePassword{NewPassword: "new_password"},
+	})
+	require.NoError(t, err)
+	user, _ = fake.User(quoteIdentifier(resp.Username))
+	require.Equal(t, "new_password", user.Properties["PASSWORD"])
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: resp.Username})
+	require.NoError(t, err)
+	require.Empty(t, fake.Users())
+	require.Equal(t, []string{"PUBLIC"}, fake.Roles(), "the ephemeral role should be dropped")
+
+	// Users left behind by a failed creation are dropped by their quoted
+	// name too.
+	_, err = db.NewUser(context.Background(), fakeNewUserRequest(
+		"CREATE USER {{quoted_name}} PASSWORD = '{{password}}'",
+		"GRANT ROLE missing TO USER {{quoted_name}}",
+	))
+	require.Error(t, err)
+	require.Empty(t, fake.Users())
+	require.Empty(t, db.journal.list())
+}
+
+func TestUsernameOptions_Statements(t *testing.T) {
+	require.Equal(t, []string{"drop user {{name}}"}, usernameOptions{}.statements("drop user {{name}}"))
+	require.Equal(t, []string{"drop user {{quoted_name}}"}, usernameOptions{quoted: true}.statements("drop user {{name}}"))
+	require.Equal(t, "v_User", usernameOptions{}.identifier("v_User"))
+	require.Equal(t, `"v_""User"`, usernameOptions{quoted: true}.identifier(`v_"User`))
+}
+
+func TestCheckTemplateFunctions(t *testing.T) {
+	SetUsernameTemplateFunctions([]string{"printf", "truncate", "replace", "random"})
+	t.Cleanup(func() { SetUsernameTemplateFunctions(nil) })
+
+	require.NoError(t, checkTemplateFunctions(`{{ printf "v_%s_%s" (.RoleName | truncate 32) (random 20) | replace "-" "_" }}`))
+	require.EqualError(t, checkTemplateFunctions(`{{ if eq .RoleName "x" }}{{ unix_time }}{{ else }}{{ .DisplayName | uuid }}{{ end }}`),
+		"invalid username_template: functions not allowed by the plugin: eq, unix_time, uuid")
+
+	_, err := new().Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":    "vault:password@fake/db",
+			"username_template": "{{ .RoleName }}_{{ unix_time }}",
+		},
+	})
+	require.ErrorContains(t, err, "functions not allowed by the plugin: unix_time")
+
+	// Without an allowlist every function is allowed.
+	SetUsernameTemplateFunctions(nil)
+	require.NoError(t, checkTemplateFunctions(`{{ unix_time }}`))
+}
@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// verificationOptions are the credentials of a separate, low privilege user
+// that connection verification logs in as instead of the user that manages
+// users, so that routine pings do not open sessions as that user.
+type verificationOptions struct {
+	username   string
+	password   string
+	privateKey string
+}
+
+func parseVerificationOptions(config map[string]interface{}) (verificationOptions, error) {
+	var opts verificationOptions
+	var err error
+
+	if opts.username, err = strutil.GetString(config, "verification_username"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve verification_username: %w", err)
+	}
+	if opts.password, err = strutil.GetString(config, "verification_password"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve verification_password: %w", err)
+	}
+	if opts.privateKey, err = strutil.GetString(config, "verification_private_key"); err != nil {
+		return opts, fmt.Errorf("failed to retrieve verification_private_key: %w", err)
+	}
+
+	switch {
+	case opts.password != "" && opts.privateKey != "":
+		return opts, fmt.Errorf("verification_password and verification_private_key cannot both be set")
+	case opts.username == "" && (opts.password != "" || opts.privateKey != ""):
+		return opts, fmt.Errorf("verification_password and verification_private_key require verification_username to be set")
+	case opts.username != "" && opts.password == "" && opts.privateKey == "":
+		return opts, fmt.Errorf("verification_username requires verification_password or verification_private_key to be set")
+	}
+	return opts, nil
+}
+
+// verificationKeyFingerprintField is kept in the plugin config with the
+// fingerprint of verification_private_key, so that it can be checked
+// against DESCRIBE USER without reading the key.
+const verificationKeyFingerprintField = "verification_private_key_fingerprint"
+
+// recordKeyFingerprint sets the fingerprint of the verification user's
+// private key in config, or removes it if there is no key.
+func (o verificationOptions) recordKeyFingerprint(config map[string]interface{}) error {
+	if o.privateKey == "" {
+		delete(config, verificationKeyFingerprintField)
+		return nil
+	}
+	key, err := parsePrivateKey(o.privateKey)
+	if err != nil {
+		return fmt.Errorf("invalid verification_private_key: %w", err)
+	}
+	fingerprint, err := privateKeyFingerprint(key)
+	if err != nil {
+		return err
+	}
+	config[verificationKeyFingerprintField] = fingerprint
+	return nil
+}
+
+func (o verificationOptions) enabled() bool {
+	return o.username != ""
+}
+
+// dsn returns connectionURL with its credentials replaced by the
+// verification user's. The account and network settings are kept, but the
+// role, database, schema, and warehouse are the user's defaults, since the
+// ones the configured user connects with are not likely granted to it.
+func (o verificationOptions) dsn(connectionURL string, minKeyBits int) (string, error) {
+	cfg, err := gosnowflake.ParseDSN(connectionURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection_url: %s", redactString(err.Error()))
+	}
+
+	cfg.User = o.username
+	cfg.Role = ""
+	cfg.Database = ""
+	cfg.Schema = ""
+	cfg.Warehouse = ""
+	cfg.Password = ""
+	cfg.PrivateKey = nil
+	cfg.Authenticator = gosnowflake.AuthTypeSnowflake
+	if o.privateKey != "" {
+		key, err := parsePrivateKey(o.privateKey)
+		if err != nil {
+			return "", fmt.Errorf("invalid verification_private_key: %w", err)
+		}
+		if err := checkRSAKeySize("verification_private_key", &key.PublicKey, minKeyBits); err != nil {
+			return "", err
+		}
+		cfg.PrivateKey = key
+		cfg.Authenticator = gosnowflake.AuthTypeJwt
+	} else {
+		cfg.Password = o.password
+	}
+
+	dsn, err := gosnowflake.DSN(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to build verification connection URL: %s", redactString(err.Error()))
+	}
+	return dsn, nil
+}
+
+// pingConnection verifies that Snowflake can be reached and logged in to,
+// as the verification user if there is one.
+func (s *SnowflakeSQL) pingConnection(ctx context.Context) error {
+	if !s.verification.enabled() {
+		db, err := s.getConnection(ctx)
+		if err != nil {
+			return err
+		}
+		return db.PingContext(ctx)
+	}
+
+	if err := s.pingAs(ctx, s.verification); err != nil {
+		return fmt.Errorf("failed to log in as verification_username %q: %w", s.verification.username, err)
+	}
+	return nil
+}
+
+// verifyNewUser logs in as a user NewUser has created, with its password, so
+// that a user who cannot log in fails the request instead of the
+// application it is issued to.
+func (s *SnowflakeSQL) verifyNewUser(ctx context.Context, username, password string) error {
+	if err := s.pingAs(ctx, verificationOptions{username: username, password: password}); err != nil {
+		return fmt.Errorf("failed to log in as new user %q: %w", username, err)
+	}
+	return nil
+}
+
+// pingAs connects to Snowflake with the connection URL's account and network
+// options, but logging in as login.
+func (s *SnowflakeSQL) pingAs(ctx context.Context, login verificationOptions) error {
+	s.SQLConnectionProducer.Lock()
+	connectionURL, driverName := s.ConnectionURL, s.SQLConnectionProducer.Type
+	s.SQLConnectionProducer.Unlock()
+
+	dsn, err := login.dsn(connectionURL, s.minRSAKeyBits)
+	if err != nil {
+		return err
+	}
+	// Cache the parsed config so the connection uses the network options.
+	key, err := parsedConfigs.acquire(dsn, nil, s.cachedNetwork, nil)
+	if err != nil {
+		return err
+	}
+	defer parsedConfigs.release(key)
+
+	db, err := sql.Open(driverName, dataSourceName(driverName, key))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.PingContext(ctx)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVerificationOptions(t *testing.T) {
+	opts, err := parseVerificationOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	require.False(t, opts.enabled())
+
+	_, err = parseVerificationOptions(map[string]interface{}{"verification_username": "monitor"})
+	require.EqualError(t, err, "verification_username requires verification_password or verification_private_key to be set")
+
+	_, err = parseVerificationOptions(map[string]interface{}{"verification_password": "secret"})
+	require.EqualError(t, err, "verification_password and verification_private_key require verification_username to be set")
+
+	_, err = parseVerificationOptions(map[string]interface{}{
+		"verification_username":    "monitor",
+		"verification_password":    "secret",
+		"verification_private_key": "key",
+	})
+	require.EqualError(t, err, "verification_password and verification_private_key cannot both be set")
+}
+
+func TestVerificationOptions_RecordKeyFingerprint(t *testing.T) {
+	key := testPrivateKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	// What Snowflake reports as RSA_PUBLIC_KEY_FP once the public key is set.
+	want, err := publicKeyFingerprint(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	opts := verificationOptions{username: "monitor", privateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))}
+	config := map[string]interface{}{}
+	require.NoError(t, opts.recordKeyFingerprint(config))
+	require.Equal(t, want, config[verificationKeyFingerprintField])
+
+	require.NoError(t, verificationOptions{username: "monitor", password: "secret"}.recordKeyFingerprint(config))
+	require.Empty(t, config)
+}
+
+func TestVerificationOptions_DSN(t *testing.T) {
+	connectionURL := "vault@account/db?authenticator=SNOWFLAKE_JWT&role=vault_admin&warehouse=wh"
+
+	opts := verificationOptions{username: "monitor", password: "secret"}
+	dsn, err := opts.dsn(connectionURL, 0)
+	require.NoError(t, err)
+	cfg, err := gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "monitor", cfg.User)
+	require.Equal(t, "secret", cfg.Password)
+	require.Equal(t, gosnowflake.AuthTypeSnowflake, cfg.Authenticator)
+	require.Empty(t, cfg.Role)
+	require.Empty(t, cfg.Warehouse)
+	require.Empty(t, cfg.Database)
+
+	opts = verificationOptions{username: "monitor", privateKey: pemPrivateKey(t)}
+	_, err = opts.dsn(connectionURL, 4096)
+	require.ErrorContains(t, err, "verification_private_key")
+	dsn, err = opts.dsn(connectionURL, 2048)
+	require.NoError(t, err)
+	cfg, err = gosnowflake.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, gosnowflake.AuthTypeJwt, cfg.Authenticator)
+	require.NotNil(t, cfg.PrivateKey)
+}
+
+func TestSnowflakeSQL_VerificationUser(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"verification_username": "monitor",
+		"verification_password": "monitor_password",
+	})
+
+	dsnUsers := func() []string {
+		var users []string
+		for _, dsn := range fake.DSNs() {
+			cfg, err := gosnowflake.ParseDSN(dsn)
+			require.NoError(t, err)
+			users = append(users, cfg.User)
+		}
+		return users
+	}
+	require.Equal(t, []string{"monitor"}, dsnUsers(), "only the verification user should have connected")
+
+	_, err := db.NewUser(context.Background(), fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"monitor", "vault"}, dsnUsers())
+
+	require.Contains(t, db.secretValues(), "monitor_password")
+}
+
+func TestSnowflakeSQL_VerificationUserRejected(t *testing.T) {
+	_, err := new().Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":        "vault:password@fake/db",
+			"verification_username": "monitor",
+		},
+	})
+	require.ErrorContains(t, err, "verification_username requires")
+}
+
+func TestSnowflakeSQL_VerifyNewCredentials(t *testing.T) {
+	db, fake := newFakeSnowflake(t, map[string]interface{}{
+		"username_template":      "{{.DisplayName}}_{{.RoleName}}",
+		"verify_new_credentials": true,
+	})
+	req := fakeNewUserRequest("CREATE USER {{name}} PASSWORD = '{{password}}'")
+
+	fake.FailLogin("token_analyst", errors.New("Incorrect username or password was specified"))
+	_, err := db.NewUser(context.Background(), req)
+	require.ErrorContains(t, err, `failed to log in as new user "token_analyst"`)
+	require.Empty(t, fake.Users(), "a user who cannot log in should be dropped")
+	require.Empty(t, db.journal.list())
+
+	fake.ClearFailures()
+	resp, err := db.NewUser(context.Background(), req)
+	require.NoError(t, err)
+
+	dsns := fake.DSNs()
+	cfg, err := gosnowflake.ParseDSN(dsns[len(dsns)-1])
+	require.NoError(t, err)
+	require.Equal(t, resp.Username, cfg.User)
+	require.Equal(t, req.Password, cfg.Password)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// asyncVerificationTimeout bounds how long background verification may
+// take, including the Snowflake login.
+const asyncVerificationTimeout = 2 * time.Minute
+
+// asyncVerification is the background verification started by Initialize
+// when verify_connection_async is set.
+type asyncVerification struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (v *asyncVerification) stop() {
+	if v == nil {
+		return
+	}
+	v.cancel()
+	<-v.done
+}
+
+// startAsyncVerification runs the connection checks in the background,
+// after pinging Snowflake if verifyConnection is set. The checks are also
+// armed to run on the first operation, so an operation that starts before
+// they have passed runs them itself, and a failure is returned by
+// operations until the checks pass.
+func (s *SnowflakeSQL) startAsyncVerification(verifyConnection bool, connectionChecks func(context.Context) error) {
+	s.stopAsyncVerification()
+
+	checks := func(ctx context.Context) error {
+		if verifyConnection && s.verification.enabled() {
+			if err := s.pingConnection(ctx); err != nil {
+				return fmt.Errorf("error verifying connection: %w", err)
+			}
+		} else if db := s.loadLastConnection(); verifyConnection && db != nil {
+			if err := db.PingContext(ctx); err != nil {
+				return fmt.Errorf("error verifying connection: %w", err)
+			}
+		}
+		return connectionChecks(ctx)
+	}
+	s.onFirstConnection.Store(&checks)
+
+	ctx, cancel := context.WithTimeout(context.Background(), asyncVerificationTimeout)
+	v := &asyncVerification{cancel: cancel, done: make(chan struct{})}
+	s.asyncVerification = v
+
+	go func() {
+		defer close(v.done)
+		defer cancel()
+
+		s.RLock()
+		_, err := s.getConnection(ctx)
+		s.RUnlock()
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return
+			}
+			s.logger.Error("background connection verification failed, operations will retry it", "error", err)
+			return
+		}
+		s.logger.Info("background connection verification succeeded")
+	}()
+}
+
+func (s *SnowflakeSQL) stopAsyncVerification() {
+	s.asyncVerification.stop()
+	s.asyncVerification = nil
+}
@@ -0,0 +1,16 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package version holds the version of the plugin binary.
+package version
+
+var (
+	// Version is the semantic version of the plugin, reported to Vault. It
+	// is set at build time by scripts/build.sh, from $VERSION or the tag of
+	// the commit, and is a development version otherwise.
+	Version = "v0.13.0-dev"
+
+	// GitCommit is the commit the plugin was built from. It is set at build
+	// time by scripts/build.sh.
+	GitCommit string
+)